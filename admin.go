@@ -0,0 +1,349 @@
+package karmabot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kamaln7/karmabot/database"
+	"github.com/kamaln7/karmabot/munge"
+
+	"github.com/nlopes/slack"
+)
+
+const adminUsage = "usage:\n" +
+	"`karmabot admin alias add <user> <alias> [alias...]`\n" +
+	"`karmabot admin alias remove <alias>`\n" +
+	"`karmabot admin alias list`\n" +
+	"`karmabot admin blacklist add <name>`\n" +
+	"`karmabot admin blacklist remove <name>`\n" +
+	"`karmabot admin blacklist list`\n" +
+	"`karmabot admin set <user> <points>`\n" +
+	"`karmabot admin role set <@user> <role>`\n" +
+	"`karmabot admin role remove <@user>`\n" +
+	"`karmabot admin role list`"
+
+func (b *Bot) handleAdminCommand(ctx context.Context, ev *slack.MessageEvent) {
+	match := regexps.Admin.FindStringSubmatch(ev.Text)
+	if len(match) == 0 {
+		return
+	}
+
+	allowed, err := b.can(ctx, ev.User, ActionAdmin)
+	if b.handleError(err, ev) {
+		return
+	}
+	if !allowed {
+		b.SendReply("Sorry, you are not allowed to do that.", ev)
+		return
+	}
+
+	args := strings.Fields(match[1])
+	if len(args) < 2 {
+		b.SendReply(adminUsage, ev)
+		return
+	}
+
+	switch cmd := args[0] + " " + args[1]; {
+	case cmd == "alias add" && len(args) >= 4:
+		b.adminAddAlias(ctx, ev, args[2], args[3:])
+	case cmd == "alias remove" && len(args) == 3:
+		b.adminRemoveAlias(ctx, ev, args[2])
+	case cmd == "alias list" && len(args) == 2:
+		b.adminListAliases(ctx, ev)
+	case cmd == "blacklist add" && len(args) == 3:
+		b.adminAddToBlacklist(ctx, ev, args[2])
+	case cmd == "blacklist remove" && len(args) == 3:
+		b.adminRemoveFromBlacklist(ctx, ev, args[2])
+	case cmd == "blacklist list" && len(args) == 2:
+		b.adminListBlacklist(ctx, ev)
+	case cmd == "role set" && len(args) == 4:
+		b.adminSetRole(ctx, ev, args[2], args[3])
+	case cmd == "role remove" && len(args) == 3:
+		b.adminRemoveRole(ctx, ev, args[2])
+	case cmd == "role list" && len(args) == 2:
+		b.adminListRoles(ctx, ev)
+	case args[0] == "set" && len(args) == 3:
+		b.adminSetKarma(ctx, ev, args[1], args[2])
+	default:
+		b.SendReply(adminUsage, ev)
+	}
+}
+
+func (b *Bot) adminAddAlias(ctx context.Context, ev *slack.MessageEvent, user string, aliases []string) {
+	user, err := b.resolveUser(user)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	for i, alias := range aliases {
+		alias, err = b.resolveUser(alias)
+		if b.handleError(err, ev) {
+			return
+		}
+
+		if alias == user {
+			b.SendReply(fmt.Sprintf("%s can not be an alias of itself.", alias), ev)
+			return
+		}
+
+		err = b.Config.DB.SetAlias(ctx, alias, user)
+		if b.handleError(err, ev) {
+			return
+		}
+
+		aliases[i] = alias
+	}
+
+	if b.handleError(b.audit(ctx, ev, "admin alias add", append([]string{user}, aliases...)), ev) {
+		return
+	}
+	b.Config.Log.KV("user", user).KV("aliases", aliases).KV("admin", ev.User).Info("added aliases")
+	b.SendReply(fmt.Sprintf("%s is now also known as %s", user, strings.Join(aliases, ", ")), ev)
+}
+
+func (b *Bot) adminRemoveAlias(ctx context.Context, ev *slack.MessageEvent, alias string) {
+	alias, err := b.resolveUser(alias)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	err = b.Config.DB.DeleteAlias(ctx, alias)
+	if err == database.ErrNoSuchAlias {
+		b.SendReply(fmt.Sprintf("%s is not an alias.", alias), ev)
+		return
+	}
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if b.handleError(b.audit(ctx, ev, "admin alias remove", []string{alias}), ev) {
+		return
+	}
+	b.Config.Log.KV("alias", alias).KV("admin", ev.User).Info("removed alias")
+	b.SendReply(fmt.Sprintf("removed alias %s", alias), ev)
+}
+
+func (b *Bot) adminListAliases(ctx context.Context, ev *slack.MessageEvent) {
+	aliases, err := b.Config.DB.GetAliases(ctx)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if len(aliases) == 0 {
+		b.SendReply("there are no aliases.", ev)
+		return
+	}
+
+	text := "*aliases*\n"
+	for _, alias := range aliases {
+		text += fmt.Sprintf("%s -> %s\n", alias.Alias, munge.Munge(alias.User))
+	}
+
+	b.SendReply(text, ev)
+}
+
+func (b *Bot) adminAddToBlacklist(ctx context.Context, ev *slack.MessageEvent, name string) {
+	name, err := b.resolveUser(name)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	err = b.Config.DB.AddToBlacklist(ctx, name)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if b.handleError(b.audit(ctx, ev, "admin blacklist add", []string{name}), ev) {
+		return
+	}
+	b.Config.Log.KV("user", name).KV("admin", ev.User).Info("added user to blacklist")
+	b.SendReply(fmt.Sprintf("added %s to the blacklist", name), ev)
+}
+
+func (b *Bot) adminRemoveFromBlacklist(ctx context.Context, ev *slack.MessageEvent, name string) {
+	name, err := b.resolveUser(name)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	err = b.Config.DB.RemoveFromBlacklist(ctx, name)
+	if err == database.ErrNotBlacklisted {
+		b.SendReply(fmt.Sprintf("%s is not blacklisted.", name), ev)
+		return
+	}
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if b.handleError(b.audit(ctx, ev, "admin blacklist remove", []string{name}), ev) {
+		return
+	}
+	b.Config.Log.KV("user", name).KV("admin", ev.User).Info("removed user from blacklist")
+	b.SendReply(fmt.Sprintf("removed %s from the blacklist", name), ev)
+}
+
+func (b *Bot) adminListBlacklist(ctx context.Context, ev *slack.MessageEvent) {
+	names, err := b.Config.DB.GetBlacklist(ctx)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if len(names) == 0 {
+		b.SendReply("the blacklist is empty.", ev)
+		return
+	}
+
+	b.SendReply(fmt.Sprintf("*blacklist*\n%s", strings.Join(names, "\n")), ev)
+}
+
+func (b *Bot) adminSetKarma(ctx context.Context, ev *slack.MessageEvent, name, pointsS string) {
+	points, err := strconv.Atoi(pointsS)
+	if err != nil {
+		b.SendReply(fmt.Sprintf("%q is not a valid number of points.", pointsS), ev)
+		return
+	}
+
+	from, err := b.getUserNameByID(ev.User)
+	if b.handleError(err, ev) {
+		return
+	}
+	name, err = b.parseUser(ctx, name)
+	if b.handleError(err, ev) {
+		return
+	}
+	name = strings.ToLower(name)
+
+	// the delta is computed in the same transaction as
+	// it is recorded, so concurrent karma is not lost
+	var current int
+	reason := "overridden by an admin"
+	entry := b.auditEntry(ev, "admin set", []string{name, pointsS})
+	totals, err := b.Config.DB.UpdatePointsAudited(ctx, []string{name}, entry, func(totals map[string]int) ([]*database.Points, error) {
+		current = totals[name]
+
+		return []*database.Points{{
+			From:   from,
+			To:     name,
+			Points: points - current,
+			Reason: reason,
+			Source: database.SourceAdmin,
+		}}, nil
+	})
+	if b.handleError(err, ev) {
+		return
+	}
+
+	b.Config.Log.KV("user", name).KV("points", totals[name].Points).KV("admin", ev.User).Info("set karma")
+
+	b.SendReply(pointsMessage(totals[name], reason, points-current), ev)
+}
+
+// mentionedUserID returns the ID of the user in a Slack mention.
+func mentionedUserID(mention string) (string, bool) {
+	match := regexps.SlackUser.FindStringSubmatch(mention)
+	if len(match) == 0 {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+func (b *Bot) adminSetRole(ctx context.Context, ev *slack.MessageEvent, mention, roleS string) {
+	user, ok := mentionedUserID(mention)
+	if !ok {
+		b.SendReply("please mention the user, e.g. `@username`.", ev)
+		return
+	}
+
+	role, err := database.ParseRole(roleS)
+	if err != nil {
+		b.SendReply(fmt.Sprintf("%s. valid roles are %s", err, roleNames()), ev)
+		return
+	}
+
+	err = b.Config.DB.SetRole(ctx, user, role)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if b.handleError(b.audit(ctx, ev, "admin role set", []string{user, string(role)}), ev) {
+		return
+	}
+	b.Config.Log.KV("user", user).KV("role", role).KV("admin", ev.User).Info("set role")
+	b.SendReply(fmt.Sprintf("<@%s> is now a %s", user, role), ev)
+}
+
+func (b *Bot) adminRemoveRole(ctx context.Context, ev *slack.MessageEvent, mention string) {
+	user, ok := mentionedUserID(mention)
+	if !ok {
+		b.SendReply("please mention the user, e.g. `@username`.", ev)
+		return
+	}
+
+	err := b.Config.DB.DeleteRole(ctx, user)
+	if err == database.ErrNoSuchRole {
+		b.SendReply(fmt.Sprintf("<@%s> does not have a role.", user), ev)
+		return
+	}
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if b.handleError(b.audit(ctx, ev, "admin role remove", []string{user}), ev) {
+		return
+	}
+	b.Config.Log.KV("user", user).KV("admin", ev.User).Info("removed role")
+	b.SendReply(fmt.Sprintf("removed the role of <@%s>", user), ev)
+}
+
+func (b *Bot) adminListRoles(ctx context.Context, ev *slack.MessageEvent) {
+	roles, err := b.Config.DB.GetRoles(ctx)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	if len(roles) == 0 {
+		b.SendReply("no roles have been assigned.", ev)
+		return
+	}
+
+	text := "*roles*\n"
+	for _, role := range roles {
+		text += fmt.Sprintf("<@%s>: %s\n", role.User, role.Role)
+	}
+
+	b.SendReply(text, ev)
+}
+
+// audit records an admin command that does not change anyone's
+// karma in the audit log. Changes to karma are recorded along with
+// the karma by UpdatePointsAudited.
+func (b *Bot) audit(ctx context.Context, ev *slack.MessageEvent, command string, args []string) error {
+	return b.Config.DB.InsertAuditEntry(ctx, b.auditEntry(ev, command, args))
+}
+
+// auditEntry returns the audit log entry of an admin command.
+func (b *Bot) auditEntry(ev *slack.MessageEvent, command string, args []string) *database.AuditEntry {
+	entry := &database.AuditEntry{
+		Actor:   ev.User,
+		Source:  "slack",
+		Command: command,
+		Args:    args,
+	}
+	if name, err := b.getUserNameByID(ev.User); err == nil {
+		entry.Actor = strings.ToLower(name)
+	}
+
+	return entry
+}
+
+func roleNames() string {
+	names := make([]string, len(database.Roles))
+	for i, role := range database.Roles {
+		names[i] = string(role)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,137 @@
+package karmabot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestAdminCommands(t *testing.T) {
+	admins := make(StringList)
+	admins.Set("admin")
+
+	tt := []struct {
+		Name             string
+		User             string
+		Commands         []string
+		ExpectMessage    string
+		ShouldHavePoints int
+	}{
+		{
+			Name:             "non-admins are rejected",
+			User:             "user",
+			Commands:         []string{"karmabot admin set onehundred_points 5"},
+			ExpectMessage:    "Sorry, you are not allowed to do that.",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "usage",
+			User:             "admin",
+			Commands:         []string{"karmabot admin"},
+			ExpectMessage:    adminUsage,
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "set karma",
+			User:             "admin",
+			Commands:         []string{"karmabot admin set onehundred_points 5"},
+			ExpectMessage:    "onehundred_points == 5 (-95 for overridden by an admin)",
+			ShouldHavePoints: 5,
+		},
+		{
+			Name: "aliases are resolved",
+			User: "admin",
+			Commands: []string{
+				"karmabot admin alias add onehundred_points hundo",
+				"hundo++",
+			},
+			ExpectMessage:    "onehundred_points == 101 (+1)",
+			ShouldHavePoints: 101,
+		},
+		{
+			Name: "removed aliases are not resolved",
+			User: "admin",
+			Commands: []string{
+				"karmabot admin alias add onehundred_points hundo",
+				"karmabot admin alias remove hundo",
+				"karmabot admin alias list",
+			},
+			ExpectMessage:    "there are no aliases.",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name: "blacklisted users can not receive karma",
+			User: "admin",
+			Commands: []string{
+				"karmabot admin blacklist add onehundred_points",
+				"onehundred_points++",
+				"karmabot admin blacklist list",
+			},
+			ExpectMessage:    "*blacklist*\nonehundred_points",
+			ShouldHavePoints: 100,
+		},
+	}
+
+	for _, tc := range tt {
+		b, cs, db := newBot(&Config{
+			MaxPoints: 6,
+			Admins:    admins,
+		})
+
+		for _, command := range tc.Commands {
+			b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+				Msg: slack.Msg{
+					Type:    "message",
+					Channel: "C1",
+					User:    tc.User,
+					Text:    command,
+				},
+			})
+		}
+
+		if len(cs.SentMessages) == 0 {
+			t.Errorf("%s: did not send expected message %q", tc.Name, tc.ExpectMessage)
+		} else if msg := cs.SentMessages[len(cs.SentMessages)-1]; msg.Text != tc.ExpectMessage {
+			t.Errorf("%s: sent message %q; want %q", tc.Name, msg.Text, tc.ExpectMessage)
+		}
+
+		u, err := db.GetUser(context.Background(), "onehundred_points")
+		if err != nil {
+			t.Fatalf("%s: db.GetUser: %v", tc.Name, err)
+		}
+		if u.Points != tc.ShouldHavePoints {
+			t.Errorf("%s: user has %d points; want %d", tc.Name, u.Points, tc.ShouldHavePoints)
+		}
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	admins := make(StringList)
+	admins.Set("admin")
+
+	b, _, db := newBot(&Config{
+		Admins: admins,
+	})
+
+	b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+		Msg: slack.Msg{
+			Type:    "message",
+			Channel: "C1",
+			User:    "admin",
+			Text:    "karmabot admin set onehundred_points 5",
+		},
+	})
+
+	if len(db.audit) != 1 {
+		t.Fatalf("recorded %d audit entries; want 1", len(db.audit))
+	}
+
+	entry := db.audit[0]
+	if entry.Actor != "admin" || entry.Source != "slack" || entry.Command != "admin set" || entry.User != "onehundred_points" {
+		t.Errorf("recorded unexpected audit entry %#v", entry)
+	}
+	if entry.Before == nil || *entry.Before != 100 || entry.After == nil || *entry.After != 5 {
+		t.Errorf("recorded totals %v -> %v; want 100 -> 5", entry.Before, entry.After)
+	}
+}
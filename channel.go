@@ -0,0 +1,95 @@
+package karmabot
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+// ChannelPolicies is a map of channel ID -> policy
+type ChannelPolicies map[string]*database.ChannelPolicy
+
+// LoadChannelPolicies reads channel policies from a JSON file that
+// maps channel IDs to policies, e.g.
+// `{"C0123": {"replytype": "thread", "maxpoints": 2}}`.
+func LoadChannelPolicies(path string) (ChannelPolicies, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	policies := make(ChannelPolicies)
+	err = json.NewDecoder(f).Decode(&policies)
+	if err != nil {
+		return nil, err
+	}
+
+	for channel, policy := range policies {
+		policy.Channel = channel
+	}
+
+	return policies, nil
+}
+
+// inChannel returns a copy of the bot with a snapshot of its config
+// that has the policy for a channel applied to it. Policies that are
+// stored in the database take precedence over those in Config.Channels.
+func (b *Bot) inChannel(ctx context.Context, channel string) (*Bot, error) {
+	config := *b.config()
+
+	var policies []*database.ChannelPolicy
+	if policy, ok := config.Channels[channel]; ok {
+		policies = append(policies, policy)
+	}
+
+	policy, err := config.DB.GetChannelPolicy(ctx, channel)
+	switch err {
+	case nil:
+		policies = append(policies, policy)
+	case database.ErrNoSuchChannelPolicy:
+	default:
+		return nil, err
+	}
+
+	for _, policy := range policies {
+		applyChannelPolicy(&config, policy)
+	}
+
+	bot := *b
+	bot.Config = &config
+	return &bot, nil
+}
+
+func applyChannelPolicy(config *Config, policy *database.ChannelPolicy) {
+	if policy.ReplyType != nil {
+		config.ReplyType = *policy.ReplyType
+	}
+	if policy.MaxPoints != nil {
+		config.MaxPoints = *policy.MaxPoints
+	}
+	if policy.Karma != nil {
+		config.karmaDisabled = !*policy.Karma
+	}
+
+	if policy.Reactji == nil && policy.Upvote == nil && policy.Downvote == nil {
+		return
+	}
+
+	reactji := &ReactjiConfig{}
+	if config.Reactji != nil {
+		*reactji = *config.Reactji
+	}
+	if policy.Reactji != nil {
+		reactji.Enabled = *policy.Reactji
+	}
+	if policy.Upvote != nil {
+		reactji.Upvote = newStringList(policy.Upvote)
+	}
+	if policy.Downvote != nil {
+		reactji.Downvote = newStringList(policy.Downvote)
+	}
+	config.Reactji = reactji
+}
@@ -0,0 +1,115 @@
+package karmabot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+	"github.com/nlopes/slack"
+)
+
+func TestChannelPolicies(t *testing.T) {
+	var (
+		thread   = "thread"
+		one      = 1
+		disabled = false
+	)
+
+	tt := []struct {
+		Name             string
+		FilePolicy       *database.ChannelPolicy
+		DBPolicy         *database.ChannelPolicy
+		Text             string
+		ExpectMessage    string
+		ExpectThread     string
+		ShouldHavePoints int
+	}{
+		{
+			Name:             "no policy",
+			Text:             "onehundred_points+++",
+			ExpectMessage:    "onehundred_points == 102 (+2)",
+			ShouldHavePoints: 102,
+		},
+		{
+			Name:             "max points from file",
+			FilePolicy:       &database.ChannelPolicy{MaxPoints: &one},
+			Text:             "onehundred_points+++",
+			ExpectMessage:    "onehundred_points == 101 (+1)",
+			ShouldHavePoints: 101,
+		},
+		{
+			Name:             "reply in thread",
+			FilePolicy:       &database.ChannelPolicy{ReplyType: &thread},
+			Text:             "onehundred_points++",
+			ExpectMessage:    "onehundred_points == 101 (+1)",
+			ExpectThread:     "1234.5678",
+			ShouldHavePoints: 101,
+		},
+		{
+			Name:             "karma disabled in database",
+			FilePolicy:       &database.ChannelPolicy{MaxPoints: &one},
+			DBPolicy:         &database.ChannelPolicy{Karma: &disabled},
+			Text:             "onehundred_points++",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "queries work with karma disabled",
+			DBPolicy:         &database.ChannelPolicy{Karma: &disabled},
+			Text:             "onehundred_points==",
+			ExpectMessage:    "onehundred_points == 100",
+			ShouldHavePoints: 100,
+		},
+	}
+
+	for _, tc := range tt {
+		b, cs, db := newBot(&Config{
+			MaxPoints: 6,
+			ReplyType: "message",
+			Channels:  make(ChannelPolicies),
+		})
+		db.policies = make(map[string]*database.ChannelPolicy)
+		if tc.FilePolicy != nil {
+			b.Config.Channels["C1"] = tc.FilePolicy
+		}
+		if tc.DBPolicy != nil {
+			db.policies["C1"] = tc.DBPolicy
+		}
+
+		b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+			Msg: slack.Msg{
+				Type:      "message",
+				Channel:   "C1",
+				User:      "user",
+				Text:      tc.Text,
+				Timestamp: "1234.5678",
+			},
+		})
+
+		switch {
+		case tc.ExpectMessage == "" && len(cs.SentMessages) != 0:
+			t.Errorf("%s: sent unexpected message %q", tc.Name, cs.SentMessages[0].Text)
+		case tc.ExpectMessage != "" && len(cs.SentMessages) != 1:
+			t.Errorf("%s: sent %d messages; want 1", tc.Name, len(cs.SentMessages))
+		case tc.ExpectMessage != "":
+			msg := cs.SentMessages[0]
+			if msg.Text != tc.ExpectMessage {
+				t.Errorf("%s: sent message %q; want %q", tc.Name, msg.Text, tc.ExpectMessage)
+			}
+			if msg.ThreadTimestamp != tc.ExpectThread {
+				t.Errorf("%s: replied in thread %q; want %q", tc.Name, msg.ThreadTimestamp, tc.ExpectThread)
+			}
+		}
+
+		u, err := db.GetUser(context.Background(), "onehundred_points")
+		if err != nil {
+			t.Fatalf("%s: db.GetUser: %v", tc.Name, err)
+		}
+		if u.Points != tc.ShouldHavePoints {
+			t.Errorf("%s: user has %d points; want %d", tc.Name, u.Points, tc.ShouldHavePoints)
+		}
+
+		if b.Config.MaxPoints != 6 || b.Config.ReplyType != "message" {
+			t.Errorf("%s: channel policy modified the bot's config", tc.Name)
+		}
+	}
+}
@@ -7,8 +7,9 @@ import (
 type TestChatService struct {
 	IncomingEvents chan slack.RTMEvent
 
-	SentMessages []*slack.OutgoingMessage
-	id           int
+	SentMessages   []*slack.OutgoingMessage
+	PublishedViews map[string]*View
+	id             int
 }
 
 func newTestChatService() ChatService {
@@ -57,3 +58,11 @@ func (t *TestChatService) PostEphemeral(channelID, userID string, options ...sla
 
 	return "", nil
 }
+
+func (t *TestChatService) PublishView(user string, view *View) error {
+	if t.PublishedViews == nil {
+		t.PublishedViews = make(map[string]*View)
+	}
+	t.PublishedViews[user] = view
+	return nil
+}
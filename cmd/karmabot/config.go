@@ -0,0 +1,372 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/kamaln7/karmabot"
+	"github.com/kamaln7/karmabot/database"
+)
+
+// settings is the complete configuration of a karmabot process. It is
+// assembled from the config file, environment variables and cli flags,
+// in increasing order of precedence.
+type settings struct {
+	DB              string
+	Workspaces      karmabot.WorkspaceList
+	ShutdownTimeout time.Duration
+
+	WebUI struct {
+		ListenAddr, URL, Path, TOTP, Auth             string
+		SlackClientID, SlackClientSecret, SlackIssuer string
+		SlackSigningSecret                            string
+		Theme, OrgName, Logo, AccentColor             string
+		SessionLifetime                               time.Duration
+		InsecureCookies                               bool
+	}
+
+	// Bot is the config that is shared by all workspaces. Slack, DB,
+	// UI, Log and Workspace are set per workspace.
+	Bot *karmabot.Config
+}
+
+// loadSettings reads the config file, if any, and applies any
+// explicitly set flags and environment variables on top of it.
+func loadSettings() (*settings, error) {
+	var (
+		fc  *karmabot.FileConfig
+		err error
+	)
+	if *configpath != "" {
+		fc, err = karmabot.LoadConfigFile(*configpath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// flags and env vars that were set explicitly
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	all := func(string) bool { return true }
+	isSet := func(name string) bool { return set[name] }
+
+	s := &settings{
+		Bot: &karmabot.Config{},
+	}
+
+	err = s.applyFlags(all)
+	if err != nil {
+		return nil, err
+	}
+
+	if fc != nil {
+		s.applyFile(fc)
+
+		err = s.applyFlags(isSet)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.Workspaces) == 0 {
+		return nil, fmt.Errorf("please pass the slack RTM token (see `karmabot -h` for help)")
+	}
+
+	return s, nil
+}
+
+// applyFlags sets the options whose flags are matched by include.
+func (s *settings) applyFlags(include func(name string) bool) error {
+	c := s.Bot
+
+	if include("db") {
+		s.DB = *dbpath
+	}
+	if include("shutdowntimeout") {
+		s.ShutdownTimeout = *shutdowntimeout
+	}
+	if include("webui.listenaddr") {
+		s.WebUI.ListenAddr = *webuilistenaddr
+	}
+	if include("webui.url") {
+		s.WebUI.URL = *webuiurl
+	}
+	if include("webui.path") {
+		s.WebUI.Path = *webuipath
+	}
+	if include("webui.totp") {
+		s.WebUI.TOTP = *webuitotp
+	}
+	if include("webui.auth") {
+		s.WebUI.Auth = *webuiauth
+	}
+	if include("webui.slack.clientid") {
+		s.WebUI.SlackClientID = *webuiclientid
+	}
+	if include("webui.slack.clientsecret") {
+		s.WebUI.SlackClientSecret = *webuisecret
+	}
+	if include("webui.slack.issuer") {
+		s.WebUI.SlackIssuer = *webuiissuer
+	}
+	if include("webui.slack.signingsecret") {
+		s.WebUI.SlackSigningSecret = *webuisigningsecret
+	}
+	if include("webui.sessionlifetime") {
+		s.WebUI.SessionLifetime = *webuilifetime
+	}
+	if include("webui.insecurecookies") {
+		s.WebUI.InsecureCookies = *webuiinsecure
+	}
+	if include("webui.theme") {
+		s.WebUI.Theme = *webuitheme
+	}
+	if include("webui.orgname") {
+		s.WebUI.OrgName = *webuiorgname
+	}
+	if include("webui.logo") {
+		s.WebUI.Logo = *webuilogo
+	}
+	if include("webui.accentcolor") {
+		s.WebUI.AccentColor = *webuiaccent
+	}
+	if include("token") || include("workspace") {
+		s.Workspaces = nil
+		if *token != "" {
+			s.Workspaces = append(s.Workspaces, &karmabot.Workspace{Token: *token})
+		}
+		s.Workspaces = append(s.Workspaces, workspaces...)
+	}
+
+	if include("debug") {
+		c.Debug = *debug
+	}
+	if include("maxpoints") {
+		c.MaxPoints = *maxpoints
+	}
+	if include("leaderboardlimit") {
+		c.LeaderboardLimit = *leaderboardlimit
+	}
+	if include("motivate") {
+		c.Motivate = *motivate
+	}
+	if include("selfkarma") {
+		c.SelfKarma = *selfkarma
+	}
+	if include("replytype") {
+		c.ReplyType = *replytype
+	}
+	if include("things") {
+		if !karmabot.ValidThingsMode(*things) {
+			return fmt.Errorf("invalid things %q, must be one of %s", *things, strings.Join(karmabot.ThingsModes, ", "))
+		}
+
+		c.Things = *things
+	}
+	if include("workers") {
+		c.Workers = *workers
+	}
+	if include("queuesize") {
+		c.QueueSize = *queuesize
+	}
+	if include("blacklist") {
+		c.UserBlacklist = blacklist
+	}
+	if include("admin") {
+		c.Admins = admins
+	}
+	if include("defaultrole") {
+		role, err := database.ParseRole(*defaultrole)
+		if err != nil {
+			return fmt.Errorf("invalid defaultrole: %v", err)
+		}
+
+		c.DefaultRole = role
+	}
+
+	if include("alias") {
+		c.Aliases = make(karmabot.UserAliases, 0)
+		for k := range aliases {
+			users := strings.Split(k, "++")
+			if len(users) <= 1 {
+				return fmt.Errorf("invalid alias format %q. see documentation", k)
+			}
+
+			user := users[0]
+			for _, alias := range users[1:] {
+				c.Aliases[alias] = user
+			}
+		}
+	}
+
+	if c.Reactji == nil {
+		c.Reactji = &karmabot.ReactjiConfig{
+			Upvote:   defaultUpvoteReactji,
+			Downvote: defaultDownvoteReactji,
+		}
+	}
+	if include("reactji") {
+		c.Reactji.Enabled = *reactji
+	}
+	if include("reactji.upvote") && len(upvotereactji) > 0 {
+		c.Reactji.Upvote = upvotereactji
+	}
+	if include("reactji.downvote") && len(downvotereactji) > 0 {
+		c.Reactji.Downvote = downvotereactji
+	}
+
+	if include("channels") && *channels != "" {
+		policies, err := karmabot.LoadChannelPolicies(*channels)
+		if err != nil {
+			return fmt.Errorf("could not load channel policies from %s: %v", *channels, err)
+		}
+
+		c.Channels = policies
+	}
+
+	return nil
+}
+
+func (s *settings) applyFile(fc *karmabot.FileConfig) {
+	if fc.DB != "" {
+		s.DB = fc.DB
+	}
+	if fc.ShutdownTimeout != nil {
+		s.ShutdownTimeout = *fc.ShutdownTimeout
+	}
+	if fc.WebUI.ListenAddr != "" {
+		s.WebUI.ListenAddr = fc.WebUI.ListenAddr
+	}
+	if fc.WebUI.URL != "" {
+		s.WebUI.URL = fc.WebUI.URL
+	}
+	if fc.WebUI.Path != "" {
+		s.WebUI.Path = fc.WebUI.Path
+	}
+	if fc.WebUI.TOTP != "" {
+		s.WebUI.TOTP = fc.WebUI.TOTP
+	}
+	if fc.WebUI.Auth != "" {
+		s.WebUI.Auth = fc.WebUI.Auth
+	}
+	if fc.WebUI.Slack.ClientID != "" {
+		s.WebUI.SlackClientID = fc.WebUI.Slack.ClientID
+	}
+	if fc.WebUI.Slack.ClientSecret != "" {
+		s.WebUI.SlackClientSecret = fc.WebUI.Slack.ClientSecret
+	}
+	if fc.WebUI.Slack.Issuer != "" {
+		s.WebUI.SlackIssuer = fc.WebUI.Slack.Issuer
+	}
+	if fc.WebUI.Slack.SigningSecret != "" {
+		s.WebUI.SlackSigningSecret = fc.WebUI.Slack.SigningSecret
+	}
+	if fc.WebUI.SessionLifetime != nil {
+		s.WebUI.SessionLifetime = *fc.WebUI.SessionLifetime
+	}
+	if fc.WebUI.InsecureCookies != nil {
+		s.WebUI.InsecureCookies = *fc.WebUI.InsecureCookies
+	}
+	if fc.WebUI.Theme.Mode != "" {
+		s.WebUI.Theme = fc.WebUI.Theme.Mode
+	}
+	if fc.WebUI.Theme.OrgName != "" {
+		s.WebUI.OrgName = fc.WebUI.Theme.OrgName
+	}
+	if fc.WebUI.Theme.Logo != "" {
+		s.WebUI.Logo = fc.WebUI.Theme.Logo
+	}
+	if fc.WebUI.Theme.AccentColor != "" {
+		s.WebUI.AccentColor = fc.WebUI.Theme.AccentColor
+	}
+	if fc.Token != "" || len(fc.Workspaces) > 0 {
+		s.Workspaces = nil
+		if fc.Token != "" {
+			s.Workspaces = append(s.Workspaces, &karmabot.Workspace{Token: fc.Token})
+		}
+		s.Workspaces = append(s.Workspaces, fc.Workspaces...)
+	}
+
+	fc.Apply(s.Bot)
+}
+
+// workspace returns the workspace that uses token, if any.
+func (s *settings) workspace(token string) *karmabot.Workspace {
+	for _, w := range s.Workspaces {
+		if w.Token == token {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// restartRequired lists the options that differ between s and
+// other and can not be changed without restarting karmabot.
+func (s *settings) restartRequired(other *settings) []string {
+	var changed []string
+
+	if s.DB != other.DB {
+		changed = append(changed, "db")
+	}
+	if s.WebUI != other.WebUI {
+		changed = append(changed, "webui")
+	}
+	if s.Bot.Things != other.Bot.Things {
+		// the web UI only reads it on startup
+		changed = append(changed, "things")
+	}
+	if s.Bot.Workers != other.Bot.Workers {
+		changed = append(changed, "workers")
+	}
+	if s.Bot.QueueSize != other.Bot.QueueSize {
+		changed = append(changed, "queuesize")
+	}
+
+	tokens := func(s *settings) []string {
+		var tokens []string
+		for _, w := range s.Workspaces {
+			tokens = append(tokens, w.Token)
+		}
+
+		return tokens
+	}
+	if !reflect.DeepEqual(tokens(s), tokens(other)) {
+		changed = append(changed, "workspaces")
+	}
+
+	return changed
+}
+
+// configChanged polls the config file and sends on the returned
+// channel whenever its modification time changes.
+func configChanged(path string, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{})
+
+	go func() {
+		var last time.Time
+		if info, err := os.Stat(path); err == nil {
+			last = info.ModTime()
+		}
+
+		for range time.Tick(interval) {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+
+			if !info.ModTime().Equal(last) {
+				last = info.ModTime()
+				changed <- struct{}{}
+			}
+		}
+	}()
+
+	return changed
+}
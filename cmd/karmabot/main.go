@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/kamaln7/karmabot"
 	"github.com/kamaln7/karmabot/database"
 	karmabotui "github.com/kamaln7/karmabot/ui"
 	"github.com/kamaln7/karmabot/ui/blankui"
 	"github.com/kamaln7/karmabot/ui/webui"
+	"github.com/kamaln7/karmabot/ui/webui/auth"
 
 	"github.com/aybabtme/log"
 	"github.com/kamaln7/envy"
@@ -17,25 +26,79 @@ import (
 
 // cli flags
 var (
-	token            = flag.String("token", "", "slack RTM token")
-	dbpath           = flag.String("db", "./db.sqlite3", "path to sqlite database")
-	maxpoints        = flag.Int("maxpoints", 6, "the maximum amount of points that users can give/take at once")
-	leaderboardlimit = flag.Int("leaderboardlimit", 10, "the default amount of users to list in the leaderboard")
-	debug            = flag.Bool("debug", false, "set debug mode")
-	webuitotp        = flag.String("webui.totp", "", "totp key")
-	webuipath        = flag.String("webui.path", "", "path to web UI files")
-	webuilistenaddr  = flag.String("webui.listenaddr", "", "address to listen and serve the web ui on")
-	webuiurl         = flag.String("webui.url", "", "url address for accessing the web ui")
-	motivate         = flag.Bool("motivate", true, "toggle motivate.im support")
-	blacklist        = make(karmabot.StringList, 0)
-	reactji          = flag.Bool("reactji", true, "use reactji as karma operations")
-	upvotereactji    = make(karmabot.StringList, 0)
-	downvotereactji  = make(karmabot.StringList, 0)
-	aliases          = make(karmabot.StringList, 0)
-	selfkarma        = flag.Bool("selfkarma", true, "allow users to add/remove karma to themselves")
-	replytype        = flag.String("replytype", "message", "how to reply to commands (message, thread)")
+	configpath         = flag.String("config", "", "path to a YAML config file")
+	configwatch        = flag.Duration("config.watch", 5*time.Second, "how often to check the config file for changes. 0 disables watching")
+	token              = flag.String("token", "", "slack RTM token")
+	workspaces         = make(karmabot.WorkspaceList, 0)
+	dbpath             = flag.String("db", "./db.sqlite3", "path to sqlite database")
+	maxpoints          = flag.Int("maxpoints", 6, "the maximum amount of points that users can give/take at once")
+	leaderboardlimit   = flag.Int("leaderboardlimit", 10, "the default amount of users to list in the leaderboard")
+	debug              = flag.Bool("debug", false, "set debug mode")
+	webuitotp          = flag.String("webui.totp", "", "unused: the web ui signs users in with personal login links instead")
+	webuipath          = flag.String("webui.path", "", "path to a directory with web UI files that override the built-in ones")
+	webuilistenaddr    = flag.String("webui.listenaddr", "", "address to listen and serve the web ui on")
+	webuiurl           = flag.String("webui.url", "", "url address for accessing the web ui")
+	webuiauth          = flag.String("webui.auth", "links", "how users authenticate to the web ui (links, slack)")
+	webuiclientid      = flag.String("webui.slack.clientid", "", "slack app client ID for signing in with slack")
+	webuisecret        = flag.String("webui.slack.clientsecret", "", "slack app client secret for signing in with slack")
+	webuiissuer        = flag.String("webui.slack.issuer", auth.SlackIssuer, "openid connect issuer for signing in with slack")
+	webuisigningsecret = flag.String("webui.slack.signingsecret", "", "slack app signing secret for receiving events from the events api, e.g. for the home tab")
+	webuilifetime      = flag.Duration("webui.sessionlifetime", auth.DefaultLifetime, "how long users stay signed in to the web ui")
+	webuiinsecure      = flag.Bool("webui.insecurecookies", false, "send web ui session cookies over plain HTTP")
+	webuitheme         = flag.String("webui.theme", webui.ThemeAuto, "web ui color theme (auto, light, dark)")
+	webuiorgname       = flag.String("webui.orgname", "", "organization name to show in the web ui instead of karmabot")
+	webuilogo          = flag.String("webui.logo", "", "url of a logo to show in the web ui")
+	webuiaccent        = flag.String("webui.accentcolor", "", "web ui accent color, e.g. #9b4dca")
+	motivate           = flag.Bool("motivate", true, "toggle motivate.im support")
+	blacklist          = make(karmabot.StringList, 0)
+	admins             = make(karmabot.StringList, 0)
+	defaultrole        = flag.String("defaultrole", "member", "the role of users that have not been assigned one (read-only, member, moderator, admin)")
+	reactji            = flag.Bool("reactji", true, "use reactji as karma operations")
+	upvotereactji      = make(karmabot.StringList, 0)
+	downvotereactji    = make(karmabot.StringList, 0)
+	aliases            = make(karmabot.StringList, 0)
+	selfkarma          = flag.Bool("selfkarma", true, "allow users to add/remove karma to themselves")
+	replytype          = flag.String("replytype", "message", "how to reply to commands (message, thread)")
+	things             = flag.String("things", karmabot.ThingsMixed, "how to rank karma for things and topics, as opposed to people (mixed, separate, disabled)")
+	channels           = flag.String("channels", "", "path to a JSON file with per-channel config overrides")
+	workers            = flag.Int("workers", karmabot.DefaultWorkers, "the number of slack events to handle concurrently")
+	queuesize          = flag.Int("queuesize", karmabot.DefaultQueueSize, "the number of slack events each worker may have queued before new events are held back")
+	shutdowntimeout    = flag.Duration("shutdowntimeout", 10*time.Second, "how long to wait for in-flight karma operations and web requests when shutting down")
 )
 
+// reactji defaults
+var (
+	defaultUpvoteReactji   = karmabot.StringList{"+1": {}, "thumbsup": {}, "thumbsup_all": {}}
+	defaultDownvoteReactji = karmabot.StringList{"-1": {}, "thumbsdown": {}}
+)
+
+// A connection is a connection to a Slack workspace.
+type connection struct {
+	token string
+	team  *database.Workspace
+	rtm   *slack.RTM
+	bot   *karmabot.Bot
+}
+
+// config returns the bot config for the connection's workspace.
+func (conn *connection) config(s *settings, db *database.DB, ui karmabotui.Provider, ll *log.Log) *karmabot.Config {
+	config := s.Bot
+	if w := s.workspace(conn.token); w != nil {
+		config = w.Apply(config)
+	} else {
+		c := *config
+		config = &c
+	}
+
+	config.Slack = &karmabot.SlackChatService{RTM: conn.rtm, Token: conn.token}
+	config.DB = db.WithTeam(conn.team.ID)
+	config.UI = ui
+	config.Workspace = conn.team.ID
+	config.Log = ll.KV("workspace", conn.team.Name)
+
+	return config
+}
+
 func main() {
 	// logging
 
@@ -44,9 +107,11 @@ func main() {
 	// cli flags
 
 	flag.Var(&blacklist, "blacklist", "blacklist users from having karma operations applied on them")
+	flag.Var(&admins, "admin", "slack user IDs of users who always have the admin role. may be passed multiple times")
 	flag.Var(&aliases, "alias", "alias different users to one user")
 	flag.Var(&upvotereactji, "reactji.upvote", "a list of reactjis to use for upvotes")
 	flag.Var(&downvotereactji, "reactji.downvote", "a list of reactjis to use for downvotes")
+	flag.Var(&workspaces, "workspace", "connect to an additional slack workspace. syntax: token=xoxb-...,name=acme[,maxpoints=N,...]")
 
 	envy.Parse("KB")
 	flag.Parse()
@@ -55,74 +120,129 @@ func main() {
 
 	ll.Info("starting karmabot")
 
-	// reactjis
-
-	// reactji defaults
-	if len(upvotereactji) == 0 {
-		upvotereactji.Set("+1")
-		upvotereactji.Set("thumbsup")
-		upvotereactji.Set("thumbsup_all")
-	}
-	if len(downvotereactji) == 0 {
-		downvotereactji.Set("-1")
-		downvotereactji.Set("thumbsdown")
-	}
-	reactjiConfig := &karmabot.ReactjiConfig{
-		Enabled:  *reactji,
-		Upvote:   upvotereactji,
-		Downvote: downvotereactji,
-	}
-
-	// format aliases
-	aliasMap := make(karmabot.UserAliases, 0)
-	for k := range aliases {
-		users := strings.Split(k, "++")
-		if len(users) <= 1 {
-			ll.Fatal("invalid alias format. see documentation")
-		}
-
-		user := users[0]
-		for _, alias := range users[1:] {
-			aliasMap[alias] = user
-		}
+	s, err := loadSettings()
+	if err != nil {
+		ll.Err(err).Fatal("could not load config")
 	}
 
 	// database
 
 	db, err := database.New(&database.Config{
-		Path: *dbpath,
+		Path: s.DB,
 	})
 
 	if err != nil {
-		ll.KV("path", *dbpath).Err(err).Fatal("could not open sqlite db")
+		ll.KV("path", s.DB).Err(err).Fatal("could not open sqlite db")
 	}
 
 	// slack
 
-	if *token == "" {
-		ll.Fatal("please pass the slack RTM token (see `karmabot -h` for help)")
+	connections := make([]*connection, len(s.Workspaces))
+	for i, workspace := range s.Workspaces {
+		//TODO: figure out a way to fix this
+		//our current logging library does not implement
+		//log.Logger
+		//slack.SetLogger(*ll)
+		api := slack.New(workspace.Token, slack.OptionDebug(s.Bot.Debug))
+
+		auth, err := api.AuthTest()
+		if err != nil {
+			ll.KV("workspace", workspace.Name).Err(err).Fatal("could not authenticate with slack")
+		}
+
+		team := &database.Workspace{
+			ID:   auth.TeamID,
+			Name: workspace.Name,
+		}
+		if team.Name == "" {
+			team.Name = auth.Team
+		}
+
+		err = db.SaveWorkspace(context.Background(), team)
+		if err != nil {
+			ll.KV("workspace", team.Name).Err(err).Fatal("could not save workspace")
+		}
+
+		connections[i] = &connection{
+			token: workspace.Token,
+			team:  team,
+			rtm:   api.NewRTM(),
+		}
 	}
 
-	//TODO: figure out a way to fix this
-	//our current logging library does not implement
-	//log.Logger
-	//slack.SetLogger(*ll)
-	sc := slack.New(*token, slack.OptionDebug(*debug)).NewRTM()
-	go sc.ManageConnection()
+	// karma recorded before multi-workspace support
+	// belongs to the first workspace
+	claimed, err := db.ClaimUnassigned(context.Background(), connections[0].team.ID)
+	if err != nil {
+		ll.Err(err).Fatal("could not assign existing karma to a workspace")
+	}
+	if claimed > 0 {
+		ll.KV("workspace", connections[0].team.Name).KV("rows", claimed).Info("assigned existing karma to workspace")
+	}
 
 	// karmabot
 
 	var ui karmabotui.Provider
-	if *webuipath != "" && *webuilistenaddr != "" {
+	if s.WebUI.TOTP != "" {
+		ll.Info("the web ui no longer accepts totp tokens, so its totp key is unused")
+	}
+	if s.WebUI.ListenAddr != "" {
 		ui, err = webui.New(&webui.Config{
-			ListenAddr:       *webuilistenaddr,
-			URL:              *webuiurl,
-			FilesPath:        *webuipath,
-			TOTP:             *webuitotp,
-			LeaderboardLimit: *leaderboardlimit,
-			Log:              ll.KV("provider", "webui"),
-			Debug:            *debug,
-			DB:               db,
+			ListenAddr:      s.WebUI.ListenAddr,
+			URL:             s.WebUI.URL,
+			FilesPath:       s.WebUI.Path,
+			Auth:            s.WebUI.Auth,
+			SessionLifetime: s.WebUI.SessionLifetime,
+			InsecureCookies: s.WebUI.InsecureCookies,
+			Theme: &webui.Theme{
+				Mode:        s.WebUI.Theme,
+				OrgName:     s.WebUI.OrgName,
+				Logo:        s.WebUI.Logo,
+				AccentColor: s.WebUI.AccentColor,
+			},
+			Slack: &auth.OIDCConfig{
+				Issuer:       s.WebUI.SlackIssuer,
+				ClientID:     s.WebUI.SlackClientID,
+				ClientSecret: s.WebUI.SlackClientSecret,
+			},
+			LeaderboardLimit: s.Bot.LeaderboardLimit,
+			SeparateThings:   s.Bot.Things == karmabot.ThingsSeparate || s.Bot.Things == karmabot.ThingsDisabled,
+			Authorize: func(ctx context.Context, team, user, action string) (bool, error) {
+				// sessions without a workspace are checked
+				// against the first workspace
+				for _, conn := range connections {
+					if team == "" || conn.team.ID == team {
+						return conn.bot.Can(ctx, user, karmabot.Action(action))
+					}
+				}
+
+				return false, nil
+			},
+			UserName: func(ctx context.Context, team, user string) (string, error) {
+				for _, conn := range connections {
+					if conn.team.ID == team {
+						return conn.bot.UserName(user)
+					}
+				}
+
+				return "", fmt.Errorf("unknown workspace %s", team)
+			},
+			SigningSecret: s.WebUI.SlackSigningSecret,
+			Events: func(ctx context.Context, team string, event json.RawMessage) {
+				for _, conn := range connections {
+					if conn.team.ID != team {
+						continue
+					}
+
+					if err := conn.bot.HandleEvent(ctx, event); err != nil {
+						ll.KV("workspace", conn.team.Name).Err(err).Error("could not handle slack event")
+					}
+					return
+				}
+			},
+			Log:   ll.KV("provider", "webui"),
+			Debug: s.Bot.Debug,
+			DB:    db,
 		})
 
 		if err != nil {
@@ -131,23 +251,95 @@ func main() {
 	} else {
 		ui = blankui.New()
 	}
-	go ui.Listen()
-
-	bot := karmabot.New(&karmabot.Config{
-		Slack:            &karmabot.SlackChatService{*sc},
-		UI:               ui,
-		Debug:            *debug,
-		MaxPoints:        *maxpoints,
-		LeaderboardLimit: *leaderboardlimit,
-		Log:              ll,
-		DB:               db,
-		UserBlacklist:    blacklist,
-		Reactji:          reactjiConfig,
-		Motivate:         *motivate,
-		Aliases:          aliasMap,
-		SelfKarma:        *selfkarma,
-		ReplyType:        *replytype,
-	})
+	for _, conn := range connections {
+		conn.bot = karmabot.New(conn.config(s, db, ui, ll))
+		go conn.rtm.ManageConnection()
+	}
+
+	// the web ui checks permissions with the bots
+	go func() {
+		if err := ui.Listen(); err != nil {
+			ll.Err(err).Fatal("could not start http server")
+		}
+	}()
+
+	// reloading
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	var changed <-chan struct{}
+	if *configpath != "" && *configwatch > 0 {
+		changed = configChanged(*configpath, *configwatch)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-reload:
+				ll.Info("received SIGHUP, reloading config")
+			case <-changed:
+				ll.KV("path", *configpath).Info("config file changed, reloading config")
+			}
+
+			next, err := loadSettings()
+			if err != nil {
+				ll.Err(err).Error("could not reload config, keeping the current config")
+				continue
+			}
+
+			if options := s.restartRequired(next); len(options) > 0 {
+				ll.KV("options", strings.Join(options, ", ")).Info("some changed options will only take effect after restarting karmabot")
+			}
+
+			for _, conn := range connections {
+				conn.bot.Reload(conn.config(next, db, ui, ll))
+			}
+			ll.Info("reloaded config")
+		}
+	}()
+
+	// shutdown
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		ll.KV("signal", sig).Info("shutting down")
+		cancel()
+	}()
+
+	var listeners sync.WaitGroup
+	for _, conn := range connections {
+		listeners.Add(1)
+		go func(bot *karmabot.Bot) {
+			defer listeners.Done()
+			bot.Listen(ctx)
+		}(conn.bot)
+	}
+	listeners.Wait()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// the web ui passes events to the bots, so it stops first
+	if err := ui.Shutdown(shutdownCtx); err != nil {
+		ll.Err(err).Error("could not shut down web ui cleanly")
+	}
+	for _, conn := range connections {
+		if err := conn.bot.Shutdown(shutdownCtx); err != nil {
+			ll.KV("workspace", conn.team.Name).Err(err).Error("gave up waiting for in-flight karma operations")
+		}
+	}
+	for _, conn := range connections {
+		if err := conn.rtm.Disconnect(); err != nil {
+			ll.KV("workspace", conn.team.Name).Err(err).Error("could not disconnect from slack")
+		}
+	}
+	if err := db.Close(); err != nil {
+		ll.Err(err).Error("could not close database")
+	}
 
-	bot.Listen()
+	ll.Info("bye")
 }
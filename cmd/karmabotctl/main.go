@@ -2,9 +2,13 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/kamaln7/karmabot"
 	"github.com/kamaln7/karmabot/ctlcommands"
+	"github.com/kamaln7/karmabot/database"
+	"github.com/kamaln7/karmabot/ui/webui"
+	"github.com/kamaln7/karmabot/ui/webui/auth"
 
 	"github.com/aybabtme/log"
 	"github.com/urfave/cli"
@@ -50,19 +54,49 @@ func main() {
 		Usage: "the default amount of users to list in the leaderboard",
 	}
 
+	workspace := cli.StringFlag{
+		Name:  "workspace",
+		Usage: "the ID of the slack workspace to operate on (default: all workspaces)",
+	}
+
+	dryrun := cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print what would be changed without writing anything",
+	}
+
+	yes := cli.BoolFlag{
+		Name:  "yes",
+		Usage: "do not ask for confirmation",
+	}
+
 	// webui
 
 	webuiCommands := []cli.Command{
 		{
-			Name:  "totp",
-			Usage: "generate a TOTP token",
+			Name:  "link",
+			Usage: "print a personal login link for the web ui",
 			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "the slack user ID to sign in",
+				},
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "the name to show for the user (default: the user ID)",
+				},
+				cli.StringFlag{
+					Name:  "url",
+					Usage: "url address for accessing the web ui",
+				},
 				cli.StringFlag{
-					Name:  "totp",
-					Usage: "totp key",
+					Name:  "uri",
+					Value: "/",
+					Usage: "the page of the web ui to open",
 				},
 			},
-			Action: cc.Mktotp,
+			Action: cc.Link,
 		},
 		{
 			Name:  "serve",
@@ -71,13 +105,9 @@ func main() {
 				dbpath,
 				debug,
 				leaderboardlimit,
-				cli.StringFlag{
-					Name:  "totp",
-					Usage: "totp key",
-				},
 				cli.StringFlag{
 					Name:  "path",
-					Usage: "path to web UI files",
+					Usage: "path to a directory with web UI files that override the built-in ones",
 				},
 				cli.StringFlag{
 					Name:  "listenaddr",
@@ -87,9 +117,109 @@ func main() {
 					Name:  "url",
 					Usage: "url address for accessing the web ui",
 				},
+				cli.StringFlag{
+					Name:  "auth",
+					Value: webui.AuthLinks,
+					Usage: "how users authenticate (links, slack)",
+				},
+				cli.StringFlag{
+					Name:  "slack.clientid",
+					Usage: "slack app client ID for signing in with slack",
+				},
+				cli.StringFlag{
+					Name:  "slack.clientsecret",
+					Usage: "slack app client secret for signing in with slack",
+				},
+				cli.StringFlag{
+					Name:  "slack.issuer",
+					Value: auth.SlackIssuer,
+					Usage: "openid connect issuer for signing in with slack",
+				},
+				cli.DurationFlag{
+					Name:  "sessionlifetime",
+					Value: auth.DefaultLifetime,
+					Usage: "how long users stay signed in",
+				},
+				cli.BoolFlag{
+					Name:  "insecurecookies",
+					Usage: "send session cookies over plain HTTP, for web UIs that are not served over HTTPS",
+				},
+				cli.StringFlag{
+					Name:  "theme",
+					Value: webui.ThemeAuto,
+					Usage: "color theme (auto, light, dark)",
+				},
+				cli.StringFlag{
+					Name:  "orgname",
+					Usage: "organization name to show instead of karmabot",
+				},
+				cli.StringFlag{
+					Name:  "logo",
+					Usage: "url of a logo to show next to the title",
+				},
+				cli.StringFlag{
+					Name:  "accentcolor",
+					Usage: "accent color, e.g. #9b4dca",
+				},
+				cli.BoolFlag{
+					Name:  "separatethings",
+					Usage: "leave things and topics, as opposed to people, out of the leaderboard",
+				},
+				cli.StringSliceFlag{
+					Name:  "admin",
+					Usage: "slack user ID of a user who always has the admin role. may be passed multiple times",
+				},
+				cli.StringFlag{
+					Name:  "defaultrole",
+					Value: string(database.RoleMember),
+					Usage: "the role of users that have not been assigned one",
+				},
+				cli.DurationFlag{
+					Name:  "shutdowntimeout",
+					Value: 10 * time.Second,
+					Usage: "how long to wait for active requests to finish when shutting down",
+				},
 			},
 			Action: cc.Serve,
 		},
+		{
+			Name:  "sessions",
+			Usage: "manage signed in web UI sessions",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "list sessions that have not expired",
+					Flags: []cli.Flag{
+						dbpath,
+						workspace,
+						cli.StringFlag{
+							Name:  "user",
+							Usage: "only list the sessions of this Slack user ID",
+						},
+					},
+					Action: cc.ListSessions,
+				},
+				{
+					Name:  "revoke",
+					Usage: "sign out a session or all of a user's sessions",
+					Flags: []cli.Flag{
+						dbpath,
+						workspace,
+						dryrun,
+						yes,
+						cli.StringFlag{
+							Name:  "id",
+							Usage: "the ID of the session to revoke",
+						},
+						cli.StringFlag{
+							Name:  "user",
+							Usage: "revoke all sessions of this Slack user ID",
+						},
+					},
+					Action: cc.RevokeSessions,
+				},
+			},
+		},
 	}
 
 	// karma
@@ -100,6 +230,9 @@ func main() {
 			Usage: "add karma to a user",
 			Flags: []cli.Flag{
 				dbpath,
+				workspace,
+				dryrun,
+				yes,
 				cli.StringFlag{
 					Name: "from",
 				},
@@ -120,6 +253,9 @@ func main() {
 			Usage: "move a user's karma to another user",
 			Flags: []cli.Flag{
 				dbpath,
+				workspace,
+				dryrun,
+				yes,
 				cli.StringFlag{
 					Name: "from",
 				},
@@ -137,6 +273,9 @@ func main() {
 			Usage: "reset a user's karma",
 			Flags: []cli.Flag{
 				dbpath,
+				workspace,
+				dryrun,
+				yes,
 				cli.StringFlag{
 					Name: "user",
 				},
@@ -148,6 +287,9 @@ func main() {
 			Usage: "set a user's karma to a specific number",
 			Flags: []cli.Flag{
 				dbpath,
+				workspace,
+				dryrun,
+				yes,
 				cli.StringFlag{
 					Name: "user",
 				},
@@ -162,12 +304,277 @@ func main() {
 			Usage: "get a karma throwback for a user",
 			Flags: []cli.Flag{
 				dbpath,
+				workspace,
 				cli.StringFlag{
 					Name: "user",
 				},
 			},
 			Action: cc.GetThrowback,
 		},
+		{
+			Name:  "kind",
+			Usage: "classify a name that receives karma as a person or a thing",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				cli.StringFlag{
+					Name: "user",
+				},
+				cli.StringFlag{
+					Name:  "kind",
+					Usage: "person or thing",
+				},
+			},
+			Action: cc.SetKind,
+		},
+	}
+
+	// channel
+
+	channelCommands := []cli.Command{
+		{
+			Name:  "set",
+			Usage: "override the config for a channel. options that are not passed are left unchanged",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				cli.StringFlag{
+					Name:  "channel",
+					Usage: "the channel's ID",
+				},
+				cli.StringFlag{
+					Name:  "replytype",
+					Usage: "how to reply to commands (message, thread, ephemeral)",
+				},
+				cli.IntFlag{
+					Name:  "maxpoints",
+					Usage: "the maximum amount of points that users can give/take at once",
+				},
+				cli.StringFlag{
+					Name:  "karma",
+					Usage: "enable or disable karma operations (true, false)",
+				},
+				cli.StringFlag{
+					Name:  "reactji",
+					Usage: "enable or disable reactji karma operations (true, false)",
+				},
+				cli.StringSliceFlag{
+					Name:  "upvote",
+					Usage: "a reactji to use for upvotes. may be passed multiple times",
+				},
+				cli.StringSliceFlag{
+					Name:  "downvote",
+					Usage: "a reactji to use for downvotes. may be passed multiple times",
+				},
+			},
+			Action: cc.SetChannelPolicy,
+		},
+		{
+			Name:  "unset",
+			Usage: "remove all config overrides for a channel",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				cli.StringFlag{
+					Name:  "channel",
+					Usage: "the channel's ID",
+				},
+			},
+			Action: cc.DeleteChannelPolicy,
+		},
+		{
+			Name:  "list",
+			Usage: "list all channel config overrides",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+			},
+			Action: cc.ListChannelPolicies,
+		},
+	}
+
+	// role
+
+	userFlag := cli.StringFlag{
+		Name:  "user",
+		Usage: "the user's Slack ID",
+	}
+
+	roleCommands := []cli.Command{
+		{
+			Name:  "set",
+			Usage: "assign a role to a user",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				userFlag,
+				cli.StringFlag{
+					Name:  "role",
+					Usage: "the user's role (read-only, member, moderator, admin)",
+				},
+			},
+			Action: cc.SetRole,
+		},
+		{
+			Name:  "unset",
+			Usage: "remove a user's role, so that they have the default role",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				userFlag,
+			},
+			Action: cc.DeleteRole,
+		},
+		{
+			Name:  "list",
+			Usage: "list all assigned roles",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+			},
+			Action: cc.ListRoles,
+		},
+	}
+
+	// decay
+
+	decayCommands := []cli.Command{
+		{
+			Name:  "set",
+			Usage: "make older karma count less, in a workspace or in all workspaces without their own decay",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				cli.StringFlag{
+					Name:  "model",
+					Usage: "the decay model (exponential, linear)",
+				},
+				cli.Float64Flag{
+					Name:  "months",
+					Usage: "the half-life of karma with exponential decay, or the age at which karma is worth nothing with linear decay",
+				},
+			},
+			Action: cc.SetDecay,
+		},
+		{
+			Name:  "unset",
+			Usage: "turn karma decay off",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+			},
+			Action: cc.DeleteDecay,
+		},
+		{
+			Name:  "list",
+			Usage: "list karma decay settings",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+			},
+			Action: cc.ListDecay,
+		},
+	}
+
+	// audit
+
+	auditCommands := []cli.Command{
+		{
+			Name:  "list",
+			Usage: "list administrative actions, newest first",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				cli.StringFlag{
+					Name:  "actor",
+					Usage: "only list actions performed by this operator",
+				},
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "only list actions that changed this user's karma",
+				},
+				cli.IntFlag{
+					Name:  "limit",
+					Usage: "the maximum amount of actions to list",
+					Value: 50,
+				},
+			},
+			Action: cc.ListAuditLog,
+		},
+	}
+
+	// db
+
+	dbCommands := []cli.Command{
+		{
+			Name:  "backup",
+			Usage: "write a consistent backup of the database, even while karmabot is running",
+			Flags: []cli.Flag{
+				dbpath,
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "the path of the backup. it must not exist yet",
+				},
+			},
+			Action: cc.Backup,
+		},
+		{
+			Name:  "restore",
+			Usage: "replace the database with a backup, after checking the backup's integrity",
+			Flags: []cli.Flag{
+				dbpath,
+				dryrun,
+				yes,
+				cli.StringFlag{
+					Name:  "input",
+					Usage: "the path of the backup",
+				},
+			},
+			Action: cc.Restore,
+		},
+		{
+			Name:  "compact",
+			Usage: "roll old karma operations into monthly summary rows per giver and receiver",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				cli.StringFlag{
+					Name:  "before",
+					Usage: "compact karma operations before this date (YYYY-MM-DD, UTC)",
+				},
+				cli.StringFlag{
+					Name:  "archive",
+					Usage: "copy the original rows to the database at this path before compacting them",
+				},
+			},
+			Action: cc.Compact,
+		},
+		{
+			Name:  "rebuild-totals",
+			Usage: "recompute every user's total from the karma operations",
+			Flags: []cli.Flag{
+				dbpath,
+				dryrun,
+				yes,
+			},
+			Action: cc.RebuildTotals,
+		},
 	}
 
 	// main app
@@ -181,6 +588,113 @@ func main() {
 			Name:        "webui",
 			Subcommands: webuiCommands,
 		},
+		{
+			Name:        "channel",
+			Subcommands: channelCommands,
+		},
+		{
+			Name:        "role",
+			Subcommands: roleCommands,
+		},
+		{
+			Name:        "audit",
+			Subcommands: auditCommands,
+		},
+		{
+			Name:        "db",
+			Subcommands: dbCommands,
+		},
+		{
+			Name:        "decay",
+			Subcommands: decayCommands,
+		},
+		{
+			Name:  "export",
+			Usage: "export karma operations",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "the output format (csv, json, ndjson)",
+					Value: "csv",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "the file to write to (default: stdout)",
+				},
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "only export karma received by this user",
+				},
+				cli.StringFlag{
+					Name:  "giver",
+					Usage: "only export karma given by this user",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only export karma given on or after this date (YYYY-MM-DD, UTC)",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only export karma given on or before this date (YYYY-MM-DD, UTC)",
+				},
+				cli.StringFlag{
+					Name:  "source",
+					Usage: "only export karma from this source (message, reactji, admin, karmabotctl)",
+				},
+			},
+			Action: cc.Export,
+		},
+		{
+			Name:  "graph",
+			Usage: "export a graph of who gave karma to whom",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "the output format (graphml, dot)",
+					Value: "graphml",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "the file to write to (default: stdout)",
+				},
+				cli.StringFlag{
+					Name:  "since",
+					Usage: "only include karma given on or after this date (YYYY-MM-DD, UTC)",
+				},
+				cli.StringFlag{
+					Name:  "until",
+					Usage: "only include karma given on or before this date (YYYY-MM-DD, UTC)",
+				},
+			},
+			Action: cc.ExportGraph,
+		},
+		{
+			Name:  "import",
+			Usage: "import karma from other bots",
+			Flags: []cli.Flag{
+				dbpath,
+				workspace,
+				dryrun,
+				yes,
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "the input format (hubot-plusplus, csv, karmabot)",
+				},
+				cli.StringFlag{
+					Name:  "input",
+					Usage: "the file to read from (default: stdin)",
+				},
+				cli.StringSliceFlag{
+					Name:  "alias",
+					Usage: "alias different users to one user (main++alias1++alias2). may be passed multiple times",
+				},
+			},
+			Action: cc.Import,
+		},
 	}
 
 	app.Run(os.Args)
@@ -0,0 +1,271 @@
+package karmabot
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ReplyTypes lists the valid values of Config.ReplyType.
+var ReplyTypes = []string{"message", "thread", "ephemeral"}
+
+// A FileConfig is karmabot's configuration as read from a YAML config
+// file. Options that are not set in the file are nil or empty.
+type FileConfig struct {
+	Token, DB string
+
+	Debug, Motivate, SelfKarma                      *bool
+	MaxPoints, LeaderboardLimit, Workers, QueueSize *int
+	ReplyType, Things                               *string
+	ShutdownTimeout                                 *time.Duration
+
+	Blacklist []string
+
+	// Admins lists the Slack user IDs of users who always have the admin role.
+	Admins []string
+
+	DefaultRole *string
+	Permissions Permissions
+
+	// Aliases maps a main username to its aliases.
+	Aliases map[string][]string
+
+	Reactji *struct {
+		Enabled          *bool
+		Upvote, Downvote []string
+	}
+
+	Channels   ChannelPolicies
+	Workspaces []*Workspace
+
+	WebUI struct {
+		ListenAddr, URL, Path, TOTP, Auth string
+		SessionLifetime                   *time.Duration
+		InsecureCookies                   *bool
+
+		// Slack configures signing in with Slack, and
+		// receiving events from Slack's Events API.
+		Slack struct {
+			ClientID, ClientSecret, Issuer, SigningSecret string
+		}
+
+		// Theme customizes the look of the web UI.
+		Theme struct {
+			Mode, OrgName, Logo, AccentColor string
+		}
+	}
+}
+
+// LoadConfigFile reads and validates a YAML config file. Unknown
+// options are reported as errors.
+func LoadConfigFile(path string) (*FileConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &FileConfig{}
+	err = yaml.UnmarshalStrict(data, fc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	err = fc.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for channel, policy := range fc.Channels {
+		policy.Channel = channel
+	}
+
+	return fc, nil
+}
+
+// Validate checks the config for invalid values. All problems
+// are reported in a single error.
+func (fc *FileConfig) Validate() error {
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if fc.MaxPoints != nil && *fc.MaxPoints < 1 {
+		fail("maxpoints must be at least 1, got %d", *fc.MaxPoints)
+	}
+	if fc.LeaderboardLimit != nil && *fc.LeaderboardLimit < 1 {
+		fail("leaderboardlimit must be at least 1, got %d", *fc.LeaderboardLimit)
+	}
+	if fc.Workers != nil && *fc.Workers < 1 {
+		fail("workers must be at least 1, got %d", *fc.Workers)
+	}
+	if fc.QueueSize != nil && *fc.QueueSize < 1 {
+		fail("queuesize must be at least 1, got %d", *fc.QueueSize)
+	}
+	if fc.ReplyType != nil && !validReplyType(*fc.ReplyType) {
+		fail("replytype must be one of %s, got %q", strings.Join(ReplyTypes, ", "), *fc.ReplyType)
+	}
+	if fc.Things != nil && !ValidThingsMode(*fc.Things) {
+		fail("things must be one of %s, got %q", strings.Join(ThingsModes, ", "), *fc.Things)
+	}
+	if fc.WebUI.SessionLifetime != nil && *fc.WebUI.SessionLifetime <= 0 {
+		fail("webui: sessionlifetime must be positive, got %v", *fc.WebUI.SessionLifetime)
+	}
+
+	if fc.DefaultRole != nil {
+		if _, err := database.ParseRole(*fc.DefaultRole); err != nil {
+			fail("defaultrole: %v", err)
+		}
+	}
+	if err := fc.Permissions.Validate(); err != nil {
+		fail("permissions: %v", err)
+	}
+
+	seen := make(map[string]string)
+	for main, aliases := range fc.Aliases {
+		if len(aliases) == 0 {
+			fail("aliases: %q does not have any aliases", main)
+		}
+
+		for _, alias := range aliases {
+			if other, ok := seen[alias]; ok && other != main {
+				fail("aliases: %q is an alias of both %q and %q", alias, other, main)
+			}
+			seen[alias] = main
+		}
+	}
+
+	for channel, policy := range fc.Channels {
+		if policy == nil {
+			fail("channels: %s does not have any options", channel)
+			continue
+		}
+		if policy.MaxPoints != nil && *policy.MaxPoints < 1 {
+			fail("channels: %s: maxpoints must be at least 1, got %d", channel, *policy.MaxPoints)
+		}
+		if policy.ReplyType != nil && !validReplyType(*policy.ReplyType) {
+			fail("channels: %s: replytype must be one of %s, got %q", channel, strings.Join(ReplyTypes, ", "), *policy.ReplyType)
+		}
+	}
+
+	tokens := make(map[string]bool)
+	if fc.Token != "" {
+		tokens[fc.Token] = true
+	}
+	for i, w := range fc.Workspaces {
+		switch {
+		case w.Token == "":
+			fail("workspaces: workspace #%d is missing a token", i+1)
+		case tokens[w.Token]:
+			fail("workspaces: workspace #%d uses a token that is already in use", i+1)
+		}
+		tokens[w.Token] = true
+
+		if w.MaxPoints != nil && *w.MaxPoints < 1 {
+			fail("workspaces: workspace #%d: maxpoints must be at least 1, got %d", i+1, *w.MaxPoints)
+		}
+		if w.ReplyType != nil && !validReplyType(*w.ReplyType) {
+			fail("workspaces: workspace #%d: replytype must be one of %s, got %q", i+1, strings.Join(ReplyTypes, ", "), *w.ReplyType)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("invalid config:")
+	for _, err := range errs {
+		buf.WriteString("\n  - ")
+		buf.WriteString(err)
+	}
+
+	return fmt.Errorf("%s", buf.String())
+}
+
+// Apply sets the options that are set in the file on config.
+func (fc *FileConfig) Apply(config *Config) {
+	if fc.Debug != nil {
+		config.Debug = *fc.Debug
+	}
+	if fc.Motivate != nil {
+		config.Motivate = *fc.Motivate
+	}
+	if fc.SelfKarma != nil {
+		config.SelfKarma = *fc.SelfKarma
+	}
+	if fc.MaxPoints != nil {
+		config.MaxPoints = *fc.MaxPoints
+	}
+	if fc.LeaderboardLimit != nil {
+		config.LeaderboardLimit = *fc.LeaderboardLimit
+	}
+	if fc.Workers != nil {
+		config.Workers = *fc.Workers
+	}
+	if fc.QueueSize != nil {
+		config.QueueSize = *fc.QueueSize
+	}
+	if fc.ReplyType != nil {
+		config.ReplyType = *fc.ReplyType
+	}
+	if fc.Things != nil {
+		config.Things = *fc.Things
+	}
+	if fc.Blacklist != nil {
+		config.UserBlacklist = newStringList(fc.Blacklist)
+	}
+	if fc.Admins != nil {
+		config.Admins = newStringList(fc.Admins)
+	}
+	if fc.DefaultRole != nil {
+		config.DefaultRole = database.Role(*fc.DefaultRole)
+	}
+	if fc.Permissions != nil {
+		config.Permissions = fc.Permissions
+	}
+	if fc.Aliases != nil {
+		config.Aliases = make(UserAliases)
+		for main, aliases := range fc.Aliases {
+			for _, alias := range aliases {
+				config.Aliases[alias] = main
+			}
+		}
+	}
+	if fc.Reactji != nil {
+		reactji := &ReactjiConfig{}
+		if config.Reactji != nil {
+			*reactji = *config.Reactji
+		}
+
+		if fc.Reactji.Enabled != nil {
+			reactji.Enabled = *fc.Reactji.Enabled
+		}
+		if fc.Reactji.Upvote != nil {
+			reactji.Upvote = newStringList(fc.Reactji.Upvote)
+		}
+		if fc.Reactji.Downvote != nil {
+			reactji.Downvote = newStringList(fc.Reactji.Downvote)
+		}
+		config.Reactji = reactji
+	}
+	if fc.Channels != nil {
+		config.Channels = fc.Channels
+	}
+}
+
+func validReplyType(replyType string) bool {
+	for _, t := range ReplyTypes {
+		if t == replyType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,174 @@
+package karmabot
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "karmabot-config-*.yml")
+	if err != nil {
+		t.Fatalf("could not create config file: %v", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(contents)
+	if err != nil {
+		t.Fatalf("could not write config file: %v", err)
+	}
+
+	return f.Name()
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+token: xoxb-main
+maxpoints: 3
+replytype: thread
+things: separate
+shutdowntimeout: 30s
+blacklist: [everyone, here]
+defaultrole: read-only
+permissions:
+  negativekarma: moderator
+aliases:
+  alice: [ali, al]
+reactji:
+  upvote: [tada]
+channels:
+  C0123:
+    karma: false
+workspaces:
+  - token: xoxb-other
+    name: sales
+    maxpoints: 1
+webui:
+  listenaddr: localhost:9000
+  theme:
+    mode: dark
+    orgname: Acme
+    accentcolor: "#ff6600"
+`)
+	defer os.Remove(path)
+
+	fc, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFile: %v", err)
+	}
+
+	if fc.ShutdownTimeout == nil || fc.ShutdownTimeout.Seconds() != 30 {
+		t.Errorf("LoadConfigFile: ShutdownTimeout is %v; want 30s", fc.ShutdownTimeout)
+	}
+	if fc.WebUI.ListenAddr != "localhost:9000" {
+		t.Errorf("LoadConfigFile: WebUI.ListenAddr is %q", fc.WebUI.ListenAddr)
+	}
+	if theme := fc.WebUI.Theme; theme.Mode != "dark" || theme.OrgName != "Acme" || theme.AccentColor != "#ff6600" {
+		t.Errorf("LoadConfigFile: did not parse the web UI theme correctly: %#v", theme)
+	}
+	if len(fc.Workspaces) != 1 || fc.Workspaces[0].Name != "sales" || *fc.Workspaces[0].MaxPoints != 1 {
+		t.Errorf("LoadConfigFile: did not parse workspaces correctly: %#v", fc.Workspaces)
+	}
+
+	config := &Config{
+		MaxPoints: 6,
+		Motivate:  true,
+		Reactji: &ReactjiConfig{
+			Enabled:  true,
+			Downvote: newStringList([]string{"-1"}),
+		},
+	}
+	fc.Apply(config)
+
+	if config.MaxPoints != 3 || config.ReplyType != "thread" || !config.Motivate {
+		t.Errorf("Apply: got MaxPoints %d, ReplyType %q, Motivate %v", config.MaxPoints, config.ReplyType, config.Motivate)
+	}
+	if config.Things != ThingsSeparate {
+		t.Errorf("Apply: got Things %q; want %q", config.Things, ThingsSeparate)
+	}
+	if config.DefaultRole != database.RoleReadOnly || config.Permissions[ActionNegativeKarma] != database.RoleModerator {
+		t.Errorf("Apply: got DefaultRole %q, Permissions %v", config.DefaultRole, config.Permissions)
+	}
+	if !config.UserBlacklist.Contains("here") {
+		t.Errorf("Apply: blacklist does not contain %q", "here")
+	}
+	if config.Aliases["al"] != "alice" {
+		t.Errorf("Apply: alias %q maps to %q; want %q", "al", config.Aliases["al"], "alice")
+	}
+	if !config.Reactji.Enabled || !config.Reactji.Upvote.Contains("tada") || !config.Reactji.Downvote.Contains("-1") {
+		t.Errorf("Apply: did not merge reactji config correctly: %#v", config.Reactji)
+	}
+	if policy := config.Channels["C0123"]; policy == nil || policy.Channel != "C0123" || *policy.Karma {
+		t.Errorf("Apply: did not set channel policies correctly: %#v", policy)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tt := []struct {
+		Name, Config string
+		Errors       []string
+	}{
+		{
+			Name:   "unknown option",
+			Config: "maxpionts: 3",
+			Errors: []string{"maxpionts"},
+		},
+		{
+			Name: "invalid values",
+			Config: `
+maxpoints: 0
+replytype: carrier-pigeon
+things: ignored
+defaultrole: overlord
+permissions:
+  givekarma: overlord
+aliases:
+  alice: [al]
+  albert: [al]
+channels:
+  C0123:
+    replytype: shout
+workspaces:
+  - name: sales
+`,
+			Errors: []string{
+				"maxpoints must be at least 1",
+				`replytype must be one of message, thread, ephemeral, got "carrier-pigeon"`,
+				`things must be one of mixed, separate, disabled, got "ignored"`,
+				`"al" is an alias of both`,
+				"channels: C0123: replytype",
+				"workspace #1 is missing a token",
+				`defaultrole: unknown role "overlord"`,
+				`permissions: unknown role "overlord"`,
+			},
+		},
+		{
+			Name: "audit log for members",
+			Config: `
+permissions:
+  audit: member
+`,
+			Errors: []string{"permissions: audit requires at least the moderator role"},
+		},
+	}
+
+	for _, tc := range tt {
+		path := writeConfigFile(t, tc.Config)
+		defer os.Remove(path)
+
+		_, err := LoadConfigFile(path)
+		if err == nil {
+			t.Errorf("%s: LoadConfigFile did not return an error", tc.Name)
+			continue
+		}
+
+		for _, want := range tc.Errors {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tc.Name, err, want)
+			}
+		}
+	}
+}
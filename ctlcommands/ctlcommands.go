@@ -1,14 +1,23 @@
 package ctlcommands
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"time"
-
+	"os"
+	"os/signal"
+	osuser "os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/kamaln7/karmabot"
 	"github.com/kamaln7/karmabot/database"
 	"github.com/kamaln7/karmabot/ui/webui"
+	"github.com/kamaln7/karmabot/ui/webui/auth"
 
 	"github.com/aybabtme/log"
-	"github.com/pquerna/otp/totp"
 	"github.com/urfave/cli"
 )
 
@@ -17,18 +26,47 @@ type Commands struct {
 }
 
 func (cc *Commands) Serve(c *cli.Context) error {
-	db := cc.getDB(c.String("db"))
-	TOTP := c.String("totp")
+	db := cc.getDB(c.String("db"), "")
+
+	defaultRole, err := database.ParseRole(c.String("defaultrole"))
+	if err != nil {
+		cc.Logger.Err(err).Fatal("invalid default role")
+	}
+	admins := make(karmabot.StringList)
+	for _, admin := range c.StringSlice("admin") {
+		admins.Set(admin)
+	}
 
 	ui, err := webui.New(&webui.Config{
-		ListenAddr:       c.String("listenaddr"),
-		URL:              c.String("url"),
-		FilesPath:        c.String("path"),
-		TOTP:             TOTP,
+		ListenAddr:      c.String("listenaddr"),
+		URL:             c.String("url"),
+		FilesPath:       c.String("path"),
+		Auth:            c.String("auth"),
+		SessionLifetime: c.Duration("sessionlifetime"),
+		InsecureCookies: c.Bool("insecurecookies"),
+		Theme: &webui.Theme{
+			Mode:        c.String("theme"),
+			OrgName:     c.String("orgname"),
+			Logo:        c.String("logo"),
+			AccentColor: c.String("accentcolor"),
+		},
+		Slack: &auth.OIDCConfig{
+			Issuer:       c.String("slack.issuer"),
+			ClientID:     c.String("slack.clientid"),
+			ClientSecret: c.String("slack.clientsecret"),
+		},
 		LeaderboardLimit: c.Int("leaderboardlimit"),
-		Log:              cc.Logger.KV("provider", "webui"),
-		Debug:            c.Bool("debug"),
-		DB:               db,
+		SeparateThings:   c.Bool("separatethings"),
+		Authorize: func(ctx context.Context, team, user, action string) (bool, error) {
+			return karmabot.Can(ctx, &karmabot.Config{
+				Admins:      admins,
+				DefaultRole: defaultRole,
+				DB:          db.WithTeam(team),
+			}, user, karmabot.Action(action))
+		},
+		Log:   cc.Logger.KV("provider", "webui"),
+		Debug: c.Bool("debug"),
+		DB:    db,
 	})
 
 	if err != nil {
@@ -36,32 +74,68 @@ func (cc *Commands) Serve(c *cli.Context) error {
 		return err
 	}
 
-	token, err := totp.GenerateCode(TOTP, time.Now())
-	if err != nil {
-		cc.Logger.Err(err).Fatal("could not generate totp token")
-	} else {
-		cc.Logger.KV("token", token).Info("generated totp token")
+	go func() {
+		if err := ui.Listen(); err != nil {
+			cc.Logger.Err(err).Fatal("could not start http server")
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	cc.Logger.KV("signal", sig).Info("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Duration("shutdowntimeout"))
+	defer cancel()
+
+	if err := ui.Shutdown(ctx); err != nil {
+		cc.Logger.Err(err).Error("could not shut down http server cleanly")
 	}
 
-	ui.Listen()
-	return nil
+	return db.Close()
 }
 
-func (cc *Commands) Mktotp(c *cli.Context) error {
-	TOTP := c.String("totp")
-	token, err := totp.GenerateCode(TOTP, time.Now())
-	if err != nil {
-		cc.Logger.Err(err).Fatal("could not generate token")
+// Link prints a personal login link for the web UI, for when the
+// user cannot get one from karmabot in chat.
+func (cc *Commands) Link(c *cli.Context) error {
+	var (
+		ctx  = context.Background()
+		db   = cc.getWriteDB(c.String("db"), c.String("workspace"))
+		user = c.String("user")
+		name = c.String("name")
+		URL  = strings.TrimSuffix(c.String("url"), "/")
+	)
+
+	if user == "" || URL == "" {
+		cc.Logger.Fatal("please pass a slack user ID to the `user` option and the web ui's address to the `url` option")
+	}
+	if name == "" {
+		name = user
 	}
 
-	cc.Logger.KV("token", token).Info("generated token")
+	authenticator := &auth.Authenticator{
+		Config: &auth.Config{
+			Log: cc.Logger.KV("provider", "webui"),
+			DB:  db,
+		},
+	}
+	token, err := authenticator.NewLoginToken(ctx, &auth.Identity{
+		TeamID: db.Team(),
+		UserID: user,
+		Name:   name,
+	})
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not create login link")
+	}
 
-	return nil
+	fmt.Println(webui.LoginURL(URL, c.String("uri"), token))
+	return db.Close()
 }
 
 func (cc *Commands) AddKarma(c *cli.Context) error {
 	var (
-		db     = cc.getDB(c.String("db"))
+		ctx    = context.Background()
+		db     = cc.getWriteDB(c.String("db"), c.String("workspace"))
 		from   = c.String("from")
 		to     = c.String("to")
 		reason = c.String("reason")
@@ -76,26 +150,25 @@ func (cc *Commands) AddKarma(c *cli.Context) error {
 		cc.Logger.Fatal("you may not add 0 points to a user")
 	}
 
-	record := &database.Points{
-		From:   from,
-		To:     to,
-		Reason: reason,
-		Points: points,
-	}
-
-	err := db.InsertPoints(record)
-	if err != nil {
-		cc.Logger.Err(err).Fatal("could not insert record")
+	inserted := cc.insertPoints(ctx, c, db, []string{to}, func(map[string]int) ([]*database.Points, error) {
+		return []*database.Points{{
+			From:   from,
+			To:     to,
+			Reason: reason,
+			Points: points,
+		}}, nil
+	})
+	if inserted {
+		cc.Logger.Info("inserted record")
 	}
 
-	cc.Logger.Info("inserted record")
-
 	return nil
 }
 
 func (cc *Commands) MigrateKarma(c *cli.Context) error {
 	var (
-		db   = cc.getDB(c.String("db"))
+		ctx  = context.Background()
+		db   = cc.getWriteDB(c.String("db"), c.String("workspace"))
 		from = c.String("from")
 		to   = c.String("to")
 	)
@@ -104,48 +177,46 @@ func (cc *Commands) MigrateKarma(c *cli.Context) error {
 		cc.Logger.Fatal("please pass valid users to the `to` and `from` options")
 	}
 
-	user, err := db.GetUser(from)
-	if err != nil {
+	if _, err := db.GetUser(ctx, from); err != nil {
 		cc.Logger.Err(err).KV("from", from).Fatal("could not look up user `from`")
 	}
 
-	if user.Points == 0 {
-		cc.Logger.KV("from", from).Fatal("user does not have any points")
-	}
-
+	var migrated int
 	reason := fmt.Sprintf("migrating karma from %s to %s", from, to)
-	records := []*database.Points{
-		// remove points from `from`
-		{
-			From:   "karmabot",
-			To:     from,
-			Reason: reason,
-			Points: -user.Points,
-		},
-		// add points to `to`
-		{
-			From:   "karmabot",
-			To:     to,
-			Reason: reason,
-			Points: user.Points,
-		},
-	}
-
-	for _, record := range records {
-		err := db.InsertPoints(record)
-		if err != nil {
-			cc.Logger.Err(err).Fatal("could not insert record")
+	inserted := cc.insertPoints(ctx, c, db, []string{from, to}, func(totals map[string]int) ([]*database.Points, error) {
+		migrated = totals[from]
+		if migrated == 0 {
+			return nil, errNoPoints
 		}
-	}
 
-	cc.Logger.KV("from", from).KV("to", to).KV("points", user.Points).Info("migrated karma")
+		return []*database.Points{
+			// remove points from `from`
+			{
+				From:   "karmabot",
+				To:     from,
+				Reason: reason,
+				Points: -migrated,
+			},
+			// add points to `to`
+			{
+				From:   "karmabot",
+				To:     to,
+				Reason: reason,
+				Points: migrated,
+			},
+		}, nil
+	})
+	if inserted {
+		cc.Logger.KV("from", from).KV("to", to).KV("points", migrated).Info("migrated karma")
+	}
 
 	return nil
 }
 
 func (cc *Commands) ResetKarma(c *cli.Context) error {
 	var (
-		db   = cc.getDB(c.String("db"))
+		ctx  = context.Background()
+		db   = cc.getWriteDB(c.String("db"), c.String("workspace"))
 		name = c.String("user")
 	)
 
@@ -153,30 +224,29 @@ func (cc *Commands) ResetKarma(c *cli.Context) error {
 		cc.Logger.Fatal("please pass a valid user to the `user` option")
 	}
 
-	user, err := db.GetUser(name)
-	if err != nil {
+	if _, err := db.GetUser(ctx, name); err != nil {
 		cc.Logger.Err(err).KV("user", name).Fatal("could not look up user")
 	}
 
-	err = db.InsertPoints(&database.Points{
-		From:   "karmabot",
-		To:     name,
-		Points: -1 * user.Points,
-		Reason: "karmabotctl resetting karma",
+	inserted := cc.insertPoints(ctx, c, db, []string{name}, func(totals map[string]int) ([]*database.Points, error) {
+		return []*database.Points{{
+			From:   "karmabot",
+			To:     name,
+			Points: -1 * totals[name],
+			Reason: "karmabotctl resetting karma",
+		}}, nil
 	})
-
-	if err != nil {
-		cc.Logger.Err(err).Fatal("could not insert record")
+	if inserted {
+		cc.Logger.KV("user", name).Info("reset karma")
 	}
 
-	cc.Logger.KV("user", name).Info("reset karma")
-
 	return nil
 }
 
 func (cc *Commands) SetKarma(c *cli.Context) error {
 	var (
-		db     = cc.getDB(c.String("db"))
+		ctx    = context.Background()
+		db     = cc.getWriteDB(c.String("db"), c.String("workspace"))
 		name   = c.String("user")
 		points = c.Int("points")
 	)
@@ -185,38 +255,122 @@ func (cc *Commands) SetKarma(c *cli.Context) error {
 		cc.Logger.Fatal("please pass a valid user to the `user` option")
 	}
 
-	user, err := db.GetUser(name)
-	if err != nil {
+	if _, err := db.GetUser(ctx, name); err != nil {
 		cc.Logger.Err(err).KV("user", name).Fatal("could not look up user")
 	}
 
-	err = db.InsertPoints(&database.Points{
-		From:   "karmabot",
-		To:     name,
-		Points: points - user.Points,
-		Reason: "karmabotctl overriding karma",
+	inserted := cc.insertPoints(ctx, c, db, []string{name}, func(totals map[string]int) ([]*database.Points, error) {
+		return []*database.Points{{
+			From:   "karmabot",
+			To:     name,
+			Points: points - totals[name],
+			Reason: "karmabotctl overriding karma",
+		}}, nil
 	})
+	if inserted {
+		cc.Logger.KV("user", name).KV("points", points).Info("set karma")
+	}
+
+	return nil
+}
+
+// errNoPoints is returned when migrating the karma of a user that
+// does not have any points.
+var errNoPoints = errors.New("user does not have any points")
+
+// insertPoints builds the records to insert from the current totals
+// of users, and prints them along with the totals that they result
+// in. Unless this is a dry run, it then asks for confirmation and
+// builds the records again in a single transaction with the records'
+// insertion and the audit log entries of the change, so that concurrent
+// karma operations cannot be lost and every change is audited. It
+// returns whether the records were inserted.
+func (cc *Commands) insertPoints(ctx context.Context, c *cli.Context, db *database.DB, users []string, build func(totals map[string]int) ([]*database.Points, error)) bool {
+	before := make(map[string]int)
+	for _, user := range users {
+		before[user] = cc.getPoints(ctx, db, user)
+	}
+
+	records, err := build(before)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not prepare records")
+	}
 
+	after := make(map[string]int)
+	for user, points := range before {
+		after[user] = points
+	}
+	for _, record := range records {
+		after[record.To] += record.Points
+
+		cc.Logger.
+			KV("from", record.From).
+			KV("to", record.To).
+			KV("points", record.Points).
+			KV("reason", record.Reason).
+			Info("record to insert")
+	}
+	for _, user := range users {
+		cc.Logger.KV("user", user).KV("before", before[user]).KV("after", after[user]).Info("resulting total")
+	}
+
+	if !cc.confirm(c, fmt.Sprintf("insert %d record(s)?", len(records))) {
+		return false
+	}
+
+	_, err = db.UpdatePointsAudited(ctx, users, cc.auditEntry(c), func(totals map[string]int) ([]*database.Points, error) {
+		records, err := build(totals)
+		for _, record := range records {
+			if record.Source == "" {
+				record.Source = database.SourceKarmabotctl
+			}
+		}
+
+		return records, err
+	})
 	if err != nil {
-		cc.Logger.Err(err).Fatal("could not insert record")
+		cc.Logger.Err(err).Fatal("could not insert records")
 	}
 
-	cc.Logger.KV("user", name).KV("points", points).Info("set karma")
+	return true
+}
 
-	return nil
+// confirm returns false if this is a dry run. Otherwise, it asks the
+// operator to confirm an action unless the `yes` option is passed, and
+// exits if they do not.
+func (cc *Commands) confirm(c *cli.Context, question string) bool {
+	if c.Bool("dry-run") {
+		cc.Logger.Info("dry run, not writing anything")
+		return false
+	}
+
+	if c.Bool("yes") {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		cc.Logger.Fatal("aborted")
+		return false
+	}
 }
 
 func (cc *Commands) GetThrowback(c *cli.Context) error {
 	var (
+		ctx  = context.Background()
 		user = c.String("user")
-		db   = cc.getDB(c.String("db"))
+		db   = cc.getDB(c.String("db"), c.String("workspace"))
 	)
 
 	if user == "" {
 		cc.Logger.Fatal("please pass a valid user to the `user` option")
 	}
 
-	throwback, err := db.GetThrowback(user)
+	throwback, err := db.GetThrowback(ctx, user)
 	if err != nil {
 		cc.Logger.Err(err).Fatal("could not look up user data")
 	}
@@ -225,7 +379,9 @@ func (cc *Commands) GetThrowback(c *cli.Context) error {
 	return nil
 }
 
-func (cc *Commands) getDB(path string) *database.DB {
+// getDB opens the database and scopes it to a workspace,
+// if one is passed.
+func (cc *Commands) getDB(path, workspace string) *database.DB {
 	db, err := database.New(&database.Config{
 		Path: path,
 	})
@@ -234,5 +390,382 @@ func (cc *Commands) getDB(path string) *database.DB {
 		cc.Logger.KV("path", path).Err(err).Fatal("could not open sqlite db")
 	}
 
-	return db
+	return db.WithTeam(workspace)
+}
+
+// getWriteDB opens the database for a command that records karma.
+// Karma always belongs to a workspace, so without the workspace
+// option it is recorded for the only workspace that the database
+// knows, and the option is required if it knows several.
+func (cc *Commands) getWriteDB(path, workspace string) *database.DB {
+	db := cc.getDB(path, workspace)
+	if workspace != "" {
+		return db
+	}
+
+	team, err := cc.defaultWorkspace(context.Background(), db)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("please pass the ID of a workspace to the `workspace` option")
+	}
+
+	return db.WithTeam(team)
+}
+
+// defaultWorkspace returns the workspace that karma is recorded for if
+// no workspace is given. Databases that karmabot has not connected to a
+// workspace yet have none, and karmabot claims their karma when it
+// starts. It returns an error if the database knows several workspaces.
+func (cc *Commands) defaultWorkspace(ctx context.Context, db *database.DB) (string, error) {
+	workspaces, err := db.GetWorkspaces(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(workspaces) {
+	case 0:
+		return "", nil
+	case 1:
+		return workspaces[0].ID, nil
+	default:
+		return "", fmt.Errorf("the database has %d workspaces", len(workspaces))
+	}
+}
+
+func (cc *Commands) SetChannelPolicy(c *cli.Context) error {
+	var (
+		ctx     = context.Background()
+		db      = cc.getDB(c.String("db"), c.String("workspace"))
+		channel = c.String("channel")
+	)
+
+	if channel == "" {
+		cc.Logger.Fatal("please pass a valid channel ID to the `channel` option")
+	}
+
+	// only override the options that were passed
+	policy, err := db.GetChannelPolicy(ctx, channel)
+	switch {
+	case err == database.ErrNoSuchChannelPolicy, err == nil && policy.Team != db.Team():
+		policy = &database.ChannelPolicy{
+			Channel: channel,
+		}
+	case err != nil:
+		cc.Logger.Err(err).KV("channel", channel).Fatal("could not look up channel policy")
+	}
+
+	if c.IsSet("replytype") {
+		replyType := c.String("replytype")
+		policy.ReplyType = &replyType
+	}
+	if c.IsSet("maxpoints") {
+		maxPoints := c.Int("maxpoints")
+		policy.MaxPoints = &maxPoints
+	}
+	if c.IsSet("karma") {
+		policy.Karma = cc.parseBool("karma", c.String("karma"))
+	}
+	if c.IsSet("reactji") {
+		policy.Reactji = cc.parseBool("reactji", c.String("reactji"))
+	}
+	if c.IsSet("upvote") {
+		policy.Upvote = c.StringSlice("upvote")
+	}
+	if c.IsSet("downvote") {
+		policy.Downvote = c.StringSlice("downvote")
+	}
+
+	cc.Logger.KV("channel", channel).KV("policy", policy).Info("channel policy to save")
+	if !cc.confirm(c, fmt.Sprintf("save the policy for %s?", channel)) {
+		return nil
+	}
+
+	err = db.SetChannelPolicy(ctx, policy)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not save channel policy")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("channel", channel).KV("policy", policy).Info("saved channel policy")
+
+	return nil
+}
+
+func (cc *Commands) DeleteChannelPolicy(c *cli.Context) error {
+	var (
+		ctx     = context.Background()
+		db      = cc.getDB(c.String("db"), c.String("workspace"))
+		channel = c.String("channel")
+	)
+
+	if channel == "" {
+		cc.Logger.Fatal("please pass a valid channel ID to the `channel` option")
+	}
+
+	policy, err := db.GetChannelPolicy(ctx, channel)
+	switch {
+	case err == database.ErrNoSuchChannelPolicy, err == nil && policy.Team != db.Team():
+		cc.Logger.KV("channel", channel).Fatal("channel does not have a policy")
+	case err != nil:
+		cc.Logger.Err(err).KV("channel", channel).Fatal("could not look up channel policy")
+	}
+
+	cc.Logger.KV("channel", channel).KV("policy", policy).Info("channel policy to delete")
+	if !cc.confirm(c, fmt.Sprintf("delete the policy for %s?", channel)) {
+		return nil
+	}
+
+	err = db.DeleteChannelPolicy(ctx, channel)
+	if err != nil {
+		cc.Logger.Err(err).KV("channel", channel).Fatal("could not delete channel policy")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("channel", channel).Info("deleted channel policy")
+
+	return nil
+}
+
+func (cc *Commands) ListChannelPolicies(c *cli.Context) error {
+	var (
+		ctx = context.Background()
+		db  = cc.getDB(c.String("db"), c.String("workspace"))
+	)
+
+	policies, err := db.GetChannelPolicies(ctx)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not list channel policies")
+	}
+
+	for _, policy := range policies {
+		cc.Logger.KV("workspace", policy.Team).KV("channel", policy.Channel).KV("policy", policy).Info("channel policy")
+	}
+
+	return nil
+}
+
+func (cc *Commands) parseBool(option, value string) *bool {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		cc.Logger.Err(err).KV("option", option).Fatal("please pass true or false")
+	}
+
+	return &b
+}
+
+func (cc *Commands) SetRole(c *cli.Context) error {
+	var (
+		ctx  = context.Background()
+		db   = cc.getDB(c.String("db"), c.String("workspace"))
+		user = c.String("user")
+	)
+
+	if db.Team() == "" {
+		cc.Logger.Fatal("please pass the ID of the user's workspace to the `workspace` option")
+	}
+	if user == "" {
+		cc.Logger.Fatal("please pass a valid Slack user ID to the `user` option")
+	}
+
+	role, err := database.ParseRole(c.String("role"))
+	if err != nil {
+		cc.Logger.Err(err).Fatal("please pass read-only, member, moderator or admin to the `role` option")
+	}
+
+	cc.Logger.KV("user", user).KV("role", role).Info("role to assign")
+	if !cc.confirm(c, fmt.Sprintf("make %s a %s?", user, role)) {
+		return nil
+	}
+
+	err = db.SetRole(ctx, user, role)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not save role")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("user", user).KV("role", role).Info("saved role")
+
+	return nil
+}
+
+func (cc *Commands) DeleteRole(c *cli.Context) error {
+	var (
+		ctx  = context.Background()
+		db   = cc.getDB(c.String("db"), c.String("workspace"))
+		user = c.String("user")
+	)
+
+	if db.Team() == "" {
+		cc.Logger.Fatal("please pass the ID of the user's workspace to the `workspace` option")
+	}
+	if user == "" {
+		cc.Logger.Fatal("please pass a valid Slack user ID to the `user` option")
+	}
+
+	role, err := db.GetRole(ctx, user)
+	if err != nil {
+		cc.Logger.Err(err).KV("user", user).Fatal("could not look up role")
+	}
+
+	cc.Logger.KV("user", user).KV("role", role).Info("role to remove")
+	if !cc.confirm(c, fmt.Sprintf("remove the %s role of %s?", role, user)) {
+		return nil
+	}
+
+	err = db.DeleteRole(ctx, user)
+	if err != nil {
+		cc.Logger.Err(err).KV("user", user).Fatal("could not delete role")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("user", user).Info("deleted role")
+
+	return nil
+}
+
+func (cc *Commands) ListRoles(c *cli.Context) error {
+	var (
+		ctx = context.Background()
+		db  = cc.getDB(c.String("db"), c.String("workspace"))
+	)
+
+	roles, err := db.GetRoles(ctx)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not list roles")
+	}
+
+	for _, role := range roles {
+		cc.Logger.KV("workspace", role.Team).KV("user", role.User).KV("role", role.Role).Info("role")
+	}
+
+	return nil
+}
+
+func (cc *Commands) SetKind(c *cli.Context) error {
+	var (
+		ctx  = context.Background()
+		db   = cc.getDB(c.String("db"), c.String("workspace"))
+		user = strings.ToLower(c.String("user"))
+	)
+
+	if db.Team() == "" {
+		cc.Logger.Fatal("please pass the ID of the user's workspace to the `workspace` option")
+	}
+	if user == "" {
+		cc.Logger.Fatal("please pass a valid user to the `user` option")
+	}
+
+	kind, err := database.ParseKind(c.String("kind"))
+	if err != nil {
+		cc.Logger.Err(err).Fatal("please pass person or thing to the `kind` option")
+	}
+
+	cc.Logger.KV("user", user).KV("kind", kind).Info("kind to set")
+	if !cc.confirm(c, fmt.Sprintf("make %s a %s?", user, kind)) {
+		return nil
+	}
+
+	err = db.SetKind(ctx, user, kind)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not save kind")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("user", user).KV("kind", kind).Info("saved kind")
+
+	return nil
+}
+
+// getPoints returns a user's total points, or 0 if
+// they have not received any karma yet.
+func (cc *Commands) getPoints(ctx context.Context, db *database.DB, name string) int {
+	user, err := db.GetUser(ctx, name)
+	switch err {
+	case nil:
+		return user.Points
+	case database.ErrNoSuchUser:
+		return 0
+	default:
+		cc.Logger.Err(err).KV("user", name).Fatal("could not look up user")
+		return 0
+	}
+}
+
+// auditAction records an action that does not change anyone's karma
+// in the audit log. Changes to karma are recorded by insertPoints.
+// The command fails if the action can not be recorded.
+func (cc *Commands) auditAction(ctx context.Context, c *cli.Context, db *database.DB) {
+	entry := cc.auditEntry(c)
+
+	err := db.InsertAuditEntry(ctx, entry)
+	if err != nil {
+		cc.Logger.Err(err).KV("command", entry.Command).Fatal("could not record action in the audit log")
+	}
+}
+
+func (cc *Commands) auditEntry(c *cli.Context) *database.AuditEntry {
+	entry := &database.AuditEntry{
+		Actor:   "unknown",
+		Source:  "unknown",
+		Command: c.Command.FullName(),
+	}
+
+	if u, err := osuser.Current(); err == nil {
+		entry.Actor = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		entry.Source = hostname
+	}
+
+	// record the options that were passed, except for the database
+	// path and workspace which are implied, and the confirmation options
+	for _, name := range c.FlagNames() {
+		switch name {
+		case "db", "workspace", "dry-run", "yes":
+			continue
+		}
+		if !c.IsSet(name) {
+			continue
+		}
+
+		entry.Args = append(entry.Args, fmt.Sprintf("--%s=%s", name, c.String(name)))
+	}
+
+	return entry
+}
+
+func (cc *Commands) ListAuditLog(c *cli.Context) error {
+	var (
+		ctx = context.Background()
+		db  = cc.getDB(c.String("db"), c.String("workspace"))
+	)
+
+	entries, err := db.GetAuditLog(ctx, &database.AuditQuery{
+		Actor: c.String("actor"),
+		User:  c.String("user"),
+		Limit: c.Int("limit"),
+	})
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not list the audit log")
+	}
+
+	for _, entry := range entries {
+		l := cc.Logger.
+			KV("id", entry.ID).
+			KV("timestamp", entry.Timestamp).
+			KV("workspace", entry.Team).
+			KV("actor", entry.Actor).
+			KV("source", entry.Source).
+			KV("command", entry.Command).
+			KV("args", entry.Args)
+		if entry.User != "" {
+			l = l.KV("user", entry.User)
+		}
+		if entry.Before != nil && entry.After != nil {
+			l = l.KV("before", *entry.Before).KV("after", *entry.After)
+		}
+
+		l.Info("audit entry")
+	}
+
+	return nil
 }
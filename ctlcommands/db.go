@@ -0,0 +1,123 @@
+package ctlcommands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/urfave/cli"
+)
+
+func (cc *Commands) Backup(c *cli.Context) error {
+	var (
+		ctx    = context.Background()
+		db     = cc.getDB(c.String("db"), "")
+		output = c.String("output")
+	)
+
+	if output == "" {
+		cc.Logger.Fatal("please pass the path of the backup to the `output` option")
+	}
+
+	err := db.Backup(ctx, output)
+	if err != nil {
+		cc.Logger.Err(err).KV("output", output).Fatal("could not back up the database")
+	}
+
+	cc.Logger.KV("output", output).Info("backed up the database")
+
+	return db.Close()
+}
+
+func (cc *Commands) Restore(c *cli.Context) error {
+	var (
+		ctx   = context.Background()
+		path  = c.String("db")
+		input = c.String("input")
+	)
+
+	if input == "" {
+		cc.Logger.Fatal("please pass the path of the backup to the `input` option")
+	}
+
+	cc.Logger.KV("input", input).KV("db", path).Info("database to restore")
+	if !cc.confirm(c, fmt.Sprintf("replace %s with %s? karmabot should not be running", path, input)) {
+		return nil
+	}
+
+	err := database.Restore(ctx, input, path)
+	if err != nil {
+		cc.Logger.Err(err).KV("input", input).Fatal("could not restore the database")
+	}
+
+	// open the restored database to upgrade its schema if needed
+	db := cc.getDB(path, "")
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("input", input).KV("db", path).Info("restored the database")
+
+	return db.Close()
+}
+
+func (cc *Commands) Compact(c *cli.Context) error {
+	var (
+		ctx     = context.Background()
+		db      = cc.getDB(c.String("db"), c.String("workspace"))
+		before  = cc.parseDate("before", c.String("before"))
+		archive = c.String("archive")
+	)
+
+	if before.IsZero() {
+		cc.Logger.Fatal("please pass a date to the `before` option")
+	}
+
+	stats, err := db.CompactionStats(ctx, before)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not inspect the database")
+	}
+
+	cc.Logger.KV("rows", stats.Rows).KV("summaries", stats.Summaries).Info("rows to compact")
+	if stats.Rows == 0 {
+		return nil
+	}
+	if !cc.confirm(c, fmt.Sprintf("replace %d row(s) with %d summary row(s)?", stats.Rows, stats.Summaries)) {
+		return nil
+	}
+
+	stats, err = db.Compact(ctx, before, archive)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not compact the database")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("rows", stats.Rows).KV("summaries", stats.Summaries).KV("archive", archive).Info("compacted the database")
+
+	return db.Close()
+}
+
+func (cc *Commands) RebuildTotals(c *cli.Context) error {
+	var (
+		ctx = context.Background()
+		db  = cc.getDB(c.String("db"), "")
+	)
+
+	outOfSync, err := db.TotalsOutOfSync(ctx)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not inspect the karma totals")
+	}
+
+	cc.Logger.KV("outofsync", outOfSync).Info("users whose totals are out of sync")
+	if !cc.confirm(c, fmt.Sprintf("rebuild the totals of all users (%d out of sync)?", outOfSync)) {
+		return nil
+	}
+
+	fixed, err := db.RebuildTotals(ctx)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not rebuild the karma totals")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("outofsync", fixed).Info("rebuilt the karma totals")
+
+	return db.Close()
+}
@@ -0,0 +1,82 @@
+package ctlcommands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/urfave/cli"
+)
+
+func (cc *Commands) SetDecay(c *cli.Context) error {
+	var (
+		ctx   = context.Background()
+		db    = cc.getDB(c.String("db"), c.String("workspace"))
+		decay = &database.Decay{
+			Team:   db.Team(),
+			Model:  database.DecayModel(c.String("model")),
+			Months: c.Float64("months"),
+		}
+	)
+
+	err := decay.Validate()
+	if err != nil {
+		cc.Logger.Err(err).Fatal("please pass exponential or linear to the `model` option and a positive number of months to the `months` option")
+	}
+
+	cc.Logger.KV("workspace", decay.Team).KV("model", decay.Model).KV("months", decay.Months).Info("decay to configure")
+	if !cc.confirm(c, fmt.Sprintf("apply %s karma decay over %v month(s)?", decay.Model, decay.Months)) {
+		return nil
+	}
+
+	err = db.SetDecay(ctx, decay)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not save decay")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("workspace", decay.Team).Info("saved decay")
+
+	return db.Close()
+}
+
+func (cc *Commands) DeleteDecay(c *cli.Context) error {
+	var (
+		ctx = context.Background()
+		db  = cc.getDB(c.String("db"), c.String("workspace"))
+	)
+
+	cc.Logger.KV("workspace", db.Team()).Info("decay to remove")
+	if !cc.confirm(c, "turn karma decay off?") {
+		return nil
+	}
+
+	err := db.DeleteDecay(ctx)
+	if err != nil {
+		cc.Logger.Err(err).KV("workspace", db.Team()).Fatal("could not delete decay")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("workspace", db.Team()).Info("deleted decay")
+
+	return db.Close()
+}
+
+func (cc *Commands) ListDecay(c *cli.Context) error {
+	var (
+		ctx = context.Background()
+		db  = cc.getDB(c.String("db"), c.String("workspace"))
+	)
+
+	decays, err := db.GetDecays(ctx)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not list decay")
+	}
+
+	for _, decay := range decays {
+		cc.Logger.KV("workspace", decay.Team).KV("model", decay.Model).KV("months", decay.Months).Info("decay")
+	}
+
+	return db.Close()
+}
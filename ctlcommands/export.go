@@ -0,0 +1,214 @@
+package ctlcommands
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/urfave/cli"
+)
+
+// dateFormat is the format of the `since` and `until` options.
+const dateFormat = "2006-01-02"
+
+// A recordWriter writes karma records in an export format.
+type recordWriter interface {
+	Write(record *database.Record) error
+
+	// Close writes anything that is left over. It does
+	// not close the underlying writer.
+	Close() error
+}
+
+// exportFormats maps format names to recordWriter constructors.
+var exportFormats = map[string]func(w io.Writer) recordWriter{
+	"csv":    newCSVWriter,
+	"json":   newJSONWriter,
+	"ndjson": newNDJSONWriter,
+}
+
+// csvHeader lists the columns of CSV exports.
+var csvHeader = []string{"id", "workspace", "timestamp", "from", "to", "points", "reason", "source"}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer) recordWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) Write(record *database.Record) error {
+	if !cw.headerWritten {
+		err := cw.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+		cw.headerWritten = true
+	}
+
+	return cw.w.Write([]string{
+		strconv.FormatInt(record.ID, 10),
+		record.Team,
+		record.Timestamp.Format(time.RFC3339),
+		record.From,
+		record.To,
+		strconv.Itoa(record.Points),
+		record.Reason,
+		record.Source,
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	if !cw.headerWritten {
+		err := cw.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonWriter writes a JSON array one element at a time.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONWriter(w io.Writer) recordWriter {
+	return &jsonWriter{w: w}
+}
+
+func (jw *jsonWriter) Write(record *database.Record) error {
+	sep := ",\n"
+	if jw.count == 0 {
+		sep = "[\n"
+	}
+	jw.count++
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(jw.w, "%s%s", sep, data)
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	end := "\n]\n"
+	if jw.count == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) recordWriter {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+func (nw *ndjsonWriter) Write(record *database.Record) error {
+	return nw.enc.Encode(record)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+func (cc *Commands) Export(c *cli.Context) error {
+	var (
+		ctx    = context.Background()
+		db     = cc.getDB(c.String("db"), c.String("workspace"))
+		format = c.String("format")
+		output = c.String("output")
+	)
+
+	newWriter, ok := exportFormats[format]
+	if !ok {
+		cc.Logger.KV("format", format).Fatal("please pass csv, json or ndjson to the `format` option")
+	}
+
+	query := &database.RecordQuery{
+		From:   c.String("giver"),
+		To:     c.String("user"),
+		Source: c.String("source"),
+		Since:  cc.parseDate("since", c.String("since")),
+		Until:  cc.parseDate("until", c.String("until")),
+	}
+	// until is inclusive
+	if !query.Until.IsZero() {
+		query.Until = query.Until.AddDate(0, 0, 1)
+	}
+
+	var (
+		w io.Writer = os.Stdout
+		f *os.File
+	)
+	if output != "" && output != "-" {
+		var err error
+		f, err = os.Create(output)
+		if err != nil {
+			cc.Logger.Err(err).KV("output", output).Fatal("could not create output file")
+		}
+
+		w = f
+	}
+
+	rw := newWriter(w)
+	count := 0
+	err := db.WalkRecords(ctx, query, func(record *database.Record) error {
+		count++
+		return rw.Write(record)
+	})
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not export records")
+	}
+
+	err = rw.Close()
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not export records")
+	}
+
+	// the file may only be written when it is closed
+	if f != nil {
+		err = f.Close()
+		if err != nil {
+			cc.Logger.Err(err).KV("output", output).Fatal("could not write output file")
+		}
+	}
+
+	cc.Logger.KV("records", count).KV("format", format).Info("exported records")
+
+	return nil
+}
+
+// parseDate parses a YYYY-MM-DD date in UTC. An empty
+// value results in the zero time.
+func (cc *Commands) parseDate(option, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(dateFormat, value)
+	if err != nil {
+		cc.Logger.Err(err).KV("option", option).Fatal("please pass a date in the YYYY-MM-DD format")
+	}
+
+	return t
+}
@@ -0,0 +1,83 @@
+package ctlcommands
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+var testRecords = []*database.Record{
+	{ID: 1, Team: "T1", Timestamp: time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC), From: "alice", To: "bob", Points: 2, Reason: "for the \"demo\", thanks", Source: database.SourceMessage},
+	{ID: 2, Team: "T1", Timestamp: time.Date(2019, 5, 2, 8, 30, 0, 0, time.UTC), From: "bob", To: "alice", Points: -1, Source: database.SourceReactji},
+}
+
+func TestExportFormats(t *testing.T) {
+	tt := []struct {
+		Format       string
+		Records      []*database.Record
+		ExpectOutput string
+	}{
+		{
+			Format: "csv",
+			ExpectOutput: `id,workspace,timestamp,from,to,points,reason,source
+1,T1,2019-05-01T12:00:00Z,alice,bob,2,"for the ""demo"", thanks",message
+2,T1,2019-05-02T08:30:00Z,bob,alice,-1,,reactji
+`,
+		},
+		{
+			Format: "json",
+			ExpectOutput: `[
+{"id":1,"workspace":"T1","timestamp":"2019-05-01T12:00:00Z","from":"alice","to":"bob","points":2,"reason":"for the \"demo\", thanks","source":"message"},
+{"id":2,"workspace":"T1","timestamp":"2019-05-02T08:30:00Z","from":"bob","to":"alice","points":-1,"reason":"","source":"reactji"}
+]
+`,
+		},
+		{
+			Format: "ndjson",
+			ExpectOutput: `{"id":1,"workspace":"T1","timestamp":"2019-05-01T12:00:00Z","from":"alice","to":"bob","points":2,"reason":"for the \"demo\", thanks","source":"message"}
+{"id":2,"workspace":"T1","timestamp":"2019-05-02T08:30:00Z","from":"bob","to":"alice","points":-1,"reason":"","source":"reactji"}
+`,
+		},
+		{
+			Format:       "csv",
+			Records:      []*database.Record{},
+			ExpectOutput: "id,workspace,timestamp,from,to,points,reason,source\n",
+		},
+		{
+			Format:       "json",
+			Records:      []*database.Record{},
+			ExpectOutput: "[]\n",
+		},
+		{
+			Format:       "ndjson",
+			Records:      []*database.Record{},
+			ExpectOutput: "",
+		},
+	}
+
+	for _, tc := range tt {
+		records := tc.Records
+		if records == nil {
+			records = testRecords
+		}
+
+		var b strings.Builder
+		w := exportFormats[tc.Format](&b)
+		for _, record := range records {
+			err := w.Write(record)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.Format, err)
+			}
+		}
+		err := w.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Format, err)
+		}
+
+		if got := b.String(); got != tc.ExpectOutput {
+			t.Errorf("%s with %d records: got\n%s\nwant\n%s", tc.Format, len(records), got, tc.ExpectOutput)
+		}
+	}
+}
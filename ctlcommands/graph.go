@@ -0,0 +1,86 @@
+package ctlcommands
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/kamaln7/karmabot/graph"
+
+	"github.com/urfave/cli"
+)
+
+// graphFormats maps the names of graph export formats
+// to the functions that write them.
+var graphFormats = map[string]func(*graph.Graph, io.Writer) error{
+	"graphml": (*graph.Graph).WriteGraphML,
+	"dot":     (*graph.Graph).WriteDOT,
+}
+
+func (cc *Commands) ExportGraph(c *cli.Context) error {
+	var (
+		ctx    = context.Background()
+		db     = cc.getDB(c.String("db"), c.String("workspace"))
+		format = c.String("format")
+		output = c.String("output")
+		since  = cc.parseDate("since", c.String("since"))
+		until  = cc.parseDate("until", c.String("until"))
+	)
+
+	write, ok := graphFormats[format]
+	if !ok {
+		cc.Logger.KV("format", format).Fatal("please pass graphml or dot to the `format` option")
+	}
+
+	// until is inclusive
+	if !until.IsZero() {
+		until = until.AddDate(0, 0, 1)
+	}
+
+	edges, err := db.GetEdges(ctx, since, until)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not look up karma")
+	}
+
+	users, err := db.GetUserNames(ctx)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not look up users")
+	}
+
+	var (
+		w io.Writer = os.Stdout
+		f *os.File
+	)
+	if output != "" && output != "-" {
+		f, err = os.Create(output)
+		if err != nil {
+			cc.Logger.Err(err).KV("output", output).Fatal("could not create output file")
+		}
+
+		w = f
+	}
+
+	g := graph.New(edges, users)
+	err = write(g, w)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not export graph")
+	}
+
+	// the file may only be written when it is closed
+	if f != nil {
+		err = f.Close()
+		if err != nil {
+			cc.Logger.Err(err).KV("output", output).Fatal("could not write output file")
+		}
+	}
+
+	cc.Logger.
+		KV("nodes", len(g.Nodes)).
+		KV("edges", len(g.Edges)).
+		KV("reciprocity", g.Stats.Reciprocity).
+		KV("isolated", len(g.Stats.Isolated)).
+		KV("format", format).
+		Info("exported graph")
+
+	return nil
+}
@@ -0,0 +1,427 @@
+package ctlcommands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/urfave/cli"
+)
+
+// An importer reads karma from another bot's data. New formats can be
+// supported by adding an importer to the importers map.
+type importer interface {
+	// Import reads records from r and calls fn for each of them.
+	// Records should have an ImportID that is stable across imports
+	// of the same data, so that re-importing it has no effect.
+	Import(r io.Reader, fn func(*database.Record) error) error
+}
+
+// A totalsImporter is an importer whose records' Points are running
+// totals, such as scores, rather than karma operations. Their
+// ImportIDs identify the total, and importing newer data only imports
+// the difference to the totals that were imported before.
+type totalsImporter interface {
+	importer
+	importsTotals()
+}
+
+// importers maps the names of import formats to their importers.
+var importers = map[string]importer{
+	"hubot-plusplus": hubotPlusPlusImporter{},
+	"csv":            csvImporter{},
+	"karmabot":       karmabotImporter{},
+}
+
+// hubotPlusPlusImporter imports a hubot brain that is dumped from redis
+// as JSON. hubot-plusplus only stores each user's score and the points
+// per reason, so every reason becomes a record, and the rest of the
+// score becomes a record without a reason. The records are totals, so
+// that a newer dump can be imported on top of an older one.
+type hubotPlusPlusImporter struct{}
+
+func (hubotPlusPlusImporter) importsTotals() {}
+
+type hubotPlusPlusData struct {
+	Scores  map[string]int            `json:"scores"`
+	Reasons map[string]map[string]int `json:"reasons"`
+}
+
+func (hubotPlusPlusImporter) Import(r io.Reader, fn func(*database.Record) error) error {
+	// the dump is either the whole brain or just the plusPlus key
+	var brain struct {
+		PlusPlus *hubotPlusPlusData `json:"plusPlus"`
+		hubotPlusPlusData
+	}
+	err := json.NewDecoder(r).Decode(&brain)
+	if err != nil {
+		return err
+	}
+
+	data := &brain.hubotPlusPlusData
+	if brain.PlusPlus != nil {
+		data = brain.PlusPlus
+	}
+	if data.Scores == nil {
+		return fmt.Errorf("could not find any hubot-plusplus scores")
+	}
+
+	users := make([]string, 0, len(data.Scores))
+	for user := range data.Scores {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	for _, user := range users {
+		rest := data.Scores[user]
+
+		reasons := make([]string, 0, len(data.Reasons[user]))
+		for reason := range data.Reasons[user] {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+
+		for _, reason := range reasons {
+			points := data.Reasons[user][reason]
+			if points == 0 {
+				continue
+			}
+			rest -= points
+
+			err := fn(&database.Record{
+				From:     "hubot-plusplus",
+				To:       user,
+				Points:   points,
+				Reason:   reason,
+				ImportID: fmt.Sprintf("hubot-plusplus:%s:%s", user, reason),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if rest == 0 {
+			continue
+		}
+
+		err := fn(&database.Record{
+			From:     "hubot-plusplus",
+			To:       user,
+			Points:   rest,
+			ImportID: fmt.Sprintf("hubot-plusplus:%s", user),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// csvImporter imports CSV files with a header row. The from, to and
+// points columns are required, and the reason, timestamp, workspace
+// and id columns are optional. Rows without an id are identified by
+// their contents.
+type csvImporter struct{}
+
+func (csvImporter) Import(r io.Reader, fn func(*database.Record) error) error {
+	return readCSV(r, "csv", fn)
+}
+
+// karmabotImporter imports the output of `karmabotctl export`
+// in any of its formats.
+type karmabotImporter struct{}
+
+func (karmabotImporter) Import(r io.Reader, fn func(*database.Record) error) error {
+	br := bufio.NewReader(r)
+
+	// skip leading whitespace to find out which format the export uses
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			break
+		}
+		br.ReadByte()
+	}
+
+	b, _ := br.Peek(1)
+	switch b[0] {
+	case '[', '{':
+		// a JSON array or NDJSON
+		dec := json.NewDecoder(br)
+		if b[0] == '[' {
+			_, err := dec.Token()
+			if err != nil {
+				return err
+			}
+		}
+
+		for dec.More() {
+			record := &database.Record{}
+			err := dec.Decode(record)
+			if err != nil {
+				return err
+			}
+
+			record.ImportID = fmt.Sprintf("karmabot:%s:%d", record.Team, record.ID)
+			err = fn(record)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return readCSV(br, "karmabot", fn)
+	}
+}
+
+// readCSV reads records from a CSV file with a header row.
+func readCSV(r io.Reader, format string, fn func(*database.Record) error) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"from", "to", "points"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("the CSV file does not have a %q column", name)
+		}
+	}
+
+	// seen counts identical rows, so that repeated rows in a
+	// file are all imported but a repeated import is not
+	seen := make(map[string]int)
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		points, err := strconv.Atoi(get("points"))
+		if err != nil {
+			return fmt.Errorf("line %d: invalid points %q", line, get("points"))
+		}
+
+		record := &database.Record{
+			Team:   get("workspace"),
+			From:   get("from"),
+			To:     get("to"),
+			Points: points,
+			Reason: get("reason"),
+			Source: get("source"),
+		}
+
+		if timestamp := get("timestamp"); timestamp != "" {
+			record.Timestamp, err = parseTimestamp(timestamp)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+		}
+
+		if id := get("id"); id != "" {
+			record.ImportID = fmt.Sprintf("%s:%s:%s", format, record.Team, id)
+		} else {
+			hash := sha1.Sum([]byte(strings.Join(row, "\x00")))
+			key := hex.EncodeToString(hash[:])
+			seen[key]++
+			record.ImportID = fmt.Sprintf("%s:%s:%d", format, key, seen[key])
+		}
+
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// timestampFormats are the timestamp formats that CSV imports accept.
+var timestampFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	dateFormat,
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	for _, format := range timestampFormats {
+		t, err := time.Parse(format, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+func (cc *Commands) Import(c *cli.Context) error {
+	var (
+		ctx    = context.Background()
+		db     = cc.getDB(c.String("db"), c.String("workspace"))
+		format = c.String("format")
+		input  = c.String("input")
+	)
+
+	imp, ok := importers[format]
+	if !ok {
+		names := make([]string, 0, len(importers))
+		for name := range importers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		cc.Logger.KV("format", format).KV("formats", names).Fatal("please pass a supported format to the `format` option")
+	}
+
+	aliases := cc.parseAliases(c.StringSlice("alias"))
+
+	var r io.Reader = os.Stdin
+	if input != "" && input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			cc.Logger.Err(err).KV("input", input).Fatal("could not open input file")
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	var (
+		records     []*database.Record
+		defaultTeam *string
+	)
+	err := imp.Import(r, func(record *database.Record) error {
+		// the workspace option takes precedence over the data
+		if db.Team() != "" {
+			record.Team = db.Team()
+		}
+		if record.Team == "" {
+			if defaultTeam == nil {
+				team, err := cc.defaultWorkspace(ctx, db)
+				if err != nil {
+					return fmt.Errorf("%v, please pass the ID of a workspace to the `workspace` option", err)
+				}
+				defaultTeam = &team
+			}
+			record.Team = *defaultTeam
+		}
+
+		var err error
+		teamDB := db.WithTeam(record.Team)
+		record.From, err = cc.mapUser(ctx, teamDB, aliases, record.From)
+		if err != nil {
+			return err
+		}
+		record.To, err = cc.mapUser(ctx, teamDB, aliases, record.To)
+		if err != nil {
+			return err
+		}
+		if record.Source == "" {
+			record.Source = database.SourceImport
+		}
+
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		cc.Logger.Err(err).KV("format", format).Fatal("could not read the data to import")
+	}
+
+	points := 0
+	for _, record := range records {
+		points += record.Points
+	}
+	cc.Logger.KV("records", len(records)).KV("points", points).Info("records to import")
+
+	if !cc.confirm(c, fmt.Sprintf("import %d record(s)?", len(records))) {
+		return nil
+	}
+
+	importRecords := db.ImportRecords
+	if _, ok := imp.(totalsImporter); ok {
+		importRecords = db.ImportTotals
+	}
+
+	inserted, err := importRecords(ctx, records)
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not import records")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("inserted", inserted).KV("skipped", len(records)-inserted).Info("imported records")
+
+	return nil
+}
+
+// parseAliases parses `main++alias1++alias2` options into
+// a map of alias -> main name.
+func (cc *Commands) parseAliases(options []string) map[string]string {
+	aliases := make(map[string]string)
+	for _, option := range options {
+		users := strings.Split(option, "++")
+		if len(users) <= 1 {
+			cc.Logger.KV("alias", option).Fatal("please pass aliases in the main++alias1++alias2 format")
+		}
+
+		for _, alias := range users[1:] {
+			aliases[strings.ToLower(alias)] = strings.ToLower(users[0])
+		}
+	}
+
+	return aliases
+}
+
+// mapUser lowercases an imported name and resolves it through the
+// passed aliases and the aliases that are stored in the database.
+func (cc *Commands) mapUser(ctx context.Context, db *database.DB, aliases map[string]string, name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if main, ok := aliases[name]; ok {
+		return main, nil
+	}
+
+	main, err := db.GetAlias(ctx, name)
+	switch err {
+	case nil:
+		return main, nil
+	case database.ErrNoSuchAlias:
+		return name, nil
+	default:
+		return "", err
+	}
+}
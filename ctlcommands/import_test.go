@@ -0,0 +1,162 @@
+package ctlcommands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+// importAll returns all records that an importer reads from data.
+func importAll(t *testing.T, format, data string) []*database.Record {
+	t.Helper()
+
+	var records []*database.Record
+	err := importers[format].Import(strings.NewReader(data), func(record *database.Record) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", format, err)
+	}
+
+	return records
+}
+
+func importIDs(records []*database.Record) []string {
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.ImportID
+	}
+
+	return ids
+}
+
+func TestImportIDs(t *testing.T) {
+	const data = `from,to,points
+alice,bob,1
+alice,bob,1
+alice,carol,1
+`
+
+	first, second := importAll(t, "csv", data), importAll(t, "csv", data)
+	if len(first) != 3 {
+		t.Fatalf("got %d records; want 3", len(first))
+	}
+
+	ids := importIDs(first)
+	if ids[0] == ids[1] {
+		t.Errorf("identical rows got the same import ID %q", ids[0])
+	}
+	if !reflect.DeepEqual(ids, importIDs(second)) {
+		t.Errorf("got import IDs %v and then %v", ids, importIDs(second))
+	}
+}
+
+func TestImportKarmabotExport(t *testing.T) {
+	for format, newWriter := range exportFormats {
+		var b strings.Builder
+		w := newWriter(&b)
+		for _, record := range testRecords {
+			err := w.Write(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		records := importAll(t, "karmabot", b.String())
+		if len(records) != len(testRecords) {
+			t.Fatalf("%s: got %d records; want %d", format, len(records), len(testRecords))
+		}
+
+		for i, record := range records {
+			// IDs only identify the record, the database assigns new ones
+			got, want := *record, *testRecords[i]
+			got.ID = want.ID
+			want.ImportID = fmt.Sprintf("karmabot:%s:%d", want.Team, want.ID)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got %+v; want %+v", format, got, want)
+			}
+		}
+	}
+}
+
+func TestImportHubotPlusPlus(t *testing.T) {
+	records := importAll(t, "hubot-plusplus", `{"plusPlus": {"scores": {"bob": 5}, "reasons": {"bob": {"the demo": 3}}}}`)
+
+	want := []*database.Record{
+		{From: "hubot-plusplus", To: "bob", Points: 3, Reason: "the demo", ImportID: "hubot-plusplus:bob:the demo"},
+		{From: "hubot-plusplus", To: "bob", Points: 2, ImportID: "hubot-plusplus:bob"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %+v; want %+v", records, want)
+	}
+}
+
+func TestReimportHubotPlusPlus(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(&database.Config{Path: filepath.Join(t.TempDir(), "karma.sqlite3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db = db.WithTeam("T1")
+
+	dumps := []struct {
+		Data         string
+		ExpectPoints int
+	}{
+		{
+			Data:         `{"plusPlus": {"scores": {"bob": 5}, "reasons": {"bob": {"the demo": 3}}}}`,
+			ExpectPoints: 5,
+		},
+		{
+			Data:         `{"plusPlus": {"scores": {"bob": 9}, "reasons": {"bob": {"the demo": 4, "the release": 2}}}}`,
+			ExpectPoints: 9,
+		},
+		{
+			// importing the same dump again has no effect
+			Data:         `{"plusPlus": {"scores": {"bob": 9}, "reasons": {"bob": {"the demo": 4, "the release": 2}}}}`,
+			ExpectPoints: 9,
+		},
+	}
+
+	if _, ok := importers["hubot-plusplus"].(totalsImporter); !ok {
+		t.Fatal("hubot-plusplus scores are not imported as totals")
+	}
+
+	for i, dump := range dumps {
+		_, err := db.ImportTotals(ctx, importAll(t, "hubot-plusplus", dump.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := db.GetUser(ctx, "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Points != dump.ExpectPoints {
+			t.Errorf("dump %d: got bob %d; want %d", i+1, user.Points, dump.ExpectPoints)
+		}
+	}
+
+	reasons := make(map[string]int)
+	err = db.WalkRecords(ctx, &database.RecordQuery{}, func(record *database.Record) error {
+		reasons[record.Reason] += record.Points
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"the demo": 4, "the release": 2, "": 3}; !reflect.DeepEqual(reasons, want) {
+		t.Errorf("got points per reason %v; want %v", reasons, want)
+	}
+}
@@ -0,0 +1,78 @@
+package ctlcommands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+func (cc *Commands) ListSessions(c *cli.Context) error {
+	var (
+		ctx = context.Background()
+		db  = cc.getDB(c.String("db"), c.String("workspace"))
+	)
+
+	sessions, err := db.GetSessions(ctx, c.String("user"))
+	if err != nil {
+		cc.Logger.Err(err).Fatal("could not list sessions")
+	}
+
+	for _, session := range sessions {
+		cc.Logger.
+			KV("id", session.ID).
+			KV("workspace", session.Team).
+			KV("user", session.User).
+			KV("name", session.Name).
+			KV("created", session.Created).
+			KV("expires", session.Expires).
+			Info("session")
+	}
+
+	return db.Close()
+}
+
+func (cc *Commands) RevokeSessions(c *cli.Context) error {
+	var (
+		ctx  = context.Background()
+		db   = cc.getDB(c.String("db"), c.String("workspace"))
+		id   = c.String("id")
+		user = c.String("user")
+	)
+
+	if (id == "") == (user == "") {
+		cc.Logger.Fatal("please pass either the `id` of a session or a `user` whose sessions to revoke")
+	}
+
+	if id != "" {
+		cc.Logger.KV("id", id).Info("session to revoke")
+		if !cc.confirm(c, "revoke this session?") {
+			return nil
+		}
+
+		err := db.DeleteSession(ctx, id)
+		if err != nil {
+			cc.Logger.Err(err).KV("id", id).Fatal("could not revoke session")
+		}
+
+		cc.auditAction(ctx, c, db)
+		cc.Logger.KV("id", id).Info("revoked session")
+
+		return db.Close()
+	}
+
+	cc.Logger.KV("workspace", db.Team()).KV("user", user).Info("user whose sessions to revoke")
+	if !cc.confirm(c, fmt.Sprintf("revoke all of %s's sessions?", user)) {
+		return nil
+	}
+
+	n, err := db.DeleteUserSessions(ctx, user)
+	if err != nil {
+		cc.Logger.Err(err).KV("user", user).Fatal("could not revoke sessions")
+	}
+
+	cc.auditAction(ctx, c, db)
+	cc.Logger.KV("user", user).KV("sessions", n).Info("revoked sessions")
+
+	return db.Close()
+}
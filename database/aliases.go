@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// An Alias maps an alternative name to a user's main name.
+type Alias struct {
+	Alias string `json:"alias"`
+	User  string `json:"user"`
+}
+
+// ErrNoSuchAlias is returned when an alias lookup
+// is performed on a non-existent alias
+var ErrNoSuchAlias = errors.New("no such alias")
+
+// ErrNotBlacklisted is returned when removing a name
+// that is not blacklisted from the blacklist
+var ErrNotBlacklisted = errors.New("not blacklisted")
+
+func (db *DB) createAliasesTables() error {
+	schemas := []string{
+		`create table if not exists aliases (
+			^team^ text not null,
+			^alias^ text not null,
+			^user^ text not null,
+			primary key (^team^, ^alias^)
+		)`,
+		`create table if not exists blacklist (
+			^team^ text not null,
+			^name^ text not null,
+			primary key (^team^, ^name^)
+		)`,
+	}
+
+	for _, schema := range schemas {
+		_, err := db.SQL.Exec(strings.Replace(schema, "^", "`", -1))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAlias returns the main name that an alias maps to.
+func (db *DB) GetAlias(ctx context.Context, alias string) (string, error) {
+	var user string
+	err := db.SQL.QueryRowContext(ctx, "select `user` from aliases where `team` = ? and `alias` = ?", db.team, alias).Scan(&user)
+
+	switch err {
+	case nil:
+		return user, nil
+	case sql.ErrNoRows:
+		return "", ErrNoSuchAlias
+	default:
+		return "", err
+	}
+}
+
+// GetAliases returns all aliases ordered by user.
+func (db *DB) GetAliases(ctx context.Context) ([]*Alias, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `alias`, `user` from aliases where `team` = ? order by `user`, `alias`", db.team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []*Alias
+	for rows.Next() {
+		alias := &Alias{}
+		err := rows.Scan(&alias.Alias, &alias.User)
+		if err != nil {
+			return nil, err
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, rows.Err()
+}
+
+// SetAlias maps an alias to a user, replacing the
+// alias's previous user if there was one.
+func (db *DB) SetAlias(ctx context.Context, alias, user string) error {
+	_, err := db.SQL.ExecContext(ctx, "insert or replace into aliases (`team`, `alias`, `user`) values(?, ?, ?)", db.team, alias, user)
+
+	return err
+}
+
+// DeleteAlias removes an alias.
+func (db *DB) DeleteAlias(ctx context.Context, alias string) error {
+	res, err := db.SQL.ExecContext(ctx, "delete from aliases where `team` = ? and `alias` = ?", db.team, alias)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, ErrNoSuchAlias)
+}
+
+// IsBlacklisted checks whether a name is on the blacklist.
+func (db *DB) IsBlacklisted(ctx context.Context, name string) (bool, error) {
+	var count int
+	err := db.SQL.QueryRowContext(ctx, "select count(*) from blacklist where `team` = ? and `name` = ?", db.team, name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetBlacklist returns all blacklisted names in order.
+func (db *DB) GetBlacklist(ctx context.Context) ([]string, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `name` from blacklist where `team` = ? order by `name`", db.team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// AddToBlacklist adds a name to the blacklist.
+func (db *DB) AddToBlacklist(ctx context.Context, name string) error {
+	_, err := db.SQL.ExecContext(ctx, "insert or ignore into blacklist (`team`, `name`) values(?, ?)", db.team, name)
+
+	return err
+}
+
+// RemoveFromBlacklist removes a name from the blacklist.
+func (db *DB) RemoveFromBlacklist(ctx context.Context, name string) error {
+	res, err := db.SQL.ExecContext(ctx, "delete from blacklist where `team` = ? and `name` = ?", db.team, name)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, ErrNotBlacklisted)
+}
+
+// checkAffected returns errNone if a statement did not affect any rows.
+func checkAffected(res sql.Result, errNone error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNone
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+		t1  = db.WithTeam("T1")
+	)
+
+	for alias, user := range map[string]string{"bobby": "bob", "rob": "robert", "robbie": "bob"} {
+		err := t1.SetAlias(ctx, alias, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user, err := t1.GetAlias(ctx, "bobby")
+	if err != nil || user != "bob" {
+		t.Errorf("got bobby -> %q, %v; want bob", user, err)
+	}
+
+	// aliases belong to their workspace
+	_, err = db.WithTeam("T2").GetAlias(ctx, "bobby")
+	if err != ErrNoSuchAlias {
+		t.Errorf("got error %v in another workspace; want ErrNoSuchAlias", err)
+	}
+
+	// setting an alias again moves it to another user
+	err = t1.SetAlias(ctx, "rob", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases, err := t1.GetAliases(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Alias{{Alias: "bobby", User: "bob"}, {Alias: "rob", User: "bob"}, {Alias: "robbie", User: "bob"}}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Errorf("got aliases %+v; want %+v", aliases, want)
+	}
+
+	err = t1.DeleteAlias(ctx, "rob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = t1.DeleteAlias(ctx, "rob")
+	if err != ErrNoSuchAlias {
+		t.Errorf("got error %v deleting a deleted alias; want ErrNoSuchAlias", err)
+	}
+	_, err = t1.GetAlias(ctx, "rob")
+	if err != ErrNoSuchAlias {
+		t.Errorf("got error %v resolving a deleted alias; want ErrNoSuchAlias", err)
+	}
+}
+
+func TestAliasTotals(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t).WithTeam("T1")
+	)
+
+	// karma that an alias received before it was
+	// an alias keeps counting towards the alias
+	err := db.InsertPoints(ctx, &Points{From: "alice", To: "bobby", Points: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetAlias(ctx, "bobby", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// karma is recorded for the user that the alias resolves to
+	to, err := db.GetAlias(ctx, "bobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.InsertPoints(ctx, &Points{From: "alice", To: to, Points: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	materialized, _ := totals(t, db)
+	if want := map[string]int{"T1/bobby": 2, "T1/bob": 3}; !reflect.DeepEqual(materialized, want) {
+		t.Errorf("got totals %v; want %v", materialized, want)
+	}
+
+	// deleting the alias does not move any karma
+	err = db.DeleteAlias(ctx, "bobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := db.GetUser(ctx, "bob")
+	if err != nil || user.Points != 3 {
+		t.Errorf("got bob %+v, %v after deleting the alias; want 3 points", user, err)
+	}
+}
+
+func TestBlacklist(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+		t1  = db.WithTeam("T1")
+	)
+
+	for _, name := range []string{"spam", "bot", "spam"} {
+		err := t1.AddToBlacklist(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := t1.GetBlacklist(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bot", "spam"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got blacklist %v; want %v", names, want)
+	}
+
+	if blacklisted, err := db.WithTeam("T2").IsBlacklisted(ctx, "spam"); err != nil || blacklisted {
+		t.Errorf("got spam blacklisted %v, %v in another workspace; want false", blacklisted, err)
+	}
+
+	err = t1.RemoveFromBlacklist(ctx, "spam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = t1.RemoveFromBlacklist(ctx, "spam")
+	if err != ErrNotBlacklisted {
+		t.Errorf("got error %v removing a removed name; want ErrNotBlacklisted", err)
+	}
+	if blacklisted, err := t1.IsBlacklisted(ctx, "spam"); err != nil || blacklisted {
+		t.Errorf("got spam blacklisted %v, %v after removing it; want false", blacklisted, err)
+	}
+}
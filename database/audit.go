@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// An AuditEntry records an administrative action, such as
+// overriding a user's karma or changing an alias.
+type AuditEntry struct {
+	ID   int64  `json:"id"`
+	Team string `json:"team,omitempty"`
+
+	// Actor is the operator that performed the action, and Source
+	// is where it was performed: "slack" for admin chat commands,
+	// or the hostname that karmabotctl ran on.
+	Actor  string `json:"actor"`
+	Source string `json:"source"`
+
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+
+	// User is the user whose karma was changed, if any, and Before
+	// and After are their total points before and after the action.
+	User   string `json:"user,omitempty"`
+	Before *int   `json:"before,omitempty"`
+	After  *int   `json:"after,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// An AuditQuery filters the audit log. Empty fields match all entries.
+type AuditQuery struct {
+	Actor, User   string
+	Limit, Offset int
+}
+
+func (db *DB) createAuditTable() error {
+	schema := strings.Replace(
+		`create table if not exists audit_log (
+			^id^ integer primary key,
+			^team^ text not null,
+			^actor^ text not null,
+			^source^ text not null,
+			^command^ text not null,
+			^args^ text not null,
+			^user^ text not null,
+			^before^ integer,
+			^after^ integer,
+			^timestamp^ text not null default (datetime('now'))
+		)`,
+		"^", "`", -1)
+
+	_, err := db.SQL.Exec(schema)
+	return err
+}
+
+// InsertAuditEntry records an administrative action in the DB's
+// workspace, unless the entry has a workspace of its own.
+func (db *DB) InsertAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	return db.insertAuditEntry(ctx, db.SQL, entry)
+}
+
+// UpdatePointsAudited is UpdatePoints for administrative actions. It
+// records a copy of entry in the audit log for every user of users,
+// with the user's totals before and after the action, in the same
+// transaction as their karma, so that no change goes unaudited.
+func (db *DB) UpdatePointsAudited(ctx context.Context, users []string, entry *AuditEntry, fn func(totals map[string]int) ([]*Points, error)) (map[string]*User, error) {
+	return db.updatePoints(ctx, users, entry, fn)
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (db *DB) insertAuditEntry(ctx context.Context, q execer, entry *AuditEntry) error {
+	team := entry.Team
+	if team == "" {
+		team = db.team
+	}
+
+	args, err := json.Marshal(entry.Args)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, "insert into audit_log (`team`, `actor`, `source`, `command`, `args`, `user`, `before`, `after`) values(?, ?, ?, ?, ?, ?, ?, ?)", team, entry.Actor, entry.Source, entry.Command, string(args), entry.User, nullInt(entry.Before), nullInt(entry.After))
+
+	return err
+}
+
+// GetAuditLog returns audit entries in the DB's workspace,
+// or in all workspaces if the DB is not scoped to one, newest first.
+func (db *DB) GetAuditLog(ctx context.Context, query *AuditQuery) ([]*AuditEntry, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := db.SQL.QueryContext(ctx, "select `id`, `team`, `actor`, `source`, `command`, `args`, `user`, `before`, `after`, `timestamp` from audit_log where (? = '' or `team` = ?) and (? = '' or `actor` = ?) and (? = '' or `user` = ?) order by `id` desc limit ? offset ?", db.team, db.team, query.Actor, query.Actor, query.User, query.User, limit, query.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var (
+			entry         = &AuditEntry{}
+			args          string
+			before, after sql.NullInt64
+			timestamp     string
+		)
+
+		err := rows.Scan(&entry.ID, &entry.Team, &entry.Actor, &entry.Source, &entry.Command, &args, &entry.User, &before, &after, &timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(args), &entry.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Before = intPtr(before)
+		entry.After = intPtr(after)
+
+		entry.Timestamp, err = time.Parse(timestampFormat, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func nullInt(i *int) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: int64(*i), Valid: true}
+}
+
+func intPtr(i sql.NullInt64) *int {
+	if !i.Valid {
+		return nil
+	}
+
+	v := int(i.Int64)
+	return &v
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGetAuditLog(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	for _, entry := range []*AuditEntry{
+		{Team: "T1", Actor: "admin", Source: "slack", Command: "admin set", Args: []string{"bob", "5"}, User: "bob"},
+		{Team: "T1", Actor: "root", Source: "host", Command: "karma reset", User: "carol"},
+		{Team: "T2", Actor: "admin", Source: "slack", Command: "admin set", Args: []string{"bob", "1"}, User: "bob"},
+		{Team: "T1", Actor: "admin", Source: "slack", Command: "admin alias add", Args: []string{"bob", "robert"}},
+	} {
+		err := db.InsertAuditEntry(ctx, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		Name   string
+		Team   string
+		Query  *AuditQuery
+		Expect []int64
+	}{
+		{
+			Name:   "all",
+			Query:  &AuditQuery{},
+			Expect: []int64{4, 3, 2, 1},
+		},
+		{
+			Name:   "workspace",
+			Team:   "T1",
+			Query:  &AuditQuery{},
+			Expect: []int64{4, 2, 1},
+		},
+		{
+			Name:   "actor",
+			Query:  &AuditQuery{Actor: "admin"},
+			Expect: []int64{4, 3, 1},
+		},
+		{
+			Name:   "user",
+			Team:   "T1",
+			Query:  &AuditQuery{User: "bob"},
+			Expect: []int64{1},
+		},
+		{
+			Name:   "limit",
+			Query:  &AuditQuery{Limit: 2},
+			Expect: []int64{4, 3},
+		},
+		{
+			Name:   "offset",
+			Query:  &AuditQuery{Limit: 2, Offset: 2},
+			Expect: []int64{2, 1},
+		},
+		{
+			Name:   "offset without limit",
+			Query:  &AuditQuery{Offset: 3},
+			Expect: []int64{1},
+		},
+		{
+			Name:  "past the end",
+			Query: &AuditQuery{Offset: 4},
+		},
+	}
+
+	for _, tc := range tt {
+		entries, err := db.WithTeam(tc.Team).GetAuditLog(ctx, tc.Query)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+
+		var ids []int64
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		if !reflect.DeepEqual(ids, tc.Expect) {
+			t.Errorf("%s: got entries %v; want %v", tc.Name, ids, tc.Expect)
+		}
+	}
+
+	entries, err := db.GetAuditLog(ctx, &AuditQuery{Limit: 1, Offset: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := entries[0]
+	if entry.Team != "T1" || entry.Actor != "admin" || entry.Command != "admin set" || !reflect.DeepEqual(entry.Args, []string{"bob", "5"}) || entry.Before != nil || entry.Timestamp.IsZero() {
+		t.Errorf("got entry %+v", entry)
+	}
+}
+
+func TestUpdatePointsAudited(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t).WithTeam("T1")
+	)
+
+	err := db.InsertPoints(ctx, &Points{From: "alice", To: "bob", Points: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reset := func(totals map[string]int) ([]*Points, error) {
+		var records []*Points
+		for name, points := range totals {
+			records = append(records, &Points{From: "admin", To: name, Points: -points, Source: SourceAdmin})
+		}
+		return records, nil
+	}
+
+	_, err = db.UpdatePointsAudited(ctx, []string{"bob", "carol"}, &AuditEntry{Actor: "admin", Source: "slack", Command: "reset"}, reset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := db.GetAuditLog(ctx, &AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries; want one per user", len(entries))
+	}
+	for _, entry := range entries {
+		want := map[string][2]int{"bob": {3, 0}, "carol": {0, 0}}[entry.User]
+		if entry.Team != "T1" || entry.Command != "reset" || entry.Before == nil || entry.After == nil || [2]int{*entry.Before, *entry.After} != want {
+			t.Errorf("got entry %+v; want %s's totals %v", entry, entry.User, want)
+		}
+	}
+
+	// karma is not changed if the change can not be audited
+	err = db.InsertPoints(ctx, &Points{From: "alice", To: "bob", Points: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.SQL.Exec("drop table audit_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.UpdatePointsAudited(ctx, []string{"bob"}, &AuditEntry{Actor: "admin", Source: "slack", Command: "reset"}, reset)
+	if err == nil {
+		t.Fatal("got no error without an audit log")
+	}
+
+	user, err := db.GetUser(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Points != 2 {
+		t.Errorf("got %d points after a failed reset; want 2", user.Points)
+	}
+}
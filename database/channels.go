@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// A ChannelPolicy overrides karmabot's config for a single
+// channel. Nil fields are not overridden.
+type ChannelPolicy struct {
+	Team    string `json:"team,omitempty" yaml:"-"`
+	Channel string `json:"channel,omitempty" yaml:"-"`
+
+	ReplyType *string `json:"replytype,omitempty" yaml:"replytype,omitempty"`
+	MaxPoints *int    `json:"maxpoints,omitempty" yaml:"maxpoints,omitempty"`
+
+	// Karma toggles karma operations (including reactji) in the channel.
+	Karma   *bool `json:"karma,omitempty" yaml:"karma,omitempty"`
+	Reactji *bool `json:"reactji,omitempty" yaml:"reactji,omitempty"`
+
+	// Upvote and Downvote replace the lists of reactjis
+	// that count as karma operations.
+	Upvote   []string `json:"upvote,omitempty" yaml:"upvote,omitempty"`
+	Downvote []string `json:"downvote,omitempty" yaml:"downvote,omitempty"`
+}
+
+// ErrNoSuchChannelPolicy is returned when a channel
+// does not have a policy
+var ErrNoSuchChannelPolicy = errors.New("no such channel policy")
+
+func (db *DB) createChannelPoliciesTable() error {
+	schema := strings.Replace(
+		`create table if not exists channel_policies (
+			^team^ text not null,
+			^channel^ text not null,
+			^reply_type^ text,
+			^max_points^ integer,
+			^karma^ integer,
+			^reactji^ integer,
+			^upvote^ text,
+			^downvote^ text,
+			primary key (^team^, ^channel^)
+		)`,
+		"^", "`", -1)
+
+	_, err := db.SQL.Exec(schema)
+	return err
+}
+
+// GetChannelPolicy returns the policy for a channel in the DB's workspace.
+// Policies that were stored without a workspace apply to all workspaces,
+// but a workspace's own policy is preferred.
+func (db *DB) GetChannelPolicy(ctx context.Context, channel string) (*ChannelPolicy, error) {
+	row := db.SQL.QueryRowContext(ctx, "select `team`, `channel`, `reply_type`, `max_points`, `karma`, `reactji`, `upvote`, `downvote` from channel_policies where `team` in (?, '') and `channel` = ? order by `team` desc limit 1", db.team, channel)
+
+	policy, err := scanChannelPolicy(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoSuchChannelPolicy
+	}
+
+	return policy, err
+}
+
+// GetChannelPolicies returns all channel policies in the DB's workspace,
+// or in all workspaces if the DB is not scoped to one.
+func (db *DB) GetChannelPolicies(ctx context.Context) ([]*ChannelPolicy, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `team`, `channel`, `reply_type`, `max_points`, `karma`, `reactji`, `upvote`, `downvote` from channel_policies where (? = '' or `team` = ?) order by `team`, `channel`", db.team, db.team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*ChannelPolicy
+	for rows.Next() {
+		policy, err := scanChannelPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// SetChannelPolicy creates or replaces the policy for a channel.
+// Policies without a team are stored under the DB's workspace.
+func (db *DB) SetChannelPolicy(ctx context.Context, policy *ChannelPolicy) error {
+	team := policy.Team
+	if team == "" {
+		team = db.team
+	}
+
+	var (
+		replyType, upvote, downvote sql.NullString
+		maxPoints, karma, reactji   sql.NullInt64
+	)
+	if policy.ReplyType != nil {
+		replyType = sql.NullString{String: *policy.ReplyType, Valid: true}
+	}
+	if policy.MaxPoints != nil {
+		maxPoints = sql.NullInt64{Int64: int64(*policy.MaxPoints), Valid: true}
+	}
+	if policy.Karma != nil {
+		karma = nullBool(*policy.Karma)
+	}
+	if policy.Reactji != nil {
+		reactji = nullBool(*policy.Reactji)
+	}
+	if policy.Upvote != nil {
+		upvote = sql.NullString{String: strings.Join(policy.Upvote, ","), Valid: true}
+	}
+	if policy.Downvote != nil {
+		downvote = sql.NullString{String: strings.Join(policy.Downvote, ","), Valid: true}
+	}
+
+	_, err := db.SQL.ExecContext(ctx, "insert or replace into channel_policies (`team`, `channel`, `reply_type`, `max_points`, `karma`, `reactji`, `upvote`, `downvote`) values(?, ?, ?, ?, ?, ?, ?, ?)", team, policy.Channel, replyType, maxPoints, karma, reactji, upvote, downvote)
+
+	return err
+}
+
+// DeleteChannelPolicy removes the policy for a channel in the DB's workspace.
+func (db *DB) DeleteChannelPolicy(ctx context.Context, channel string) error {
+	res, err := db.SQL.ExecContext(ctx, "delete from channel_policies where `team` = ? and `channel` = ?", db.team, channel)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, ErrNoSuchChannelPolicy)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanChannelPolicy(row scanner) (*ChannelPolicy, error) {
+	var (
+		policy                      = &ChannelPolicy{}
+		replyType, upvote, downvote sql.NullString
+		maxPoints, karma, reactji   sql.NullInt64
+	)
+
+	err := row.Scan(&policy.Team, &policy.Channel, &replyType, &maxPoints, &karma, &reactji, &upvote, &downvote)
+	if err != nil {
+		return nil, err
+	}
+
+	if replyType.Valid {
+		policy.ReplyType = &replyType.String
+	}
+	if maxPoints.Valid {
+		n := int(maxPoints.Int64)
+		policy.MaxPoints = &n
+	}
+	if karma.Valid {
+		b := karma.Int64 != 0
+		policy.Karma = &b
+	}
+	if reactji.Valid {
+		b := reactji.Int64 != 0
+		policy.Reactji = &b
+	}
+	if upvote.Valid {
+		policy.Upvote = splitList(upvote.String)
+	}
+	if downvote.Valid {
+		policy.Downvote = splitList(downvote.String)
+	}
+
+	return policy, nil
+}
+
+func nullBool(b bool) sql.NullInt64 {
+	if b {
+		return sql.NullInt64{Int64: 1, Valid: true}
+	}
+
+	return sql.NullInt64{Int64: 0, Valid: true}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestChannelPolicies(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		db        = newTestDB(t)
+		thread    = "thread"
+		maxPoints = 3
+		no        = false
+	)
+
+	for _, policy := range []*ChannelPolicy{
+		// policies without a workspace apply to all workspaces
+		{Channel: "C1", Karma: &no},
+		{Team: "T1", Channel: "C1", ReplyType: &thread, MaxPoints: &maxPoints, Upvote: []string{"+1", "tada"}, Downvote: []string{}},
+		{Team: "T2", Channel: "C2", Reactji: &no},
+	} {
+		err := db.SetChannelPolicy(ctx, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		Name   string
+		Team   string
+		Expect *ChannelPolicy
+	}{
+		{
+			Name:   "own policy",
+			Team:   "T1",
+			Expect: &ChannelPolicy{Team: "T1", Channel: "C1", ReplyType: &thread, MaxPoints: &maxPoints, Upvote: []string{"+1", "tada"}, Downvote: []string{}},
+		},
+		{
+			Name:   "policy of all workspaces",
+			Team:   "T2",
+			Expect: &ChannelPolicy{Channel: "C1", Karma: &no},
+		},
+	}
+
+	for _, tc := range tt {
+		policy, err := db.WithTeam(tc.Team).GetChannelPolicy(ctx, "C1")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if !reflect.DeepEqual(policy, tc.Expect) {
+			t.Errorf("%s: got %+v; want %+v", tc.Name, policy, tc.Expect)
+		}
+	}
+
+	_, err := db.WithTeam("T1").GetChannelPolicy(ctx, "C2")
+	if err != ErrNoSuchChannelPolicy {
+		t.Errorf("got error %v for another workspace's channel; want ErrNoSuchChannelPolicy", err)
+	}
+
+	policies, err := db.WithTeam("T2").GetChannelPolicies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 || policies[0].Channel != "C2" || policies[0].Reactji == nil || *policies[0].Reactji {
+		t.Errorf("got T2's policies %+v; want C2 without reactji", policies)
+	}
+
+	policies, err = db.GetChannelPolicies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 3 {
+		t.Errorf("got %d policies in all workspaces; want 3", len(policies))
+	}
+
+	// setting a policy replaces it
+	err = db.WithTeam("T1").SetChannelPolicy(ctx, &ChannelPolicy{Channel: "C1", MaxPoints: &maxPoints})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := db.WithTeam("T1").GetChannelPolicy(ctx, "C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&ChannelPolicy{Team: "T1", Channel: "C1", MaxPoints: &maxPoints}); !reflect.DeepEqual(policy, want) {
+		t.Errorf("got replaced policy %+v; want %+v", policy, want)
+	}
+
+	// deleting a workspace's policy falls back to the one of all workspaces
+	err = db.WithTeam("T1").DeleteChannelPolicy(ctx, "C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithTeam("T1").DeleteChannelPolicy(ctx, "C1")
+	if err != ErrNoSuchChannelPolicy {
+		t.Errorf("got error %v deleting a deleted policy; want ErrNoSuchChannelPolicy", err)
+	}
+
+	policy, err = db.WithTeam("T1").GetChannelPolicy(ctx, "C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Team != "" || policy.Karma == nil || *policy.Karma {
+		t.Errorf("got policy %+v after deleting T1's; want the policy of all workspaces", policy)
+	}
+}
@@ -1,8 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -23,13 +26,39 @@ type Config struct {
 type DB struct {
 	Config *Config
 	SQL    *sql.DB
+
+	// team is the ID of the Slack workspace that this DB is scoped to.
+	// An empty team means that all workspaces are included.
+	team string
+
+	events *events
 }
 
 // Points is a karma record containing info about
-// a karma operation.
+// a karma operation. Team is the ID of the Slack
+// workspace that the operation happened in, and
+// Source is how the operation was made, e.g.
+// SourceMessage.
 type Points struct {
-	From, To, Reason string
-	Points           int
+	From, To, Reason, Team, Source string
+	Points                         int
+}
+
+// Sources of karma operations. Operations that were recorded
+// before sources were tracked have an empty source.
+const (
+	SourceMessage     = "message"
+	SourceReactji     = "reactji"
+	SourceAdmin       = "admin"
+	SourceKarmabotctl = "karmabotctl"
+	SourceImport      = "import"
+)
+
+// A Workspace is a Slack workspace that karmabot
+// is or has been connected to.
+type Workspace struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
 }
 
 // Throwback is a karma operation that has happened
@@ -42,10 +71,12 @@ type Throwback struct {
 // The Leaderboard lists the top X users.
 type Leaderboard []*User
 
-// A User is an entry in the Leaderboard.
+// A User is an entry in the Leaderboard. Decayed is the user's
+// points with karma decay applied, if the workspace has any.
 type User struct {
-	Name   string
-	Points int
+	Name    string `json:"name"`
+	Points  int    `json:"points"`
+	Decayed *int   `json:"decayed,omitempty"`
 }
 
 // ErrNoSuchUser is returned when a user lookup
@@ -57,6 +88,7 @@ var ErrNoSuchUser = errors.New("no such user")
 func New(config *Config) (*DB, error) {
 	instance := &DB{
 		Config: config,
+		events: newEvents(),
 	}
 
 	err := instance.Init()
@@ -71,7 +103,15 @@ func New(config *Config) (*DB, error) {
 // Init initializes an sqlite3 database in order
 // for karmabot to be able to use it
 func (db *DB) Init() error {
-	sqlite, err := sql.Open("sqlite3", db.Config.Path)
+	// take the write lock when a transaction begins rather than when
+	// it first writes, so that transactions that read totals before
+	// inserting karma cannot deadlock with each other
+	dsn := db.Config.Path
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_txlock=immediate"
+	}
+
+	sqlite, err := sql.Open(driverName, dsn)
 
 	if err != nil {
 		return err
@@ -81,6 +121,30 @@ func (db *DB) Init() error {
 	return db.createTable()
 }
 
+// WithTeam returns a copy of the DB that is scoped to a single
+// Slack workspace. Points are recorded under that workspace and
+// all queries only consider karma from that workspace. Passing
+// an empty team returns a DB that spans all workspaces.
+func (db *DB) WithTeam(team string) *DB {
+	return &DB{
+		Config: db.Config,
+		SQL:    db.SQL,
+		team:   team,
+		events: db.events,
+	}
+}
+
+// Team returns the ID of the workspace that the DB is scoped
+// to, or an empty string if it spans all workspaces.
+func (db *DB) Team() string {
+	return db.team
+}
+
+// Close closes the underlying sqlite3 database.
+func (db *DB) Close() error {
+	return db.SQL.Close()
+}
+
 func (db *DB) createTable() error {
 	schema := strings.Replace(
 		`create table if not exists karma (
@@ -103,61 +167,334 @@ func (db *DB) createTable() error {
 		return err
 	}
 
-	return nil
-}
+	err = db.addColumn("karma", "team", "text not null default ''")
+	if err != nil {
+		return err
+	}
 
-// InsertPoints inserts a Points object into the database.
-func (db *DB) InsertPoints(points *Points) error {
-	stmt, err := db.SQL.Prepare("insert into karma (`from`, `to`, `reason`, `points`) values(?, ?, ?, ?)")
+	_, err = db.SQL.Exec("create index if not exists idx_team_to on karma(`team`, `to`);")
+	if err != nil {
+		return err
+	}
 
+	err = db.addColumn("karma", "source", "text not null default ''")
+	if err != nil {
+		return err
+	}
+
+	// import_id identifies records that were imported from other
+	// bots, so that importing the same data twice has no effect
+	err = db.addColumn("karma", "import_id", "text")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.SQL.Exec("create unique index if not exists idx_team_import_id on karma(`team`, `import_id`);")
+	if err != nil {
+		return err
+	}
+
+	err = db.createTotalsTable()
+	if err != nil {
+		return err
+	}
+
+	err = db.createKindsTable()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.SQL.Exec(strings.Replace(
+		`create table if not exists workspaces (
+			^id^ text primary key,
+			^name^ text not null
+		)`,
+		"^", "`", -1))
+	if err != nil {
+		return err
+	}
+
+	err = db.createChannelPoliciesTable()
+	if err != nil {
+		return err
+	}
+
+	err = db.createAliasesTables()
+	if err != nil {
+		return err
+	}
+
+	err = db.createRolesTable()
+	if err != nil {
+		return err
+	}
+
+	err = db.createDecayTable()
+	if err != nil {
+		return err
+	}
+
+	err = db.createSessionsTable()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(points.From, points.To, points.Reason, points.Points)
+	return db.createAuditTable()
+}
 
+// addColumn adds a column to an existing table unless
+// the table already has it.
+func (db *DB) addColumn(table, column, definition string) error {
+	rows, err := db.SQL.Query(fmt.Sprintf("pragma table_info(`%s`)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name, ctype      string
+			dflt             sql.NullString
+		)
+
+		err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
+		if err != nil {
+			return err
+		}
+
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.SQL.Exec(fmt.Sprintf("alter table `%s` add column `%s` %s", table, column, definition))
 	return err
 }
 
-// GetUser returns info about a user.
-func (db *DB) GetUser(name string) (*User, error) {
-	stmt, err := db.SQL.Prepare("select count(`to`) as `count` from karma where `to` = ?")
+// InsertPoints inserts a Points object into the database. Points
+// without a team are recorded under the DB's workspace.
+func (db *DB) InsertPoints(ctx context.Context, points *Points) error {
+	_, err := db.InsertPointsBatch(ctx, []*Points{points})
+	return err
+}
+
+// InsertPointsBatch inserts several karma records in a single
+// transaction, so that either all or none of them are recorded. It
+// returns the resulting totals of the users that received points, as
+// seen by that transaction.
+func (db *DB) InsertPointsBatch(ctx context.Context, records []*Points) (map[string]*User, error) {
+	return db.UpdatePoints(ctx, nil, func(map[string]int) ([]*Points, error) {
+		return records, nil
+	})
+}
+
+// UpdatePoints looks up the totals of users, passes them to fn and
+// inserts the karma records that it returns, all in a single
+// transaction. This lets callers compute records from the current
+// totals, such as when resetting a user's karma, without racing other
+// writers. Users that have no karma have a total of 0. It returns the
+// resulting totals of users and of the users that received points.
+func (db *DB) UpdatePoints(ctx context.Context, users []string, fn func(totals map[string]int) ([]*Points, error)) (map[string]*User, error) {
+	return db.updatePoints(ctx, users, nil, fn)
+}
+
+// updatePoints implements UpdatePoints and, if entry is not nil,
+// records the change to every user's total in the audit log in the
+// same transaction.
+func (db *DB) updatePoints(ctx context.Context, users []string, entry *AuditEntry, fn func(totals map[string]int) ([]*Points, error)) (map[string]*User, error) {
+	tx, err := db.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := db.getTotals(ctx, tx, users)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int, len(current))
+	for name, user := range current {
+		totals[name] = user.Points
+	}
+
+	records, err := fn(totals)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "insert into karma (`from`, `to`, `reason`, `points`, `team`, `source`) values(?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	user := &User{
-		Name: name,
+	// the audit log records the users that were passed,
+	// not the ones that fn gives points to
+	audited := users
+
+	ids := make([]int64, len(records))
+	for i, points := range records {
+		team := points.Team
+		if team == "" {
+			team = db.team
+		}
+
+		res, err := stmt.ExecContext(ctx, points.From, points.To, points.Reason, points.Points, team, points.Source)
+		if err != nil {
+			return nil, err
+		}
+		ids[i], err = res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, points.To)
 	}
 
-	var userExists int
-	err = stmt.QueryRow(user.Name).Scan(&userExists)
+	current, err = db.getTotals(ctx, tx, users)
 	if err != nil {
 		return nil, err
 	}
-	if userExists == 0 {
-		return nil, ErrNoSuchUser
+
+	if entry != nil {
+		for _, user := range audited {
+			before, after := totals[user], current[user].Points
+
+			entry := *entry
+			entry.User = user
+			entry.Before = &before
+			entry.After = &after
+
+			err = db.insertAuditEntry(ctx, tx, &entry)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	stmt, err = db.SQL.Prepare("select sum(`points`) as `points` from karma where `to` = ?")
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
 
-	err = stmt.QueryRow(user.Name).Scan(&user.Points)
+	now := time.Now()
+	for i, points := range records {
+		team := points.Team
+		if team == "" {
+			team = db.team
+		}
+
+		db.events.publish(&KarmaEvent{
+			ID:        ids[i],
+			From:      points.From,
+			To:        points.To,
+			Reason:    points.Reason,
+			Team:      team,
+			Source:    points.Source,
+			Points:    points.Points,
+			Total:     current[points.To].Points,
+			Decayed:   current[points.To].Decayed,
+			Timestamp: now,
+		})
+	}
+
+	return current, nil
+}
+
+// getTotals looks up the totals of users within tx.
+func (db *DB) getTotals(ctx context.Context, tx *sql.Tx, users []string) (map[string]*User, error) {
+	totals := make(map[string]*User, len(users))
+	for _, name := range users {
+		if _, ok := totals[name]; ok {
+			continue
+		}
+
+		user, err := db.getUser(ctx, tx, name)
+		switch err {
+		case nil:
+		case ErrNoSuchUser:
+			user = &User{Name: name}
+		default:
+			return nil, err
+		}
+
+		totals[name] = user
+	}
+
+	return totals, nil
+}
+
+// GetUser returns info about a user.
+func (db *DB) GetUser(ctx context.Context, name string) (*User, error) {
+	return db.getUser(ctx, db.SQL, name)
+}
+
+// getUser looks up a user's points and, if the workspace has karma
+// decay, their decayed points.
+func (db *DB) getUser(ctx context.Context, q queryer, name string) (*User, error) {
+	var (
+		user   = &User{Name: name}
+		points sql.NullInt64
+	)
+
+	err := q.QueryRowContext(ctx, "select sum(`points`) from karma_totals where `user` = ? and (? = '' or `team` = ?)", name, db.team, db.team).Scan(&points)
 	if err != nil {
 		return nil, err
 	}
+	if !points.Valid {
+		return nil, ErrNoSuchUser
+	}
+	user.Points = int(points.Int64)
+
+	_, err = db.getDecay(ctx, q)
+	switch err {
+	case nil:
+	case ErrNoSuchDecay:
+		return user, nil
+	default:
+		return nil, err
+	}
+
+	var decayed sql.NullFloat64
+	err = q.QueryRowContext(ctx, "select "+decayedPoints+" from karma where `to` = ? and (? = '' or `team` = ?)", name, db.team, db.team).Scan(&decayed)
+	if err != nil {
+		return nil, err
+	}
+	user.Decayed = roundPoints(decayed.Float64)
 
 	return user, nil
 }
 
-// GetLeaderboard returns the leaderboard with the top X users.
-func (db *DB) GetLeaderboard(limit int) (Leaderboard, error) {
-	rows, err := db.SQL.Query("select `to`, sum(`points`) as `points` from karma group by `to` order by `points` desc limit ?", limit)
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// roundPoints rounds decayed points to whole points.
+func roundPoints(points float64) *int {
+	rounded := int(math.Round(points))
+	return &rounded
+}
+
+// GetLeaderboard returns the leaderboard with the top X users of a
+// kind, or of any kind if kind is empty. If the workspace has karma
+// decay, users are ranked by their decayed points.
+func (db *DB) GetLeaderboard(ctx context.Context, kind Kind, limit int) (Leaderboard, error) {
+	_, err := db.GetDecay(ctx)
+	switch err {
+	case nil:
+		return db.getDecayedLeaderboard(ctx, kind, limit)
+	case ErrNoSuchDecay:
+	default:
+		return nil, err
+	}
+
+	rows, err := db.SQL.QueryContext(ctx, "select `user`, sum(`points`) as `points` from karma_totals where (? = '' or `team` = ?) and "+kindFilter("karma_totals", "user")+" group by `user` order by `points` desc limit ?", db.team, db.team, kind, kind, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -178,27 +515,52 @@ func (db *DB) GetLeaderboard(limit int) (Leaderboard, error) {
 	return leaderboard, nil
 }
 
+func (db *DB) getDecayedLeaderboard(ctx context.Context, kind Kind, limit int) (Leaderboard, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `to`, sum(`points`), "+decayedPoints+" as `decayed` from karma where (? = '' or `team` = ?) and "+kindFilter("karma", "to")+" group by `to` order by `decayed` desc limit ?", db.team, db.team, kind, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaderboard Leaderboard
+	for rows.Next() {
+		var (
+			user    = &User{}
+			decayed float64
+		)
+		err := rows.Scan(&user.Name, &user.Points, &decayed)
+		if err != nil {
+			return nil, err
+		}
+
+		user.Decayed = roundPoints(decayed)
+		leaderboard = append(leaderboard, user)
+	}
+
+	return leaderboard, rows.Err()
+}
+
 // GetTotalPoints returns the amount of points given or taken
 // for all users.
-func (db *DB) GetTotalPoints() (int, error) {
-	var res int
-	err := db.SQL.QueryRow("select sum(abs(`points`)) from karma").Scan(&res)
+func (db *DB) GetTotalPoints(ctx context.Context) (int, error) {
+	var res sql.NullInt64
+	err := db.SQL.QueryRowContext(ctx, "select sum(`abs_points`) from karma_totals where (? = '' or `team` = ?)", db.team, db.team).Scan(&res)
 
 	if err != nil {
 		return 0, err
 	}
 
-	return res, nil
+	return int(res.Int64), nil
 }
 
 // GetThrowback returns a random karma operation on a specific user
-func (db *DB) GetThrowback(user string) (*Throwback, error) {
+func (db *DB) GetThrowback(ctx context.Context, user string) (*Throwback, error) {
 	var (
 		record    = &Throwback{}
 		timestamp = ""
 	)
 
-	err := db.SQL.QueryRow("select `from`, `to`, `reason`, `points`, `timestamp` from karma where `to` = ? and `id` >= (abs(random()) % (select max(`id`) from karma)) limit 1", user).Scan(&record.From, &record.To, &record.Reason, &record.Points.Points, &timestamp)
+	err := db.SQL.QueryRowContext(ctx, "select `from`, `to`, `reason`, `points`, `team`, `timestamp` from karma where `to` = ? and (? = '' or `team` = ?) and `id` >= (abs(random()) % (select max(`id`) from karma)) limit 1", user, db.team, db.team).Scan(&record.From, &record.To, &record.Reason, &record.Points.Points, &record.Team, &timestamp)
 	switch err {
 	case nil:
 	case sql.ErrNoRows:
@@ -207,10 +569,74 @@ func (db *DB) GetThrowback(user string) (*Throwback, error) {
 		return nil, err
 	}
 
-	record.Timestamp, err = time.Parse("2006-01-02 15:04:05", timestamp)
+	record.Timestamp, err = time.Parse(timestampFormat, timestamp)
 	if err != nil {
 		return nil, err
 	}
 
 	return record, nil
 }
+
+// ClaimUnassigned moves all karma that was recorded before
+// karmabot supported multiple workspaces into a workspace, along
+// with the kinds of the names that received it. It returns the
+// number of karma operations that were moved.
+func (db *DB) ClaimUnassigned(ctx context.Context, team string) (int64, error) {
+	tx, err := db.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "update karma set `team` = ? where `team` = ''", team)
+	if err != nil {
+		return 0, err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// names that were classified in the workspace keep their kind
+	_, err = tx.ExecContext(ctx, "insert or ignore into kinds (`team`, `name`, `kind`) select ?, `name`, `kind` from kinds where `team` = ''", team)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, "delete from kinds where `team` = ''")
+	if err != nil {
+		return 0, err
+	}
+
+	return claimed, tx.Commit()
+}
+
+// SaveWorkspace records a workspace's ID and name so that
+// it can be listed by GetWorkspaces.
+func (db *DB) SaveWorkspace(ctx context.Context, workspace *Workspace) error {
+	_, err := db.SQL.ExecContext(ctx, "insert or replace into workspaces (`id`, `name`) values(?, ?)", workspace.ID, workspace.Name)
+
+	return err
+}
+
+// GetWorkspaces returns all known workspaces ordered by name.
+func (db *DB) GetWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `id`, `name` from workspaces order by `name`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []*Workspace
+	for rows.Next() {
+		workspace := &Workspace{}
+		err := rows.Scan(&workspace.ID, &workspace.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		workspaces = append(workspaces, workspace)
+	}
+
+	return workspaces, rows.Err()
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDB returns a new database in a temporary directory.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := New(&Config{Path: filepath.Join(t.TempDir(), "karma.sqlite3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+// totals returns every user's total points per workspace from the
+// karma_totals table and, separately, summed up from the karma table.
+func totals(t *testing.T, db *DB) (materialized, ledger map[string]int) {
+	t.Helper()
+
+	query := func(q string) map[string]int {
+		rows, err := db.SQL.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		totals := make(map[string]int)
+		for rows.Next() {
+			var (
+				team, user string
+				points     int
+			)
+			err := rows.Scan(&team, &user, &points)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			totals[team+"/"+user] = points
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		return totals
+	}
+
+	return query("select `team`, `user`, `points` from karma_totals"),
+		query("select `team`, `to`, sum(`points`) from karma group by `team`, `to`")
+}
+
+func TestUpdatePoints(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t).WithTeam("T1")
+	)
+
+	err := db.InsertPoints(ctx, &Points{From: "alice", To: "bob", Points: 2, Source: SourceMessage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen map[string]int
+	users, err := db.UpdatePoints(ctx, []string{"bob", "carol"}, func(totals map[string]int) ([]*Points, error) {
+		seen = totals
+		return []*Points{
+			{From: "admin", To: "bob", Points: -totals["bob"], Source: SourceAdmin},
+			{From: "alice", To: "carol", Points: 1, Source: SourceMessage},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seen["bob"] != 2 || seen["carol"] != 0 {
+		t.Errorf("fn got totals %v; want bob 2 and carol 0", seen)
+	}
+	if users["bob"].Points != 0 || users["carol"].Points != 1 {
+		t.Errorf("got bob %d and carol %d; want 0 and 1", users["bob"].Points, users["carol"].Points)
+	}
+
+	user, err := db.GetUser(ctx, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Points != 1 {
+		t.Errorf("got carol %d; want 1", user.Points)
+	}
+}
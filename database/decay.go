@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// A DecayModel determines how karma loses weight as it gets older.
+type DecayModel string
+
+// Decay models. With exponential decay, karma loses half of its weight
+// every Months months. With linear decay, karma loses weight at a
+// steady rate until it is worth nothing after Months months.
+const (
+	DecayExponential DecayModel = "exponential"
+	DecayLinear      DecayModel = "linear"
+)
+
+// DecayModels lists all decay models.
+var DecayModels = []DecayModel{DecayExponential, DecayLinear}
+
+// ParseDecayModel returns the decay model with the given name.
+func ParseDecayModel(name string) (DecayModel, error) {
+	for _, model := range DecayModels {
+		if string(model) == name {
+			return model, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown decay model %q", name)
+}
+
+// Decay configures karma decay in a workspace. Decay is applied when
+// karma is queried, so the recorded karma operations never change.
+// A Decay with an empty Team applies to workspaces that do not have
+// their own.
+type Decay struct {
+	Team   string     `json:"team,omitempty"`
+	Model  DecayModel `json:"model"`
+	Months float64    `json:"months"`
+}
+
+// Validate checks whether the decay model and its period are valid.
+func (d *Decay) Validate() error {
+	if _, err := ParseDecayModel(string(d.Model)); err != nil {
+		return err
+	}
+
+	if d.Months <= 0 || math.IsInf(d.Months, 0) || math.IsNaN(d.Months) {
+		return fmt.Errorf("the decay period must be a positive number of months, got %v", d.Months)
+	}
+
+	return nil
+}
+
+// ErrNoSuchDecay is returned when a workspace
+// does not have karma decay configured
+var ErrNoSuchDecay = errors.New("no such decay")
+
+// daysPerMonth is the average length of a month.
+const daysPerMonth = 365.25 / 12
+
+// decayWeight returns the weight of karma that was given ageDays days
+// ago. It is registered as the karma_decay SQL function.
+func decayWeight(model string, months, ageDays float64) float64 {
+	age := math.Max(ageDays, 0) / daysPerMonth
+
+	switch DecayModel(model) {
+	case DecayExponential:
+		return math.Pow(0.5, age/months)
+	case DecayLinear:
+		return math.Max(1-age/months, 0)
+	default:
+		return 1
+	}
+}
+
+// decayedPoints is an SQL expression that sums up the decayed points
+// of karma operations. Every operation decays with the decay of its own
+// workspace, falling back to the decay that applies to all workspaces,
+// so that karma decays the same way in the combined view of all
+// workspaces as in its workspace. Operations without any decay keep
+// their points.
+const decayedPoints = "sum(karma.`points` * coalesce((select karma_decay(decay.`model`, decay.`months`, julianday('now') - julianday(karma.`timestamp`)) from decay where decay.`team` in (karma.`team`, '') order by decay.`team` = '' limit 1), 1))"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("karma_decay", decayWeight, true)
+		},
+	})
+}
+
+// driverName is the name of the sqlite3 driver that
+// has karmabot's SQL functions registered.
+const driverName = "sqlite3_karmabot"
+
+func (db *DB) createDecayTable() error {
+	schema := strings.Replace(
+		`create table if not exists decay (
+			^team^ text primary key,
+			^model^ text not null,
+			^months^ real not null
+		)`,
+		"^", "`", -1)
+
+	_, err := db.SQL.Exec(schema)
+	return err
+}
+
+// GetDecay returns the karma decay of the DB's workspace, falling back
+// to the decay that applies to all workspaces. If the DB is not scoped
+// to a workspace, it returns the decay that applies to all workspaces,
+// or the decay of one of them if there is none, since every workspace's
+// karma decays with its own decay.
+func (db *DB) GetDecay(ctx context.Context) (*Decay, error) {
+	return db.getDecay(ctx, db.SQL)
+}
+
+func (db *DB) getDecay(ctx context.Context, q queryer) (*Decay, error) {
+	decay := &Decay{}
+	err := q.QueryRowContext(ctx, "select `team`, `model`, `months` from decay where (? = '' or `team` in (?, '')) order by `team` = ? desc, `team` = '' desc, `team` limit 1", db.team, db.team, db.team).Scan(&decay.Team, &decay.Model, &decay.Months)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoSuchDecay
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decay, nil
+}
+
+// GetDecays returns the karma decay of every workspace that has one.
+func (db *DB) GetDecays(ctx context.Context) ([]*Decay, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `team`, `model`, `months` from decay where (? = '' or `team` = ?) order by `team`", db.team, db.team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decays []*Decay
+	for rows.Next() {
+		decay := &Decay{}
+		err := rows.Scan(&decay.Team, &decay.Model, &decay.Months)
+		if err != nil {
+			return nil, err
+		}
+
+		decays = append(decays, decay)
+	}
+
+	return decays, rows.Err()
+}
+
+// SetDecay configures karma decay in the DB's workspace, or in all
+// workspaces without their own decay if the DB is not scoped to one.
+func (db *DB) SetDecay(ctx context.Context, decay *Decay) error {
+	if err := decay.Validate(); err != nil {
+		return err
+	}
+
+	_, err := db.SQL.ExecContext(ctx, "insert or replace into decay (`team`, `model`, `months`) values(?, ?, ?)", db.team, decay.Model, decay.Months)
+
+	return err
+}
+
+// DeleteDecay turns karma decay off in the DB's workspace.
+func (db *DB) DeleteDecay(ctx context.Context) error {
+	res, err := db.SQL.ExecContext(ctx, "delete from decay where `team` = ?", db.team)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, ErrNoSuchDecay)
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDecayWeight(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Model  DecayModel
+		Months float64
+		Age    float64 // in months
+		Expect float64
+	}{
+		{Name: "exponential, new", Model: DecayExponential, Months: 2, Age: 0, Expect: 1},
+		{Name: "exponential, one half-life", Model: DecayExponential, Months: 2, Age: 2, Expect: 0.5},
+		{Name: "exponential, two half-lives", Model: DecayExponential, Months: 2, Age: 4, Expect: 0.25},
+		{Name: "linear, new", Model: DecayLinear, Months: 4, Age: 0, Expect: 1},
+		{Name: "linear, halfway", Model: DecayLinear, Months: 4, Age: 2, Expect: 0.5},
+		{Name: "linear, expired", Model: DecayLinear, Months: 4, Age: 6, Expect: 0},
+		{Name: "from the future", Model: DecayLinear, Months: 4, Age: -1, Expect: 1},
+		{Name: "unknown model", Model: "unknown", Months: 4, Age: 2, Expect: 1},
+	}
+
+	for _, tc := range tt {
+		got := decayWeight(string(tc.Model), tc.Months, tc.Age*daysPerMonth)
+		if math.Abs(got-tc.Expect) > 1e-9 {
+			t.Errorf("%s: got weight %v; want %v", tc.Name, got, tc.Expect)
+		}
+	}
+}
+
+func TestGetDecay(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	_, err := db.WithTeam("T1").GetDecay(ctx)
+	if err != ErrNoSuchDecay {
+		t.Fatalf("got error %v without decay; want ErrNoSuchDecay", err)
+	}
+
+	err = db.WithTeam("T1").SetDecay(ctx, &Decay{Model: DecayLinear, Months: 0})
+	if err == nil {
+		t.Fatal("got no error for a decay period of 0 months")
+	}
+
+	err = db.WithTeam("T2").SetDecay(ctx, &Decay{Model: DecayLinear, Months: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a decay that applies to all workspaces, the combined
+	// view uses the decay of one of them
+	got, err := db.GetDecay(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Decay{Team: "T2", Model: DecayLinear, Months: 4}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got combined decay %+v; want %+v", got, want)
+	}
+
+	err = db.SetDecay(ctx, &Decay{Model: DecayExponential, Months: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// setting it again replaces it
+	err = db.WithTeam("T2").SetDecay(ctx, &Decay{Model: DecayExponential, Months: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name   string
+		Team   string
+		Expect *Decay
+	}{
+		{
+			Name:   "all workspaces",
+			Expect: &Decay{Model: DecayExponential, Months: 2},
+		},
+		{
+			Name:   "fallback",
+			Team:   "T1",
+			Expect: &Decay{Model: DecayExponential, Months: 2},
+		},
+		{
+			Name:   "own decay",
+			Team:   "T2",
+			Expect: &Decay{Team: "T2", Model: DecayExponential, Months: 6},
+		},
+	}
+
+	for _, tc := range tt {
+		got, err := db.WithTeam(tc.Team).GetDecay(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if !reflect.DeepEqual(got, tc.Expect) {
+			t.Errorf("%s: got decay %+v; want %+v", tc.Name, got, tc.Expect)
+		}
+	}
+
+	decays, err := db.GetDecays(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decays) != 2 || decays[0].Team != "" || decays[1].Team != "T2" {
+		t.Errorf("got decays %+v; want the decay of all workspaces and of T2", decays)
+	}
+
+	err = db.WithTeam("T2").DeleteDecay(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithTeam("T2").DeleteDecay(ctx)
+	if err != ErrNoSuchDecay {
+		t.Errorf("got error %v deleting a deleted decay; want ErrNoSuchDecay", err)
+	}
+
+	got, err = db.WithTeam("T2").GetDecay(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Team != "" {
+		t.Errorf("got decay %+v after deleting T2's; want the decay of all workspaces", got)
+	}
+}
+
+// insertAged records karma that was given the given
+// number of months ago.
+func insertAged(t *testing.T, db *DB, team, to string, points int, months float64) {
+	t.Helper()
+
+	_, err := db.SQL.Exec("insert into karma (`from`, `to`, `points`, `reason`, `team`, `timestamp`) values ('alice', ?, ?, '', ?, datetime('now', ?))", to, points, team, fmt.Sprintf("-%f days", months*daysPerMonth))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecayedTotals(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	insertAged(t, db, "T1", "bob", 8, 2)
+	insertAged(t, db, "T1", "carol", 4, 0)
+	insertAged(t, db, "T2", "bob", 8, 2)
+
+	// bob's karma in T1 loses half of its weight every month, and
+	// loses a fourth of its weight every month in T2
+	err := db.WithTeam("T1").SetDecay(ctx, &Decay{Model: DecayExponential, Months: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithTeam("T2").SetDecay(ctx, &Decay{Model: DecayLinear, Months: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name   string
+		Team   string
+		Expect map[string][2]int // name -> points, decayed
+	}{
+		{
+			Name:   "exponential",
+			Team:   "T1",
+			Expect: map[string][2]int{"carol": {4, 4}, "bob": {8, 2}},
+		},
+		{
+			Name:   "linear",
+			Team:   "T2",
+			Expect: map[string][2]int{"bob": {8, 4}},
+		},
+		{
+			Name:   "mixed",
+			Expect: map[string][2]int{"bob": {16, 6}, "carol": {4, 4}},
+		},
+	}
+
+	for _, tc := range tt {
+		db := db.WithTeam(tc.Team)
+
+		leaderboard, err := db.GetLeaderboard(ctx, "", 10)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if len(leaderboard) != len(tc.Expect) {
+			t.Fatalf("%s: got leaderboard %+v; want %d users", tc.Name, leaderboard, len(tc.Expect))
+		}
+		for i, user := range leaderboard {
+			if i > 0 && *user.Decayed > *leaderboard[i-1].Decayed {
+				t.Errorf("%s: %s ranks below %s with more decayed points", tc.Name, leaderboard[i-1].Name, user.Name)
+			}
+			if got := [2]int{user.Points, *user.Decayed}; got != tc.Expect[user.Name] {
+				t.Errorf("%s: got %s's leaderboard points %v; want %v", tc.Name, user.Name, got, tc.Expect[user.Name])
+			}
+		}
+
+		for name, want := range tc.Expect {
+			user, err := db.GetUser(ctx, name)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.Name, err)
+			}
+			if got := [2]int{user.Points, *user.Decayed}; got != want {
+				t.Errorf("%s: got %s's points %v; want %v", tc.Name, name, got, want)
+			}
+		}
+	}
+
+	// without decay, points are not decayed
+	for _, team := range []string{"T1", "T2"} {
+		err := db.WithTeam(team).DeleteDecay(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user, err := db.GetUser(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Points != 16 || user.Decayed != nil {
+		t.Errorf("got bob %+v without decay; want 16 points and no decayed points", user)
+	}
+}
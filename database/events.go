@@ -0,0 +1,88 @@
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+// A KarmaEvent is a karma record that was just inserted. ID is the
+// record's ID, Total is the resulting total of the user that received
+// the points, and Decayed their decayed total if the workspace has
+// karma decay.
+type KarmaEvent struct {
+	ID        int64     `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason"`
+	Team      string    `json:"team,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Points    int       `json:"points"`
+	Total     int       `json:"total"`
+	Decayed   *int      `json:"decayed,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// subscriberBuffer is the number of events that each subscriber
+// may have queued before new events are dropped for it.
+const subscriberBuffer = 64
+
+// events fans out karma events to subscribers. It is shared
+// by all copies of a DB that WithTeam returns, so that karma
+// inserted in one workspace reaches subscribers of all
+// workspaces combined as well.
+type events struct {
+	mu sync.Mutex
+
+	// subscribers maps each subscriber to the workspace
+	// that it is scoped to, if any.
+	subscribers map[chan *KarmaEvent]string
+}
+
+func newEvents() *events {
+	return &events{
+		subscribers: make(map[chan *KarmaEvent]string),
+	}
+}
+
+// Subscribe returns a channel that receives the karma records that are
+// inserted from now on, in the DB's workspace if it is scoped to one,
+// and a function that cancels the subscription and closes the channel.
+// Events are dropped for subscribers that do not keep up. Only karma
+// that is given through this process is published; karma from other
+// processes, imports and compaction can be found with LastRecordID and
+// WalkRecords.
+func (db *DB) Subscribe() (<-chan *KarmaEvent, func()) {
+	ch := make(chan *KarmaEvent, subscriberBuffer)
+
+	db.events.mu.Lock()
+	db.events.subscribers[ch] = db.team
+	db.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			db.events.mu.Lock()
+			delete(db.events.subscribers, ch)
+			db.events.mu.Unlock()
+
+			close(ch)
+		})
+	}
+}
+
+// publish sends an event to all subscribers of its workspace.
+func (e *events) publish(event *KarmaEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for ch, team := range e.subscribers {
+		if team != "" && team != event.Team {
+			continue
+		}
+
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	all, cancelAll := db.Subscribe()
+	defer cancelAll()
+	t1, cancelT1 := db.WithTeam("T1").Subscribe()
+	defer cancelT1()
+	t2, cancelT2 := db.WithTeam("T2").Subscribe()
+	defer cancelT2()
+
+	err := db.WithTeam("T1").InsertPoints(ctx, &Points{From: "alice", To: "bob", Points: 2, Source: SourceMessage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithTeam("T1").InsertPoints(ctx, &Points{From: "alice", To: "bob", Points: 3, Source: SourceMessage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ch := range map[string]<-chan *KarmaEvent{"all workspaces": all, "T1": t1} {
+		if len(ch) != 2 {
+			t.Fatalf("%s: got %d events; want 2", name, len(ch))
+		}
+
+		first, second := <-ch, <-ch
+		if first.Team != "T1" || first.To != "bob" || first.Points != 2 || first.Total != 2 {
+			t.Errorf("%s: got first event %+v; want 2 points and a total of 2", name, first)
+		}
+		if second.ID <= first.ID || second.Points != 3 || second.Total != 5 {
+			t.Errorf("%s: got second event %+v; want 3 points and a total of 5", name, second)
+		}
+	}
+
+	if len(t2) != 0 {
+		t.Errorf("T2: got event %+v for karma in T1", <-t2)
+	}
+
+	cancelT2()
+	cancelT2()
+	if _, ok := <-t2; ok {
+		t.Error("the channel is still open after cancelling the subscription")
+	}
+
+	// publishing must not block on subscribers that do not keep up
+	for i := 0; i < subscriberBuffer+1; i++ {
+		err = db.WithTeam("T1").InsertPoints(ctx, &Points{From: "alice", To: "carol", Points: 1, Source: SourceMessage})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(t1) != subscriberBuffer {
+		t.Errorf("got %d queued events; want %d", len(t1), subscriberBuffer)
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// An Edge sums up the karma that one user gave another.
+type Edge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Points int    `json:"points"`
+	Count  int    `json:"count"`
+}
+
+// GetEdges returns the total karma that every user gave every other
+// user in messages and reactji between since (inclusive) and until
+// (exclusive), ordered by giver and receiver. Karma that was set by
+// admins, karmabotctl or imports is left out, because its giver did
+// not actually give it. A zero since or until leaves that end of the
+// time range open.
+func (db *DB) GetEdges(ctx context.Context, since, until time.Time) ([]*Edge, error) {
+	var sinceS, untilS string
+	if !since.IsZero() {
+		sinceS = since.UTC().Format(timestampFormat)
+	}
+	if !until.IsZero() {
+		untilS = until.UTC().Format(timestampFormat)
+	}
+
+	rows, err := db.SQL.QueryContext(ctx, "select `from`, `to`, sum(`points`), count(*) from karma where (? = '' or `team` = ?) and (? = '' or `timestamp` >= ?) and (? = '' or `timestamp` < ?) and `source` in (?, ?) and `from` != `to` group by `from`, `to` order by `from`, `to`",
+		db.team, db.team,
+		sinceS, sinceS,
+		untilS, untilS,
+		SourceMessage, SourceReactji,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []*Edge
+	for rows.Next() {
+		edge := &Edge{}
+		err := rows.Scan(&edge.From, &edge.To, &edge.Points, &edge.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		edges = append(edges, edge)
+	}
+
+	return edges, rows.Err()
+}
+
+// GetUserNames returns the names of all users that have
+// received karma, in alphabetical order.
+func (db *DB) GetUserNames(ctx context.Context) ([]string, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select distinct `user` from karma_totals where (? = '' or `team` = ?) order by `user`", db.team, db.team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// A Kind tells people, who are Slack users, apart
+// from things and topics that receive karma.
+type Kind string
+
+// Kinds of names that receive karma.
+const (
+	KindPerson Kind = "person"
+	KindThing  Kind = "thing"
+)
+
+// ParseKind returns the kind with the given name.
+func ParseKind(name string) (Kind, error) {
+	switch kind := Kind(name); kind {
+	case KindPerson, KindThing:
+		return kind, nil
+	}
+
+	return "", fmt.Errorf("unknown kind %q, must be %s or %s", name, KindPerson, KindThing)
+}
+
+// The kinds table classifies names as people or things. Names are
+// classified by the bot when they receive karma, so names that only
+// received karma before kinds were tracked are not classified, and
+// count as people until they receive karma again.
+func (db *DB) createKindsTable() error {
+	var exists int
+	err := db.SQL.QueryRow("select count(*) from sqlite_master where `type` = 'table' and `name` = 'kinds'").Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.SQL.Exec(strings.Replace(
+		`create table if not exists kinds (
+			^team^ text not null,
+			^name^ text not null,
+			^kind^ text not null,
+			primary key (^team^, ^name^)
+		)`,
+		"^", "`", -1))
+	if err != nil {
+		return err
+	}
+
+	// everybody that has given karma in chat is a slack user
+	if exists == 0 {
+		_, err = db.SQL.Exec("insert or ignore into kinds (`team`, `name`, `kind`) select distinct `team`, `from`, ? from karma where `source` in ('', ?, ?, ?)", KindPerson, SourceMessage, SourceReactji, SourceAdmin)
+	}
+
+	return err
+}
+
+// GetKind returns whether a name in the DB's workspace, or in any
+// workspace if the DB is not scoped to one, is a person or a thing.
+// It returns an empty kind if the name was never classified.
+func (db *DB) GetKind(ctx context.Context, name string) (Kind, error) {
+	var kind Kind
+	err := db.SQL.QueryRowContext(ctx, "select `kind` from kinds where (? = '' or `team` = ?) and `name` = ? limit 1", db.team, db.team, name).Scan(&kind)
+
+	switch err {
+	case nil, sql.ErrNoRows:
+		return kind, nil
+	default:
+		return "", err
+	}
+}
+
+// SetKind classifies a name in the DB's workspace
+// as a person or a thing, replacing its previous kind.
+func (db *DB) SetKind(ctx context.Context, name string, kind Kind) error {
+	_, err := db.SQL.ExecContext(ctx, "insert or replace into kinds (`team`, `name`, `kind`) values(?, ?, ?)", db.team, name, kind)
+
+	return err
+}
+
+// kindFilter returns a condition that matches the rows of table whose
+// name column is of a kind, which is passed twice as an argument. Names
+// that were never classified are people, and an empty kind matches
+// every row.
+func kindFilter(table, name string) string {
+	return fmt.Sprintf("(? = '' or coalesce((select `kind` from kinds where kinds.`team` = %[1]s.`team` and kinds.`name` = %[1]s.`%[2]s`), '%[3]s') = ?)", table, name, KindPerson)
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClaimUnassignedKinds(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	// karma and kinds from before karmabot supported multiple workspaces
+	err := db.InsertPoints(ctx, &Points{From: "alice", To: "coffee", Points: 1, Source: SourceMessage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetKind(ctx, "coffee", KindThing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.SetKind(ctx, "bob", KindThing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.WithTeam("T1").SetKind(ctx, "bob", KindPerson)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := db.ClaimUnassigned(ctx, "T1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed != 1 {
+		t.Errorf("got %d operations claimed; want 1", claimed)
+	}
+
+	for name, want := range map[string]Kind{"coffee": KindThing, "bob": KindPerson} {
+		kind, err := db.WithTeam("T1").GetKind(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind != want {
+			t.Errorf("got %s a %s; want %s", name, kind, want)
+		}
+	}
+
+	leaderboard, err := db.WithTeam("T1").GetLeaderboard(ctx, KindPerson, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaderboard) != 0 {
+		t.Errorf("got people %+v; want coffee to remain a thing", leaderboard)
+	}
+}
@@ -0,0 +1,287 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// Backup writes a consistent snapshot of the database to a new file at
+// dest using SQLite's online backup API. It is safe to call while
+// karmabot is writing to the database.
+func (db *DB) Backup(ctx context.Context, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	return backup(ctx, db.SQL, dest)
+}
+
+// Restore replaces the database at dest with the backup at src, after
+// checking the backup's integrity. karmabot should not be running
+// while its database is being restored.
+func Restore(ctx context.Context, src, dest string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	srcDB, err := sql.Open("sqlite3", src)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	err = integrityCheck(ctx, srcDB)
+	if err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+
+	// make sure that this is a karmabot database
+	var tables int
+	err = srcDB.QueryRowContext(ctx, "select count(*) from sqlite_master where `type` = 'table' and `name` = 'karma'").Scan(&tables)
+	if err != nil {
+		return err
+	}
+	if tables == 0 {
+		return fmt.Errorf("%s is not a karmabot database", src)
+	}
+
+	return backup(ctx, srcDB, dest)
+}
+
+// IntegrityCheck runs SQLite's integrity check on the database.
+func (db *DB) IntegrityCheck(ctx context.Context) error {
+	return integrityCheck(ctx, db.SQL)
+}
+
+func integrityCheck(ctx context.Context, sqlDB *sql.DB) error {
+	var result string
+	err := sqlDB.QueryRowContext(ctx, "pragma integrity_check").Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	return nil
+}
+
+// backup copies the main database of src into the sqlite3 file at dest.
+func backup(ctx context.Context, src *sql.DB, dest string) error {
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			destSQLite, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected driver connection %T", destDriverConn)
+			}
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("unexpected driver connection %T", srcDriverConn)
+			}
+
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+
+			// copying all pages in a single step keeps the source
+			// locked for the duration, which guarantees a consistent
+			// snapshot. Step only reports busy or locked databases
+			// by returning false, so retry until it is done.
+			for {
+				done, err := b.Step(-1)
+				if err != nil {
+					b.Close()
+					return err
+				}
+				if done {
+					break
+				}
+
+				select {
+				case <-ctx.Done():
+					b.Close()
+					return ctx.Err()
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+
+			return b.Close()
+		})
+	})
+}
+
+// CompactStats describes the effect of compacting the database.
+type CompactStats struct {
+	// Rows is the number of karma operations that are rolled up,
+	// and Summaries is the number of summary rows that replace them.
+	Rows, Summaries int
+}
+
+// compactGroups selects the summary rows for all karma operations
+// before a point in time, per workspace, giver, receiver, source and
+// month. Positive and negative operations are summed up separately so
+// that the karma a user has given and received is not netted out.
+// Summary rows have the average timestamp of the operations that they
+// replace, so that compacted karma decays about as much as the
+// original operations did. Imported operations are left alone so that
+// re-importing the same data still has no effect.
+const compactGroups = "select `team`, `from`, `to`, `source`, sum(`points`), count(*) as `rows`, datetime(avg(julianday(`timestamp`))) from karma where (? = '' or `team` = ?) and `timestamp` < ? and `import_id` is null group by `team`, `from`, `to`, `source`, strftime('%Y-%m', `timestamp`), `points` > 0"
+
+// archiveColumns are the columns of karma operations that Compact copies
+// to an archive. They are listed explicitly so that archives keep working
+// when columns are added to the karma table later on.
+const archiveColumns = "`id`, `team`, `from`, `to`, `points`, `reason`, `timestamp`, `source`"
+
+var archiveSchema = strings.Replace(
+	`create table if not exists ^archive^.karma (
+		^id^ integer primary key,
+		^team^ text not null default '',
+		^from^ text not null,
+		^to^ text not null,
+		^points^ integer not null,
+		^reason^ text,
+		^timestamp^ text not null,
+		^source^ text not null default ''
+	)`,
+	"^", "`", -1)
+
+// CompactionStats returns what Compact would do without changing anything.
+func (db *DB) CompactionStats(ctx context.Context, before time.Time) (*CompactStats, error) {
+	stats := &CompactStats{}
+	err := db.SQL.QueryRowContext(ctx, "select coalesce(sum(`rows`), 0), count(*) from ("+compactGroups+")",
+		db.team, db.team, before.UTC().Format(timestampFormat)).Scan(&stats.Rows, &stats.Summaries)
+
+	return stats, err
+}
+
+// Compact rolls all karma operations before a point in time into a
+// positive and a negative summary row per workspace, giver, receiver,
+// source and month, so that totals stay the same while there are fewer
+// rows to sum up. Summary rows have the average timestamp of the
+// operations that they replace. If archive is not empty, the original
+// rows are copied to the karma table of the sqlite3 database at that
+// path first. Everything happens in a single transaction, and the
+// database is vacuumed afterwards.
+func (db *DB) Compact(ctx context.Context, before time.Time, archive string) (*CompactStats, error) {
+	conn, err := db.SQL.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	cutoff := before.UTC().Format(timestampFormat)
+	if archive != "" {
+		// attach can not be run inside of a transaction
+		_, err = conn.ExecContext(ctx, "attach database ? as `archive`", archive)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.ExecContext(context.Background(), "detach database `archive`")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if archive != "" {
+		_, err = tx.ExecContext(ctx, archiveSchema)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, "insert into `archive`.karma ("+archiveColumns+") select "+archiveColumns+" from main.karma where (? = '' or `team` = ?) and `timestamp` < ? and `import_id` is null", db.team, db.team, cutoff)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, compactGroups, db.team, db.team, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	type summary struct {
+		team, from, to, source, timestamp string
+		points, count                     int
+	}
+	var summaries []*summary
+	for rows.Next() {
+		s := &summary{}
+		err := rows.Scan(&s.team, &s.from, &s.to, &s.source, &s.points, &s.count, &s.timestamp)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		summaries = append(summaries, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, "delete from karma where (? = '' or `team` = ?) and `timestamp` < ? and `import_id` is null", db.team, db.team, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "insert into karma (`team`, `from`, `to`, `source`, `points`, `reason`, `timestamp`) values(?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for _, s := range summaries {
+		reason := fmt.Sprintf("%d karma operations before %s", s.count, before.UTC().Format("2006-01-02"))
+		_, err = stmt.ExecContext(ctx, s.team, s.from, s.to, s.source, s.points, reason, s.timestamp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx, "vacuum")
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompactStats{
+		Rows:      int(deleted),
+		Summaries: len(summaries),
+	}, nil
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		db   = newTestDB(t)
+		dir  = t.TempDir()
+		dest = filepath.Join(dir, "backup.sqlite3")
+	)
+
+	err := db.InsertPoints(ctx, &Points{From: "alice", To: "bob", Points: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Backup(ctx, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Backup(ctx, dest); err == nil {
+		t.Error("overwrote an existing backup")
+	}
+
+	restored := filepath.Join(dir, "restored.sqlite3")
+	err = Restore(ctx, dest, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rdb, err := New(&Config{Path: restored})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+
+	user, err := rdb.GetUser(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Points != 2 {
+		t.Errorf("got bob %d after restoring; want 2", user.Points)
+	}
+
+	// other sqlite3 databases are not restored
+	other := filepath.Join(dir, "other.sqlite3")
+	odb, err := sql.Open(driverName, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = odb.Exec("create table things (name text)")
+	odb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(ctx, other, restored); err == nil {
+		t.Error("restored a database that is not a karmabot database")
+	}
+	if err := Restore(ctx, filepath.Join(dir, "missing.sqlite3"), restored); err == nil {
+		t.Error("restored a missing database")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		db      = newTestDB(t).WithTeam("T1")
+		archive = filepath.Join(t.TempDir(), "archive.sqlite3")
+	)
+
+	_, err := db.SQL.Exec("insert into karma (`team`, `from`, `to`, `points`, `reason`, `timestamp`, `source`, `import_id`) values " +
+		"('T1', 'alice', 'bob', 3, 'a', '2019-01-02 00:00:00', 'message', null), " +
+		"('T1', 'alice', 'bob', 1, 'b', '2019-01-10 00:00:00', 'message', null), " +
+		"('T1', 'alice', 'bob', -2, 'c', '2019-01-20 00:00:00', 'message', null), " +
+		"('T1', 'alice', 'bob', 1, 'd', '2019-02-01 00:00:00', 'message', null), " +
+		"('T1', 'hubot', 'bob', 5, 'e', '2019-01-02 00:00:00', 'import', 'hubot:bob'), " +
+		"('T1', 'alice', 'bob', 1, 'f', '2020-06-01 00:00:00', 'message', null), " +
+		"('T2', 'alice', 'bob', 1, 'g', '2019-01-02 00:00:00', 'message', null)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sums := func() (points, absPoints int) {
+		err := db.SQL.QueryRow("select sum(`points`), sum(`abs_points`) from karma_totals where `team` = 'T1'").Scan(&points, &absPoints)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	points, absPoints := sums()
+
+	before := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats, err := db.CompactionStats(ctx, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// January has a positive and a negative summary, February one
+	want := &CompactStats{Rows: 4, Summaries: 3}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got stats %+v; want %+v", stats, want)
+	}
+
+	stats, err = db.Compact(ctx, before, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got stats %+v after compacting; want %+v", stats, want)
+	}
+
+	if p, a := sums(); p != points || a != absPoints {
+		t.Errorf("got points %d and abs points %d; want %d and %d", p, a, points, absPoints)
+	}
+	materialized, ledger := totals(t, db)
+	if !reflect.DeepEqual(materialized, ledger) {
+		t.Errorf("got totals %v; want the ledger %v", materialized, ledger)
+	}
+
+	var rows int
+	err = db.SQL.QueryRow("select count(*) from karma").Scan(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 6 {
+		t.Errorf("got %d rows; want 6", rows)
+	}
+
+	var timestamp string
+	err = db.SQL.QueryRow("select `timestamp` from karma where `team` = 'T1' and `points` = 4").Scan(&timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp != "2019-01-06 00:00:00" {
+		t.Errorf("got summary timestamp %s; want the average 2019-01-06 00:00:00", timestamp)
+	}
+
+	adb, err := sql.Open(driverName, archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer adb.Close()
+
+	err = adb.QueryRow("select count(*) from karma").Scan(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 4 {
+		t.Errorf("got %d archived rows; want 4", rows)
+	}
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// A DailyTotal is a user's total points at the end of a day,
+// and the points that they received on that day.
+type DailyTotal struct {
+	Date   time.Time `json:"date"`
+	Points int       `json:"points"`
+	Total  int       `json:"total"`
+}
+
+// dateFormat is the format that sqlite's date() uses.
+const dateFormat = "2006-01-02"
+
+// GetRank returns a user's position in the leaderboard of a kind,
+// or of everybody if kind is empty, starting at 1. Users with the
+// same points share a rank.
+func (db *DB) GetRank(ctx context.Context, kind Kind, name string) (int, error) {
+	user, err := db.GetUser(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var higher int
+	if user.Decayed != nil {
+		err = db.SQL.QueryRowContext(ctx, "select count(*) from (select "+decayedPoints+" as `decayed` from karma where (? = '' or `team` = ?) and "+kindFilter("karma", "to")+" group by `to`) where round(`decayed`) > ?", db.team, db.team, kind, kind, *user.Decayed).Scan(&higher)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		err = db.SQL.QueryRowContext(ctx, "select count(*) from (select sum(`points`) as `points` from karma_totals where (? = '' or `team` = ?) and "+kindFilter("karma_totals", "user")+" group by `user`) where `points` > ?", db.team, db.team, kind, kind, user.Points).Scan(&higher)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return higher + 1, nil
+}
+
+// GetDailyTotals returns a user's total points at the end of every day
+// on which they received karma, in chronological order.
+func (db *DB) GetDailyTotals(ctx context.Context, name string) ([]*DailyTotal, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select date(`timestamp`) as `date`, sum(`points`) from karma where `to` = ? and (? = '' or `team` = ?) group by `date` order by `date`", name, db.team, db.team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		totals []*DailyTotal
+		total  int
+	)
+	for rows.Next() {
+		var (
+			day  = &DailyTotal{}
+			date string
+		)
+
+		err := rows.Scan(&date, &day.Points)
+		if err != nil {
+			return nil, err
+		}
+
+		day.Date, err = time.Parse(dateFormat, date)
+		if err != nil {
+			return nil, err
+		}
+
+		total += day.Points
+		day.Total = total
+		totals = append(totals, day)
+	}
+
+	return totals, rows.Err()
+}
+
+// GetTopGivers returns the users that gave a user the most
+// points, along with the number of points that each gave.
+func (db *DB) GetTopGivers(ctx context.Context, name string, limit int) ([]*User, error) {
+	return db.getUserPoints(ctx, "select `from`, sum(`points`) as `points` from karma where `to` = ? and (? = '' or `team` = ?) group by `from` order by `points` desc limit ?", name, limit)
+}
+
+// GetTopRecipients returns the users that a user gave the most
+// points to, along with the number of points that each received.
+func (db *DB) GetTopRecipients(ctx context.Context, name string, limit int) ([]*User, error) {
+	return db.getUserPoints(ctx, "select `to`, sum(`points`) as `points` from karma where `from` = ? and (? = '' or `team` = ?) group by `to` order by `points` desc limit ?", name, limit)
+}
+
+func (db *DB) getUserPoints(ctx context.Context, query, name string, limit int) ([]*User, error) {
+	rows, err := db.SQL.QueryContext(ctx, query, name, db.team, db.team, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(&user.Name, &user.Points)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// GetUserRecords returns the karma operations that a user received,
+// newest first.
+func (db *DB) GetUserRecords(ctx context.Context, name string, limit, offset int) ([]*Record, error) {
+	return db.getUserRecords(ctx, "`to`", name, limit, offset)
+}
+
+// GetGivenRecords returns the karma operations that a user made,
+// newest first.
+func (db *DB) GetGivenRecords(ctx context.Context, name string, limit, offset int) ([]*Record, error) {
+	return db.getUserRecords(ctx, "`from`", name, limit, offset)
+}
+
+// getUserRecords returns the karma operations whose column is name.
+func (db *DB) getUserRecords(ctx context.Context, column, name string, limit, offset int) ([]*Record, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `id`, `team`, `timestamp`, `from`, `to`, `points`, coalesce(`reason`, ''), `source` from karma where "+column+" = ? and (? = '' or `team` = ?) order by `id` desc limit ? offset ?", name, db.team, db.team, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*Record
+	for rows.Next() {
+		var (
+			record    = &Record{}
+			timestamp string
+		)
+
+		err := rows.Scan(&record.ID, &record.Team, &timestamp, &record.From, &record.To, &record.Points, &record.Reason, &record.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Timestamp, err = time.Parse(timestampFormat, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// GetLeaderboardSince returns the top X users of a kind, or of any
+// kind if kind is empty, with the most points received since a point
+// in time, in order. Karma decay does not apply to it.
+func (db *DB) GetLeaderboardSince(ctx context.Context, kind Kind, since time.Time, limit int) (Leaderboard, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `to`, sum(`points`) as `points` from karma where `timestamp` >= ? and (? = '' or `team` = ?) and "+kindFilter("karma", "to")+" group by `to` having sum(`points`) != 0 order by `points` desc, `to` limit ?", since.UTC().Format(timestampFormat), db.team, db.team, kind, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaderboard Leaderboard
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(&user.Name, &user.Points)
+		if err != nil {
+			return nil, err
+		}
+
+		leaderboard = append(leaderboard, user)
+	}
+
+	return leaderboard, rows.Err()
+}
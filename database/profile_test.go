@@ -0,0 +1,346 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// insertAt records karma in a workspace at a point in time.
+func insertAt(t *testing.T, db *DB, team, from, to string, points int, timestamp string) {
+	t.Helper()
+
+	_, err := db.SQL.Exec("insert into karma (`from`, `to`, `points`, `reason`, `team`, `timestamp`) values (?, ?, ?, '', ?, ?)", from, to, points, team, timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetRank(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	for _, p := range []*Points{
+		{Team: "T1", From: "alice", To: "coffee", Points: 10},
+		{Team: "T1", From: "alice", To: "bob", Points: 5},
+		{Team: "T1", From: "alice", To: "carol", Points: 5},
+		{Team: "T1", From: "alice", To: "dave", Points: 3},
+		{Team: "T2", From: "alice", To: "dave", Points: 10},
+	} {
+		err := db.WithTeam(p.Team).InsertPoints(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.WithTeam("T1").SetKind(ctx, "coffee", KindThing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name   string
+		Team   string
+		Kind   Kind
+		User   string
+		Expect int
+	}{
+		{
+			Name:   "everybody",
+			Team:   "T1",
+			User:   "dave",
+			Expect: 4,
+		},
+		{
+			Name:   "people",
+			Team:   "T1",
+			Kind:   KindPerson,
+			User:   "dave",
+			Expect: 3,
+		},
+		{
+			Name:   "shared rank",
+			Team:   "T1",
+			Kind:   KindPerson,
+			User:   "carol",
+			Expect: 1,
+		},
+		{
+			Name:   "things",
+			Team:   "T1",
+			Kind:   KindThing,
+			User:   "coffee",
+			Expect: 1,
+		},
+		{
+			Name:   "all workspaces",
+			User:   "dave",
+			Expect: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		rank, err := db.WithTeam(tc.Team).GetRank(ctx, tc.Kind, tc.User)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if rank != tc.Expect {
+			t.Errorf("%s: got %s ranked %d; want %d", tc.Name, tc.User, rank, tc.Expect)
+		}
+	}
+
+	_, err = db.WithTeam("T2").GetRank(ctx, "", "bob")
+	if err != ErrNoSuchUser {
+		t.Errorf("got error %v for a user of another workspace; want ErrNoSuchUser", err)
+	}
+}
+
+func TestGetDailyTotals(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	insertAt(t, db, "T1", "alice", "bob", 2, "2020-01-01 09:00:00")
+	insertAt(t, db, "T1", "carol", "bob", 3, "2020-01-01 23:00:00")
+	insertAt(t, db, "T1", "alice", "bob", -1, "2020-01-03 12:00:00")
+	insertAt(t, db, "T2", "alice", "bob", 7, "2020-01-02 12:00:00")
+	insertAt(t, db, "T1", "bob", "alice", 4, "2020-01-02 12:00:00")
+
+	days, err := db.WithTeam("T1").GetDailyTotals(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*DailyTotal{
+		{Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Points: 5, Total: 5},
+		{Date: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), Points: -1, Total: 4},
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("got daily totals %+v; want %+v", days, want)
+	}
+
+	days, err = db.GetDailyTotals(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 3 || days[2].Total != 11 {
+		t.Errorf("got daily totals %+v in all workspaces; want 3 days and a total of 11", days)
+	}
+}
+
+func TestTopGiversAndRecipients(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	for _, p := range []*Points{
+		{Team: "T1", From: "alice", To: "bob", Points: 2},
+		{Team: "T1", From: "alice", To: "bob", Points: 2},
+		{Team: "T1", From: "carol", To: "bob", Points: 3},
+		{Team: "T1", From: "dave", To: "bob", Points: 1},
+		{Team: "T1", From: "alice", To: "carol", Points: 1},
+		{Team: "T2", From: "dave", To: "bob", Points: 10},
+	} {
+		err := db.WithTeam(p.Team).InsertPoints(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		Name   string
+		Query  func(ctx context.Context, name string, limit int) ([]*User, error)
+		User   string
+		Limit  int
+		Expect []*User
+	}{
+		{
+			Name:   "givers",
+			Query:  db.WithTeam("T1").GetTopGivers,
+			User:   "bob",
+			Limit:  10,
+			Expect: []*User{{Name: "alice", Points: 4}, {Name: "carol", Points: 3}, {Name: "dave", Points: 1}},
+		},
+		{
+			Name:   "givers limit",
+			Query:  db.WithTeam("T1").GetTopGivers,
+			User:   "bob",
+			Limit:  1,
+			Expect: []*User{{Name: "alice", Points: 4}},
+		},
+		{
+			Name:   "givers in all workspaces",
+			Query:  db.GetTopGivers,
+			User:   "bob",
+			Limit:  1,
+			Expect: []*User{{Name: "dave", Points: 11}},
+		},
+		{
+			Name:   "recipients",
+			Query:  db.WithTeam("T1").GetTopRecipients,
+			User:   "alice",
+			Limit:  10,
+			Expect: []*User{{Name: "bob", Points: 4}, {Name: "carol", Points: 1}},
+		},
+		{
+			Name:  "recipients in another workspace",
+			Query: db.WithTeam("T2").GetTopRecipients,
+			User:  "alice",
+			Limit: 10,
+		},
+	}
+
+	for _, tc := range tt {
+		users, err := tc.Query(ctx, tc.User, tc.Limit)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if !reflect.DeepEqual(users, tc.Expect) {
+			t.Errorf("%s: got %+v; want %+v", tc.Name, users, tc.Expect)
+		}
+	}
+}
+
+func TestGetUserRecords(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	insertAt(t, db, "T1", "alice", "bob", 1, "2020-01-01 00:00:00")
+	insertAt(t, db, "T1", "bob", "alice", 2, "2020-01-02 00:00:00")
+	insertAt(t, db, "T2", "alice", "bob", 3, "2020-01-03 00:00:00")
+	insertAt(t, db, "T1", "carol", "bob", 4, "2020-01-04 00:00:00")
+	insertAt(t, db, "T1", "alice", "bob", 5, "2020-01-05 00:00:00")
+
+	tt := []struct {
+		Name   string
+		Query  func(ctx context.Context, name string, limit, offset int) ([]*Record, error)
+		User   string
+		Limit  int
+		Offset int
+		Expect []int64
+	}{
+		{
+			Name:   "received",
+			Query:  db.WithTeam("T1").GetUserRecords,
+			User:   "bob",
+			Limit:  10,
+			Expect: []int64{5, 4, 1},
+		},
+		{
+			Name:   "received in all workspaces",
+			Query:  db.GetUserRecords,
+			User:   "bob",
+			Limit:  10,
+			Expect: []int64{5, 4, 3, 1},
+		},
+		{
+			Name:   "received page",
+			Query:  db.WithTeam("T1").GetUserRecords,
+			User:   "bob",
+			Limit:  1,
+			Offset: 1,
+			Expect: []int64{4},
+		},
+		{
+			Name:   "given",
+			Query:  db.WithTeam("T1").GetGivenRecords,
+			User:   "alice",
+			Limit:  10,
+			Expect: []int64{5, 1},
+		},
+		{
+			Name:  "given in another workspace",
+			Query: db.WithTeam("T2").GetGivenRecords,
+			User:  "bob",
+			Limit: 10,
+		},
+	}
+
+	for _, tc := range tt {
+		records, err := tc.Query(ctx, tc.User, tc.Limit, tc.Offset)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+
+		var ids []int64
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+		if !reflect.DeepEqual(ids, tc.Expect) {
+			t.Errorf("%s: got records %v; want %v", tc.Name, ids, tc.Expect)
+		}
+	}
+
+	records, err := db.GetGivenRecords(ctx, "bob", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Record{ID: 2, Team: "T1", Timestamp: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), From: "bob", To: "alice", Points: 2}
+	if len(records) != 1 || !reflect.DeepEqual(records[0], want) {
+		t.Errorf("got records %+v; want %+v", records, want)
+	}
+}
+
+func TestGetLeaderboardSince(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	insertAt(t, db, "T1", "alice", "bob", 10, "2020-01-01 00:00:00")
+	insertAt(t, db, "T1", "alice", "bob", 2, "2020-02-01 00:00:00")
+	insertAt(t, db, "T1", "alice", "carol", 3, "2020-02-01 00:00:00")
+	insertAt(t, db, "T1", "alice", "dave", 2, "2020-02-01 00:00:00")
+	insertAt(t, db, "T1", "alice", "dave", -2, "2020-02-02 00:00:00")
+	insertAt(t, db, "T1", "alice", "coffee", 5, "2020-02-01 00:00:00")
+	insertAt(t, db, "T2", "alice", "bob", 4, "2020-02-01 00:00:00")
+
+	err := db.WithTeam("T1").SetKind(ctx, "coffee", KindThing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+	tt := []struct {
+		Name   string
+		Team   string
+		Kind   Kind
+		Limit  int
+		Expect Leaderboard
+	}{
+		{
+			Name:   "everybody",
+			Team:   "T1",
+			Limit:  10,
+			Expect: Leaderboard{{Name: "coffee", Points: 5}, {Name: "carol", Points: 3}, {Name: "bob", Points: 2}},
+		},
+		{
+			Name:   "people",
+			Team:   "T1",
+			Kind:   KindPerson,
+			Limit:  1,
+			Expect: Leaderboard{{Name: "carol", Points: 3}},
+		},
+		{
+			Name:   "all workspaces",
+			Limit:  2,
+			Expect: Leaderboard{{Name: "bob", Points: 6}, {Name: "coffee", Points: 5}},
+		},
+	}
+
+	for _, tc := range tt {
+		leaderboard, err := db.WithTeam(tc.Team).GetLeaderboardSince(ctx, tc.Kind, since, tc.Limit)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if !reflect.DeepEqual(leaderboard, tc.Expect) {
+			t.Errorf("%s: got %+v; want %+v", tc.Name, leaderboard, tc.Expect)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A Record is a karma operation as it is stored in the database.
+type Record struct {
+	ID        int64     `json:"id"`
+	Team      string    `json:"workspace"`
+	Timestamp time.Time `json:"timestamp"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Points    int       `json:"points"`
+	Reason    string    `json:"reason"`
+	Source    string    `json:"source"`
+
+	// ImportID identifies a record that was imported from another bot.
+	// Importing a record whose ImportID has already been imported into
+	// the same workspace has no effect.
+	ImportID string `json:"-"`
+}
+
+// A RecordQuery filters karma operations. Empty fields match all
+// operations. Since is inclusive and Until is exclusive. AfterID
+// only matches operations that were recorded after the one with
+// that ID.
+type RecordQuery struct {
+	From, To, Source string
+	Since, Until     time.Time
+	AfterID          int64
+}
+
+// timestampFormat is the format that sqlite's datetime() uses.
+const timestampFormat = "2006-01-02 15:04:05"
+
+// WalkRecords calls fn for every karma operation in the DB's workspace,
+// or in all workspaces if the DB is not scoped to one, that matches the
+// query, in the order that they were recorded. Records are read one at
+// a time, so that large databases can be exported without loading them
+// into memory. WalkRecords stops and returns the error if fn fails.
+func (db *DB) WalkRecords(ctx context.Context, query *RecordQuery, fn func(*Record) error) error {
+	var since, until string
+	if !query.Since.IsZero() {
+		since = query.Since.UTC().Format(timestampFormat)
+	}
+	if !query.Until.IsZero() {
+		until = query.Until.UTC().Format(timestampFormat)
+	}
+
+	rows, err := db.SQL.QueryContext(ctx, "select `id`, `team`, `timestamp`, `from`, `to`, `points`, coalesce(`reason`, ''), `source` from karma where (? = '' or `team` = ?) and (? = '' or `from` = ?) and (? = '' or `to` = ?) and (? = '' or `source` = ?) and (? = '' or `timestamp` >= ?) and (? = '' or `timestamp` < ?) and `id` > ? order by `id`",
+		db.team, db.team,
+		query.From, query.From,
+		query.To, query.To,
+		query.Source, query.Source,
+		since, since,
+		until, until,
+		query.AfterID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			record    = &Record{}
+			timestamp string
+		)
+
+		err := rows.Scan(&record.ID, &record.Team, &timestamp, &record.From, &record.To, &record.Points, &record.Reason, &record.Source)
+		if err != nil {
+			return err
+		}
+
+		record.Timestamp, err = time.Parse(timestampFormat, timestamp)
+		if err != nil {
+			return err
+		}
+
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// LastRecordID returns the ID of the latest karma operation in the
+// DB's workspace, or in all workspaces if the DB is not scoped to
+// one. It returns 0 if there are none.
+func (db *DB) LastRecordID(ctx context.Context) (int64, error) {
+	var id int64
+	err := db.SQL.QueryRowContext(ctx, "select coalesce(max(`id`), 0) from karma where (? = '' or `team` = ?)", db.team, db.team).Scan(&id)
+
+	return id, err
+}
+
+// ImportRecords inserts records that were imported from another bot in
+// a single transaction, keeping their timestamps. Records without a
+// workspace are imported into the DB's workspace, and records without a
+// timestamp are recorded as of now. Records whose ImportID has already
+// been imported are skipped. ImportRecords returns the number of records
+// that were inserted.
+func (db *DB) ImportRecords(ctx context.Context, records []*Record) (int, error) {
+	tx, err := db.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	inserted, err := db.importRecords(ctx, tx, records)
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, tx.Commit()
+}
+
+// ImportTotals imports records whose Points are running totals, such
+// as the scores of bots that do not keep every karma operation, like
+// ImportRecords. Only the difference to the points that were imported
+// with a record's ImportID before is inserted, so that newer data can
+// be imported on top of older data, and records whose total has not
+// changed are skipped. The inserted records get the ImportID followed
+// by @ and the number of times that it was imported.
+func (db *DB) ImportTotals(ctx context.Context, records []*Record) (int, error) {
+	tx, err := db.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var changed []*Record
+	for _, record := range records {
+		team := record.Team
+		if team == "" {
+			team = db.team
+		}
+
+		var imported, count int
+		err := tx.QueryRowContext(ctx, "select coalesce(sum(`points`), 0), count(*) from karma where `team` = ? and (`import_id` = ? or (substr(`import_id`, 1, length(?) + 1) = ? || '@' and cast(cast(substr(`import_id`, length(?) + 2) as integer) as text) = substr(`import_id`, length(?) + 2)))", team, record.ImportID, record.ImportID, record.ImportID, record.ImportID, record.ImportID).Scan(&imported, &count)
+		if err != nil {
+			return 0, err
+		}
+		if record.Points == imported {
+			continue
+		}
+
+		difference := *record
+		difference.Points = record.Points - imported
+		difference.ImportID = fmt.Sprintf("%s@%d", record.ImportID, count+1)
+		changed = append(changed, &difference)
+	}
+
+	inserted, err := db.importRecords(ctx, tx, changed)
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, tx.Commit()
+}
+
+func (db *DB) importRecords(ctx context.Context, tx *sql.Tx, records []*Record) (int, error) {
+	stmt, err := tx.PrepareContext(ctx, "insert or ignore into karma (`team`, `timestamp`, `from`, `to`, `points`, `reason`, `source`, `import_id`) values(?, coalesce(?, datetime('now')), ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	inserted := 0
+	for _, record := range records {
+		team := record.Team
+		if team == "" {
+			team = db.team
+		}
+
+		var timestamp sql.NullString
+		if !record.Timestamp.IsZero() {
+			timestamp = sql.NullString{String: record.Timestamp.UTC().Format(timestampFormat), Valid: true}
+		}
+
+		var importID sql.NullString
+		if record.ImportID != "" {
+			importID = sql.NullString{String: record.ImportID, Valid: true}
+		}
+
+		res, err := stmt.ExecContext(ctx, team, timestamp, record.From, record.To, record.Points, record.Reason, record.Source, importID)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		inserted += int(n)
+	}
+
+	return inserted, nil
+}
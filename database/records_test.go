@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportRecords(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t).WithTeam("T1")
+	)
+
+	records := []*Record{
+		{From: "hubot", To: "bob", Points: 3, ImportID: "a", Timestamp: time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{From: "hubot", To: "bob", Points: 2, ImportID: "b"},
+		{Team: "T2", From: "hubot", To: "bob", Points: 1, ImportID: "a"},
+	}
+
+	inserted, err := db.ImportRecords(ctx, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted != 3 {
+		t.Errorf("got %d records inserted; want 3", inserted)
+	}
+
+	// importing the same records again has no effect
+	inserted, err = db.ImportRecords(ctx, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted != 0 {
+		t.Errorf("got %d records inserted again; want 0", inserted)
+	}
+
+	user, err := db.GetUser(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Points != 5 {
+		t.Errorf("got bob %d in T1; want 5", user.Points)
+	}
+
+	var first *Record
+	err = db.WalkRecords(ctx, &RecordQuery{}, func(record *Record) error {
+		if first == nil {
+			first = record
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Timestamp.Equal(records[0].Timestamp) {
+		t.Errorf("got timestamp %v; want %v", first.Timestamp, records[0].Timestamp)
+	}
+
+	// records without an import ID are never deduplicated
+	for i := 0; i < 2; i++ {
+		_, err = db.ImportRecords(ctx, []*Record{{From: "hubot", To: "carol", Points: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, err = db.GetUser(ctx, "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Points != 2 {
+		t.Errorf("got carol %d; want 2", user.Points)
+	}
+}
+
+func TestImportTotals(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t).WithTeam("T1")
+	)
+
+	// karma that earlier versions imported with the plain ImportID
+	// counts towards its total
+	_, err := db.ImportRecords(ctx, []*Record{{From: "hubot", To: "bob", Points: 3, ImportID: "bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name           string
+		Totals         map[string]int
+		ExpectInserted int
+		Expect         map[string]int
+	}{
+		{
+			Name:           "same totals",
+			Totals:         map[string]int{"bob": 3},
+			ExpectInserted: 0,
+			Expect:         map[string]int{"T1/bob": 3},
+		},
+		{
+			Name:           "higher totals",
+			Totals:         map[string]int{"bob": 5, "carol": 2},
+			ExpectInserted: 2,
+			Expect:         map[string]int{"T1/bob": 5, "T1/carol": 2},
+		},
+		{
+			Name:           "lower totals",
+			Totals:         map[string]int{"bob": 3, "carol": 2},
+			ExpectInserted: 1,
+			Expect:         map[string]int{"T1/bob": 3, "T1/carol": 2},
+		},
+		{
+			// the ImportIDs of the differences do not clash
+			// with the ones that were imported before
+			Name:           "higher totals again",
+			Totals:         map[string]int{"bob": 5, "carol": 2},
+			ExpectInserted: 1,
+			Expect:         map[string]int{"T1/bob": 5, "T1/carol": 2},
+		},
+		{
+			// an ImportID that starts with another one
+			// does not count towards its total
+			Name:           "similar ImportID",
+			Totals:         map[string]int{"bob": 5, "bob@x": 1},
+			ExpectInserted: 1,
+			Expect:         map[string]int{"T1/bob": 6, "T1/carol": 2},
+		},
+	}
+
+	for _, tc := range tt {
+		var records []*Record
+		for id, points := range tc.Totals {
+			records = append(records, &Record{From: "hubot", To: strings.Split(id, "@")[0], Points: points, ImportID: id})
+		}
+
+		inserted, err := db.ImportTotals(ctx, records)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if inserted != tc.ExpectInserted {
+			t.Errorf("%s: got %d records inserted; want %d", tc.Name, inserted, tc.ExpectInserted)
+		}
+
+		materialized, _ := totals(t, db)
+		if !reflect.DeepEqual(materialized, tc.Expect) {
+			t.Errorf("%s: got totals %v; want %v", tc.Name, materialized, tc.Expect)
+		}
+	}
+}
+
+func TestWalkRecords(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+		day = func(d int) time.Time { return time.Date(2020, 1, d, 12, 0, 0, 0, time.UTC) }
+	)
+
+	_, err := db.ImportRecords(ctx, []*Record{
+		{Team: "T1", From: "alice", To: "bob", Points: 1, Source: SourceMessage, Timestamp: day(1)},
+		{Team: "T1", From: "alice", To: "carol", Points: 2, Source: SourceReactji, Timestamp: day(2)},
+		{Team: "T2", From: "bob", To: "carol", Points: 3, Source: SourceMessage, Timestamp: day(3)},
+		{Team: "T1", From: "carol", To: "bob", Points: 4, Source: SourceAdmin, Timestamp: day(4)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		Name   string
+		Team   string
+		Query  *RecordQuery
+		Expect []int
+	}{
+		{
+			Name:   "all",
+			Query:  &RecordQuery{},
+			Expect: []int{1, 2, 3, 4},
+		},
+		{
+			Name:   "workspace",
+			Team:   "T1",
+			Query:  &RecordQuery{},
+			Expect: []int{1, 2, 4},
+		},
+		{
+			Name:   "user",
+			Query:  &RecordQuery{To: "carol"},
+			Expect: []int{2, 3},
+		},
+		{
+			Name:   "giver",
+			Query:  &RecordQuery{From: "alice"},
+			Expect: []int{1, 2},
+		},
+		{
+			Name:   "source",
+			Query:  &RecordQuery{Source: SourceMessage},
+			Expect: []int{1, 3},
+		},
+		{
+			Name:   "date range",
+			Query:  &RecordQuery{Since: day(2), Until: day(4)},
+			Expect: []int{2, 3},
+		},
+		{
+			Name:   "since the middle of a day",
+			Query:  &RecordQuery{Since: day(2).Add(time.Minute)},
+			Expect: []int{3, 4},
+		},
+		{
+			Name:   "after an ID",
+			Team:   "T1",
+			Query:  &RecordQuery{AfterID: 2},
+			Expect: []int{4},
+		},
+		{
+			Name:   "combined",
+			Team:   "T1",
+			Query:  &RecordQuery{To: "bob", Since: day(2)},
+			Expect: []int{4},
+		},
+	}
+
+	for _, tc := range tt {
+		var points []int
+		err := db.WithTeam(tc.Team).WalkRecords(ctx, tc.Query, func(record *Record) error {
+			points = append(points, record.Points)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+		if !reflect.DeepEqual(points, tc.Expect) {
+			t.Errorf("%s: got records %v; want %v", tc.Name, points, tc.Expect)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A Role determines what a user is allowed to do.
+type Role string
+
+// Roles, from least to most privileged.
+const (
+	RoleReadOnly  Role = "read-only"
+	RoleMember    Role = "member"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles lists all roles from least to most privileged.
+var Roles = []Role{RoleReadOnly, RoleMember, RoleModerator, RoleAdmin}
+
+// ParseRole returns the role with the given name.
+func ParseRole(name string) (Role, error) {
+	for _, role := range Roles {
+		if string(role) == name {
+			return role, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown role %q", name)
+}
+
+// AtLeast checks whether r is as privileged as other.
+func (r Role) AtLeast(other Role) bool {
+	return r.rank() >= other.rank()
+}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// A UserRole assigns a role to a Slack user.
+type UserRole struct {
+	Team string `json:"team,omitempty"`
+	User string `json:"user"`
+	Role Role   `json:"role"`
+}
+
+// ErrNoSuchRole is returned when a user
+// has not been assigned a role
+var ErrNoSuchRole = errors.New("no such role")
+
+func (db *DB) createRolesTable() error {
+	schema := strings.Replace(
+		`create table if not exists roles (
+			^team^ text not null,
+			^user^ text not null,
+			^role^ text not null,
+			primary key (^team^, ^user^)
+		)`,
+		"^", "`", -1)
+
+	_, err := db.SQL.Exec(schema)
+	return err
+}
+
+// GetRole returns the role of a Slack user in the DB's workspace.
+func (db *DB) GetRole(ctx context.Context, user string) (Role, error) {
+	var role Role
+	err := db.SQL.QueryRowContext(ctx, "select `role` from roles where `team` = ? and `user` = ?", db.team, user).Scan(&role)
+
+	switch err {
+	case nil:
+		return role, nil
+	case sql.ErrNoRows:
+		return "", ErrNoSuchRole
+	default:
+		return "", err
+	}
+}
+
+// GetRoles returns all assigned roles in the DB's workspace,
+// or in all workspaces if the DB is not scoped to one.
+func (db *DB) GetRoles(ctx context.Context) ([]*UserRole, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `team`, `user`, `role` from roles where (? = '' or `team` = ?) order by `team`, `user`", db.team, db.team)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*UserRole
+	for rows.Next() {
+		role := &UserRole{}
+		err := rows.Scan(&role.Team, &role.User, &role.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// SetRole assigns a role to a Slack user, replacing their previous role.
+func (db *DB) SetRole(ctx context.Context, user string, role Role) error {
+	_, err := db.SQL.ExecContext(ctx, "insert or replace into roles (`team`, `user`, `role`) values(?, ?, ?)", db.team, user, role)
+
+	return err
+}
+
+// DeleteRole removes a Slack user's role.
+func (db *DB) DeleteRole(ctx context.Context, user string) error {
+	res, err := db.SQL.ExecContext(ctx, "delete from roles where `team` = ? and `user` = ?", db.team, user)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, ErrNoSuchRole)
+}
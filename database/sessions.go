@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// A Session is a signed in web UI user. Sessions are identified by a
+// hash of the token in the user's cookie, so that the tokens themselves
+// are never stored.
+type Session struct {
+	ID   string `json:"id"`
+	Team string `json:"team,omitempty"`
+
+	// User and Name are the Slack user that signed in. They are empty
+	// for sessions that earlier versions started with a TOTP token,
+	// which the web UI no longer accepts.
+	User string `json:"user,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// ErrNoSuchSession is returned when a session
+// does not exist or has expired
+var ErrNoSuchSession = errors.New("no such session")
+
+func (db *DB) createSessionsTable() error {
+	schema := strings.Replace(
+		`create table if not exists sessions (
+			^id^ text primary key,
+			^team^ text not null,
+			^user^ text not null,
+			^name^ text not null,
+			^created^ text not null,
+			^expires^ text not null
+		)`,
+		"^", "`", -1)
+
+	_, err := db.SQL.Exec(schema)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.SQL.Exec("create index if not exists sessions_user on sessions (`team`, `user`)")
+	if err != nil {
+		return err
+	}
+
+	schema = strings.Replace(
+		`create table if not exists login_tokens (
+			^id^ text primary key,
+			^team^ text not null,
+			^user^ text not null,
+			^name^ text not null,
+			^created^ text not null,
+			^expires^ text not null
+		)`,
+		"^", "`", -1)
+
+	_, err = db.SQL.Exec(schema)
+	return err
+}
+
+// CreateSession stores a new session.
+func (db *DB) CreateSession(ctx context.Context, session *Session) error {
+	_, err := db.SQL.ExecContext(ctx, "insert into sessions (`id`, `team`, `user`, `name`, `created`, `expires`) values(?, ?, ?, ?, ?, ?)",
+		session.ID,
+		session.Team,
+		session.User,
+		session.Name,
+		session.Created.UTC().Format(timestampFormat),
+		session.Expires.UTC().Format(timestampFormat),
+	)
+
+	return err
+}
+
+// GetSession returns a session that has not expired yet.
+func (db *DB) GetSession(ctx context.Context, id string) (*Session, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `id`, `team`, `user`, `name`, `created`, `expires` from sessions where `id` = ? and `expires` > ?", id, time.Now().UTC().Format(timestampFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := scanSessions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrNoSuchSession
+	}
+
+	return sessions[0], nil
+}
+
+// GetSessions returns the sessions of a Slack user that have not
+// expired yet, newest first. If user is empty, it returns the sessions
+// of all users. Only sessions in the DB's workspace are returned if
+// the DB is scoped to one.
+func (db *DB) GetSessions(ctx context.Context, user string) ([]*Session, error) {
+	rows, err := db.SQL.QueryContext(ctx, "select `id`, `team`, `user`, `name`, `created`, `expires` from sessions where (? = '' or `team` = ?) and (? = '' or `user` = ?) and `expires` > ? order by `created` desc, `id`",
+		db.team, db.team,
+		user, user,
+		time.Now().UTC().Format(timestampFormat),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSessions(rows)
+}
+
+func scanSessions(rows *sql.Rows) ([]*Session, error) {
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var (
+			session          = &Session{}
+			created, expires string
+		)
+
+		err := rows.Scan(&session.ID, &session.Team, &session.User, &session.Name, &created, &expires)
+		if err != nil {
+			return nil, err
+		}
+
+		session.Created, err = time.Parse(timestampFormat, created)
+		if err != nil {
+			return nil, err
+		}
+		session.Expires, err = time.Parse(timestampFormat, expires)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes a session.
+func (db *DB) DeleteSession(ctx context.Context, id string) error {
+	res, err := db.SQL.ExecContext(ctx, "delete from sessions where `id` = ? and (? = '' or `team` = ?)", id, db.team, db.team)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(res, ErrNoSuchSession)
+}
+
+// DeleteUserSessions revokes all sessions of a Slack user and returns
+// the number of sessions that were revoked.
+func (db *DB) DeleteUserSessions(ctx context.Context, user string) (int64, error) {
+	res, err := db.SQL.ExecContext(ctx, "delete from sessions where `user` = ? and (? = '' or `team` = ?)", user, db.team, db.team)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteExpiredSessions deletes all expired sessions and login tokens
+// and returns the number of sessions that were deleted.
+func (db *DB) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	now := time.Now().UTC().Format(timestampFormat)
+
+	_, err := db.SQL.ExecContext(ctx, "delete from login_tokens where `expires` <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := db.SQL.ExecContext(ctx, "delete from sessions where `expires` <= ?", now)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// CreateLoginToken stores a single-use login token. Login tokens are
+// stored like sessions: ID is a hash of the token, and the rest of
+// the fields describe the user that the token signs in.
+func (db *DB) CreateLoginToken(ctx context.Context, token *Session) error {
+	_, err := db.SQL.ExecContext(ctx, "insert into login_tokens (`id`, `team`, `user`, `name`, `created`, `expires`) values(?, ?, ?, ?, ?, ?)",
+		token.ID,
+		token.Team,
+		token.User,
+		token.Name,
+		token.Created.UTC().Format(timestampFormat),
+		token.Expires.UTC().Format(timestampFormat),
+	)
+
+	return err
+}
+
+// UseLoginToken deletes a login token that has not expired yet and
+// returns it. Each token can only be used once: ErrNoSuchSession is
+// returned if it does not exist, has expired or has already been used.
+func (db *DB) UseLoginToken(ctx context.Context, id string) (*Session, error) {
+	tx, err := db.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "select `id`, `team`, `user`, `name`, `created`, `expires` from login_tokens where `id` = ? and `expires` > ?", id, time.Now().UTC().Format(timestampFormat))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := scanSessions(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrNoSuchSession
+	}
+
+	res, err := tx.ExecContext(ctx, "delete from login_tokens where `id` = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAffected(res, ErrNoSuchSession)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens[0], tx.Commit()
+}
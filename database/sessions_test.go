@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+		now = time.Now().Truncate(time.Second)
+	)
+
+	for _, session := range []*Session{
+		{ID: "a", Team: "T1", User: "U1", Name: "alice", Created: now.Add(-time.Hour), Expires: now.Add(time.Hour)},
+		{ID: "b", Team: "T1", User: "U1", Name: "alice", Created: now, Expires: now.Add(time.Hour)},
+		{ID: "c", Team: "T2", User: "U1", Name: "alice", Created: now, Expires: now.Add(time.Hour)},
+		{ID: "expired", Team: "T1", User: "U1", Name: "alice", Created: now.Add(-2 * time.Hour), Expires: now.Add(-time.Hour)},
+	} {
+		err := db.CreateSession(ctx, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	session, err := db.GetSession(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Name != "alice" || !session.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("got session %+v", session)
+	}
+	if _, err := db.GetSession(ctx, "expired"); err != ErrNoSuchSession {
+		t.Errorf("got %v for an expired session; want ErrNoSuchSession", err)
+	}
+
+	sessions, err := db.WithTeam("T1").GetSessions(ctx, "U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "b" || sessions[1].ID != "a" {
+		t.Errorf("got sessions %+v; want b and a", sessions)
+	}
+
+	// sessions can only be revoked within their workspace
+	if err := db.WithTeam("T2").DeleteSession(ctx, "a"); err != ErrNoSuchSession {
+		t.Errorf("got %v for revoking another workspace's session; want ErrNoSuchSession", err)
+	}
+	err = db.WithTeam("T1").DeleteSession(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := db.WithTeam("T1").DeleteUserSessions(ctx, "U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("got %d sessions revoked; want b and the expired one", deleted)
+	}
+
+	deleted, err = db.DeleteExpiredSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Errorf("got %d expired sessions deleted; want 0", deleted)
+	}
+	if _, err := db.GetSession(ctx, "c"); err != nil {
+		t.Errorf("got %v for another workspace's session", err)
+	}
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+		now = time.Now()
+	)
+
+	err := db.CreateSession(ctx, &Session{ID: "expired", Created: now.Add(-2 * time.Hour), Expires: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateSession(ctx, &Session{ID: "valid", Created: now, Expires: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := db.DeleteExpiredSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("got %d sessions deleted; want 1", deleted)
+	}
+
+	sessions, err := db.GetSessions(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != "valid" {
+		t.Errorf("got sessions %+v; want the valid one", sessions)
+	}
+}
+
+func TestUseLoginToken(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+		now = time.Now()
+	)
+
+	err := db.CreateLoginToken(ctx, &Session{ID: "token", Team: "T1", User: "U1", Name: "alice", Created: now, Expires: now.Add(5 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateLoginToken(ctx, &Session{ID: "expired", Team: "T1", User: "U1", Name: "alice", Created: now.Add(-time.Hour), Expires: now.Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := db.UseLoginToken(ctx, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Team != "T1" || token.User != "U1" || token.Name != "alice" {
+		t.Errorf("got token %+v", token)
+	}
+
+	if _, err := db.UseLoginToken(ctx, "token"); err != ErrNoSuchSession {
+		t.Errorf("got %v for a used token; want ErrNoSuchSession", err)
+	}
+	if _, err := db.UseLoginToken(ctx, "expired"); err != ErrNoSuchSession {
+		t.Errorf("got %v for an expired token; want ErrNoSuchSession", err)
+	}
+	if _, err := db.UseLoginToken(ctx, "missing"); err != ErrNoSuchSession {
+		t.Errorf("got %v for a missing token; want ErrNoSuchSession", err)
+	}
+
+	// login tokens are not sessions
+	if _, err := db.GetSession(ctx, "token"); err != ErrNoSuchSession {
+		t.Errorf("got %v for a login token as a session; want ErrNoSuchSession", err)
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"strings"
+)
+
+// The karma_totals table holds every user's total points per workspace,
+// so that reading totals does not require summing up the whole karma
+// table. It is kept up to date by triggers on the karma table, so every
+// write to the ledger updates it in the same transaction.
+func (db *DB) createTotalsTable() error {
+	var exists int
+	err := db.SQL.QueryRow("select count(*) from sqlite_master where `type` = 'table' and `name` = 'karma_totals'").Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	schemas := []string{
+		`create table if not exists karma_totals (
+			^team^ text not null,
+			^user^ text not null,
+			^points^ integer not null,
+			^abs_points^ integer not null,
+			^operations^ integer not null,
+			primary key (^team^, ^user^)
+		)`,
+		"create index if not exists idx_totals_team_points on karma_totals(^team^, ^points^)",
+		`create trigger if not exists karma_totals_insert after insert on karma begin
+			insert or ignore into karma_totals (^team^, ^user^, ^points^, ^abs_points^, ^operations^) values (new.^team^, new.^to^, 0, 0, 0);
+			update karma_totals set ^points^ = ^points^ + new.^points^, ^abs_points^ = ^abs_points^ + abs(new.^points^), ^operations^ = ^operations^ + 1 where ^team^ = new.^team^ and ^user^ = new.^to^;
+		end`,
+		`create trigger if not exists karma_totals_delete after delete on karma begin
+			update karma_totals set ^points^ = ^points^ - old.^points^, ^abs_points^ = ^abs_points^ - abs(old.^points^), ^operations^ = ^operations^ - 1 where ^team^ = old.^team^ and ^user^ = old.^to^;
+			delete from karma_totals where ^team^ = old.^team^ and ^user^ = old.^to^ and ^operations^ <= 0;
+		end`,
+		`create trigger if not exists karma_totals_update after update of ^team^, ^to^, ^points^ on karma begin
+			update karma_totals set ^points^ = ^points^ - old.^points^, ^abs_points^ = ^abs_points^ - abs(old.^points^), ^operations^ = ^operations^ - 1 where ^team^ = old.^team^ and ^user^ = old.^to^;
+			delete from karma_totals where ^team^ = old.^team^ and ^user^ = old.^to^ and ^operations^ <= 0;
+			insert or ignore into karma_totals (^team^, ^user^, ^points^, ^abs_points^, ^operations^) values (new.^team^, new.^to^, 0, 0, 0);
+			update karma_totals set ^points^ = ^points^ + new.^points^, ^abs_points^ = ^abs_points^ + abs(new.^points^), ^operations^ = ^operations^ + 1 where ^team^ = new.^team^ and ^user^ = new.^to^;
+		end`,
+	}
+
+	for _, schema := range schemas {
+		_, err := db.SQL.Exec(strings.Replace(schema, "^", "`", -1))
+		if err != nil {
+			return err
+		}
+	}
+
+	// fill in the totals of databases that were created before
+	// karma_totals existed
+	if exists == 0 {
+		_, err = db.RebuildTotals(context.Background())
+	}
+
+	return err
+}
+
+// totalsLedger sums up every user's totals per workspace from the
+// karma table, in the columns of the karma_totals table.
+const totalsLedger = "select `team`, `to` as `user`, sum(`points`) as `points`, sum(abs(`points`)) as `abs_points`, count(*) as `operations` from karma group by `team`, `to`"
+
+// TotalsOutOfSync returns the number of users whose totals in the
+// karma_totals table are out of sync with the karma table.
+func (db *DB) TotalsOutOfSync(ctx context.Context) (int, error) {
+	return totalsOutOfSync(ctx, db.SQL)
+}
+
+// totalsOutOfSync counts the users whose totals are missing or differ
+// from the ledger, and users that have totals but no karma operations.
+func totalsOutOfSync(ctx context.Context, q queryer) (int, error) {
+	var outOfSync, orphaned int
+	err := q.QueryRowContext(ctx, "select count(*) from ("+totalsLedger+") l left join karma_totals t on t.`team` = l.`team` and t.`user` = l.`user` where t.`user` is null or t.`points` != l.`points` or t.`abs_points` != l.`abs_points` or t.`operations` != l.`operations`").Scan(&outOfSync)
+	if err != nil {
+		return 0, err
+	}
+	err = q.QueryRowContext(ctx, "select count(*) from karma_totals t left join ("+totalsLedger+") l on t.`team` = l.`team` and t.`user` = l.`user` where l.`user` is null").Scan(&orphaned)
+	if err != nil {
+		return 0, err
+	}
+
+	return outOfSync + orphaned, nil
+}
+
+// RebuildTotals recomputes the karma_totals table from the karma table
+// in a single transaction. It returns the number of users whose totals
+// were out of sync with the karma table.
+func (db *DB) RebuildTotals(ctx context.Context) (int, error) {
+	tx, err := db.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	outOfSync, err := totalsOutOfSync(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from karma_totals")
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "insert into karma_totals (`team`, `user`, `points`, `abs_points`, `operations`) "+totalsLedger)
+	if err != nil {
+		return 0, err
+	}
+
+	return outOfSync, tx.Commit()
+}
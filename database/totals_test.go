@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTotals(t *testing.T) {
+	ctx := context.Background()
+
+	tt := []struct {
+		Name   string
+		Change string
+		Expect map[string]int
+	}{
+		{
+			Name:   "insert",
+			Expect: map[string]int{"T1/bob": 3, "T1/carol": -1, "T2/bob": 5},
+		},
+		{
+			Name:   "delete",
+			Change: "delete from karma where `to` = 'carol'",
+			Expect: map[string]int{"T1/bob": 3, "T2/bob": 5},
+		},
+		{
+			Name:   "update points",
+			Change: "update karma set `points` = 10 where `team` = 'T2'",
+			Expect: map[string]int{"T1/bob": 3, "T1/carol": -1, "T2/bob": 10},
+		},
+		{
+			Name:   "move to another workspace",
+			Change: "update karma set `team` = 'T2' where `to` = 'carol'",
+			Expect: map[string]int{"T1/bob": 3, "T2/bob": 5, "T2/carol": -1},
+		},
+		{
+			Name:   "move to another user",
+			Change: "update karma set `to` = 'dave' where `team` = 'T2'",
+			Expect: map[string]int{"T1/bob": 3, "T1/carol": -1, "T2/dave": 5},
+		},
+	}
+
+	for _, tc := range tt {
+		db := newTestDB(t)
+		_, err := db.InsertPointsBatch(ctx, []*Points{
+			{Team: "T1", From: "alice", To: "bob", Points: 1},
+			{Team: "T1", From: "alice", To: "bob", Points: 2},
+			{Team: "T1", From: "alice", To: "carol", Points: -1},
+			{Team: "T2", From: "alice", To: "bob", Points: 5},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tc.Change != "" {
+			_, err = db.SQL.Exec(tc.Change)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.Name, err)
+			}
+		}
+
+		materialized, ledger := totals(t, db)
+		if !reflect.DeepEqual(materialized, tc.Expect) {
+			t.Errorf("%s: got totals %v; want %v", tc.Name, materialized, tc.Expect)
+		}
+		if !reflect.DeepEqual(ledger, tc.Expect) {
+			t.Errorf("%s: got ledger %v; want %v", tc.Name, ledger, tc.Expect)
+		}
+	}
+}
+
+func TestRebuildTotals(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestDB(t)
+	)
+
+	_, err := db.InsertPointsBatch(ctx, []*Points{
+		{Team: "T1", From: "alice", To: "bob", Points: 2},
+		{Team: "T1", From: "alice", To: "carol", Points: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outOfSync, err := db.RebuildTotals(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outOfSync != 0 {
+		t.Errorf("got %d users out of sync; want 0", outOfSync)
+	}
+
+	// one wrong, one missing and one orphaned total
+	_, err = db.SQL.Exec("update karma_totals set `points` = 7 where `user` = 'bob'; delete from karma_totals where `user` = 'carol'; insert into karma_totals values ('T1', 'dave', 1, 1, 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outOfSync, err = db.TotalsOutOfSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outOfSync != 3 {
+		t.Errorf("got %d users out of sync before rebuilding; want 3", outOfSync)
+	}
+
+	outOfSync, err = db.RebuildTotals(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outOfSync != 3 {
+		t.Errorf("got %d users out of sync; want 3", outOfSync)
+	}
+
+	materialized, ledger := totals(t, db)
+	if want := map[string]int{"T1/bob": 2, "T1/carol": 1}; !reflect.DeepEqual(materialized, want) || !reflect.DeepEqual(ledger, want) {
+		t.Errorf("got totals %v and ledger %v; want %v", materialized, ledger, want)
+	}
+}
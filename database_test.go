@@ -1,6 +1,7 @@
 package karmabot
 
 import (
+	"context"
 	"sort"
 	"time"
 
@@ -8,15 +9,89 @@ import (
 )
 
 type TestDatabase struct {
-	records []database.Points
+	records   []database.Points
+	policies  map[string]*database.ChannelPolicy
+	aliases   map[string]string
+	blacklist map[string]bool
+	roles     map[string]database.Role
+	audit     []*database.AuditEntry
+	kinds     map[string]database.Kind
 }
 
-func (t *TestDatabase) InsertPoints(points *database.Points) error {
+func (t *TestDatabase) InsertPoints(ctx context.Context, points *database.Points) error {
 	t.records = append(t.records, *points)
 	return nil
 }
 
-func (t *TestDatabase) GetUser(name string) (*database.User, error) {
+func (t *TestDatabase) InsertPointsBatch(ctx context.Context, points []*database.Points) (map[string]*database.User, error) {
+	totals := make(map[string]*database.User)
+	for _, p := range points {
+		t.records = append(t.records, *p)
+		totals[p.To] = &database.User{Name: p.To}
+	}
+
+	for _, r := range t.records {
+		if user, ok := totals[r.To]; ok {
+			user.Points += r.Points
+		}
+	}
+
+	return totals, nil
+}
+
+func (t *TestDatabase) UpdatePoints(ctx context.Context, users []string, fn func(totals map[string]int) ([]*database.Points, error)) (map[string]*database.User, error) {
+	totals := make(map[string]int, len(users))
+	for _, name := range users {
+		totals[name] = 0
+	}
+	for _, r := range t.records {
+		if _, ok := totals[r.To]; ok {
+			totals[r.To] += r.Points
+		}
+	}
+
+	points, err := fn(totals)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := t.InsertPointsBatch(ctx, points)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range users {
+		if _, ok := result[name]; !ok {
+			result[name] = &database.User{Name: name, Points: totals[name]}
+		}
+	}
+
+	return result, nil
+}
+
+func (t *TestDatabase) UpdatePointsAudited(ctx context.Context, users []string, entry *database.AuditEntry, fn func(totals map[string]int) ([]*database.Points, error)) (map[string]*database.User, error) {
+	var before map[string]int
+	result, err := t.UpdatePoints(ctx, users, func(totals map[string]int) ([]*database.Points, error) {
+		before = totals
+		return fn(totals)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range users {
+		points, after := before[name], result[name].Points
+
+		audited := *entry
+		audited.User = name
+		audited.Before = &points
+		audited.After = &after
+		t.audit = append(t.audit, &audited)
+	}
+
+	return result, nil
+}
+
+func (t *TestDatabase) GetUser(ctx context.Context, name string) (*database.User, error) {
 	foundUser := false
 	pointCount := 0
 	for _, r := range t.records {
@@ -34,37 +109,114 @@ func (t *TestDatabase) GetUser(name string) (*database.User, error) {
 	}, nil
 }
 
-func (t *TestDatabase) GetLeaderboard(limit int) (database.Leaderboard, error) {
-	us := make(map[string]*database.User)
+func (t *TestDatabase) GetLeaderboard(ctx context.Context, kind database.Kind, limit int) (database.Leaderboard, error) {
+	return t.GetLeaderboardSince(ctx, kind, time.Time{}, limit)
+}
 
+// GetLeaderboardSince treats all records as recent.
+func (t *TestDatabase) GetLeaderboardSince(ctx context.Context, kind database.Kind, since time.Time, limit int) (database.Leaderboard, error) {
+	us := make(map[string]*database.User)
 	for _, r := range t.records {
-		u := us[r.To]
-		if u == nil {
-			u = &database.User{}
+		if !t.isKind(r.To, kind) {
+			continue
 		}
-		u.Points += r.Points
-		us[r.To] = u
+		if us[r.To] == nil {
+			us[r.To] = &database.User{Name: r.To}
+		}
+		us[r.To].Points += r.Points
 	}
 
 	lb := make(database.Leaderboard, 0, len(us))
 	for _, u := range us {
 		lb = append(lb, u)
 	}
-	sort.SliceStable(lb, func(i, j int) bool {
-		ui := lb[i]
-		uj := lb[j]
-		if ui.Points == uj.Points && ui.Name < uj.Name {
-			return true
-		}
-		if ui.Points < uj.Points {
-			return true
+	sort.Slice(lb, func(i, j int) bool {
+		if lb[i].Points == lb[j].Points {
+			return lb[i].Name < lb[j].Name
 		}
-		return false
+		return lb[i].Points > lb[j].Points
 	})
-	return lb[:limit], nil
+	if len(lb) > limit {
+		lb = lb[:limit]
+	}
+	return lb, nil
 }
 
-func (t *TestDatabase) GetTotalPoints() (int, error) {
+func (t *TestDatabase) GetRank(ctx context.Context, kind database.Kind, name string) (int, error) {
+	lb, err := t.GetLeaderboardSince(ctx, kind, time.Time{}, len(t.records))
+	if err != nil {
+		return 0, err
+	}
+	for i, u := range lb {
+		if u.Name == name {
+			return i + 1, nil
+		}
+	}
+	return 0, database.ErrNoSuchUser
+}
+
+func (t *TestDatabase) GetKind(ctx context.Context, name string) (database.Kind, error) {
+	return t.kinds[name], nil
+}
+
+func (t *TestDatabase) SetKind(ctx context.Context, name string, kind database.Kind) error {
+	if t.kinds == nil {
+		t.kinds = make(map[string]database.Kind)
+	}
+	t.kinds[name] = kind
+	return nil
+}
+
+// isKind treats names that were never classified as people.
+func (t *TestDatabase) isKind(name string, kind database.Kind) bool {
+	if kind == "" {
+		return true
+	}
+
+	k := t.kinds[name]
+	if k == "" {
+		k = database.KindPerson
+	}
+	return k == kind
+}
+
+func (t *TestDatabase) GetUserRecords(ctx context.Context, name string, limit, offset int) ([]*database.Record, error) {
+	return t.getRecords(func(r database.Points) bool { return r.To == name }, limit, offset), nil
+}
+
+func (t *TestDatabase) GetGivenRecords(ctx context.Context, name string, limit, offset int) ([]*database.Record, error) {
+	return t.getRecords(func(r database.Points) bool { return r.From == name }, limit, offset), nil
+}
+
+func (t *TestDatabase) getRecords(match func(database.Points) bool, limit, offset int) []*database.Record {
+	var records []*database.Record
+	for i := len(t.records) - 1; i >= 0; i-- {
+		r := t.records[i]
+		if !match(r) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(records) == limit {
+			break
+		}
+
+		records = append(records, &database.Record{
+			ID:     int64(i + 1),
+			Team:   r.Team,
+			From:   r.From,
+			To:     r.To,
+			Points: r.Points,
+			Reason: r.Reason,
+			Source: r.Source,
+		})
+	}
+	return records
+}
+
+func (t *TestDatabase) GetTotalPoints(ctx context.Context) (int, error) {
 	totalPoints := 0
 	for _, r := range t.records {
 		p := r.Points
@@ -76,7 +228,7 @@ func (t *TestDatabase) GetTotalPoints() (int, error) {
 	return totalPoints, nil
 }
 
-func (t *TestDatabase) GetThrowback(user string) (*database.Throwback, error) {
+func (t *TestDatabase) GetThrowback(ctx context.Context, user string) (*database.Throwback, error) {
 	foundUser := false
 	var points database.Points
 	for _, r := range t.records {
@@ -94,3 +246,121 @@ func (t *TestDatabase) GetThrowback(user string) (*database.Throwback, error) {
 		Timestamp: time.Now(),
 	}, nil
 }
+
+func (t *TestDatabase) GetChannelPolicy(ctx context.Context, channel string) (*database.ChannelPolicy, error) {
+	policy, ok := t.policies[channel]
+	if !ok {
+		return nil, database.ErrNoSuchChannelPolicy
+	}
+
+	return policy, nil
+}
+
+func (t *TestDatabase) GetAlias(ctx context.Context, alias string) (string, error) {
+	user, ok := t.aliases[alias]
+	if !ok {
+		return "", database.ErrNoSuchAlias
+	}
+
+	return user, nil
+}
+
+func (t *TestDatabase) GetAliases(ctx context.Context) ([]*database.Alias, error) {
+	var aliases []*database.Alias
+	for alias, user := range t.aliases {
+		aliases = append(aliases, &database.Alias{Alias: alias, User: user})
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].Alias < aliases[j].Alias
+	})
+
+	return aliases, nil
+}
+
+func (t *TestDatabase) SetAlias(ctx context.Context, alias, user string) error {
+	if t.aliases == nil {
+		t.aliases = make(map[string]string)
+	}
+	t.aliases[alias] = user
+	return nil
+}
+
+func (t *TestDatabase) DeleteAlias(ctx context.Context, alias string) error {
+	if _, ok := t.aliases[alias]; !ok {
+		return database.ErrNoSuchAlias
+	}
+	delete(t.aliases, alias)
+	return nil
+}
+
+func (t *TestDatabase) IsBlacklisted(ctx context.Context, name string) (bool, error) {
+	return t.blacklist[name], nil
+}
+
+func (t *TestDatabase) GetBlacklist(ctx context.Context) ([]string, error) {
+	var names []string
+	for name := range t.blacklist {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (t *TestDatabase) AddToBlacklist(ctx context.Context, name string) error {
+	if t.blacklist == nil {
+		t.blacklist = make(map[string]bool)
+	}
+	t.blacklist[name] = true
+	return nil
+}
+
+func (t *TestDatabase) RemoveFromBlacklist(ctx context.Context, name string) error {
+	if !t.blacklist[name] {
+		return database.ErrNotBlacklisted
+	}
+	delete(t.blacklist, name)
+	return nil
+}
+
+func (t *TestDatabase) GetRole(ctx context.Context, user string) (database.Role, error) {
+	role, ok := t.roles[user]
+	if !ok {
+		return "", database.ErrNoSuchRole
+	}
+
+	return role, nil
+}
+
+func (t *TestDatabase) GetRoles(ctx context.Context) ([]*database.UserRole, error) {
+	var roles []*database.UserRole
+	for user, role := range t.roles {
+		roles = append(roles, &database.UserRole{User: user, Role: role})
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].User < roles[j].User
+	})
+
+	return roles, nil
+}
+
+func (t *TestDatabase) SetRole(ctx context.Context, user string, role database.Role) error {
+	if t.roles == nil {
+		t.roles = make(map[string]database.Role)
+	}
+	t.roles[user] = role
+	return nil
+}
+
+func (t *TestDatabase) DeleteRole(ctx context.Context, user string) error {
+	if _, ok := t.roles[user]; !ok {
+		return database.ErrNoSuchRole
+	}
+	delete(t.roles, user)
+	return nil
+}
+
+func (t *TestDatabase) InsertAuditEntry(ctx context.Context, entry *database.AuditEntry) error {
+	t.audit = append(t.audit, entry)
+	return nil
+}
@@ -1,10 +1,9 @@
 module github.com/kamaln7/karmabot
 
-go 1.13
+go 1.16
 
 require (
 	github.com/aybabtme/log v0.0.0-20170418131122-ba6ae9871c28
-	github.com/boombuler/barcode v1.0.0 // indirect
 	github.com/dustin/go-humanize v1.0.0
 	github.com/go-kit/kit v0.8.0 // indirect
 	github.com/go-logfmt/logfmt v0.4.0 // indirect
@@ -18,9 +17,9 @@ require (
 	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/nlopes/slack v0.5.0
 	github.com/pkg/errors v0.8.1 // indirect
-	github.com/pquerna/otp v1.1.0
 	github.com/satori/go.uuid v1.2.0
 	github.com/stretchr/testify v1.4.0 // indirect
 	github.com/urfave/cli v1.20.0
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,129 @@
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value int    `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph to w in the GraphML format. Nodes have
+// given and received attributes, and edges have points and count
+// attributes.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := &graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "given", For: "node", Name: "given", Type: "int"},
+			{ID: "received", For: "node", Name: "received", Type: "int"},
+			{ID: "points", For: "edge", Name: "points", Type: "int"},
+			{ID: "count", For: "edge", Name: "count", Type: "int"},
+		},
+		Graph: graphMLGraph{
+			ID:          "karma",
+			EdgeDefault: "directed",
+		},
+	}
+
+	for _, node := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID: node.Name,
+			Data: []graphMLData{
+				{Key: "given", Value: node.Given},
+				{Key: "received", Value: node.Received},
+			},
+		})
+	}
+	for _, edge := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: edge.From,
+			Target: edge.To,
+			Data: []graphMLData{
+				{Key: "points", Value: edge.Points},
+				{Key: "count", Value: edge.Count},
+			},
+		})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// WriteDOT writes the graph to w in Graphviz's DOT language. Edges are
+// labeled with their points.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	_, err := io.WriteString(w, "digraph karma {\n")
+	if err != nil {
+		return err
+	}
+
+	for _, node := range g.Nodes {
+		_, err = fmt.Fprintf(w, "  %s [given=%d, received=%d];\n", dotID(node.Name), node.Given, node.Received)
+		if err != nil {
+			return err
+		}
+	}
+	for _, edge := range g.Edges {
+		_, err = fmt.Fprintf(w, "  %s -> %s [label=\"%d\", points=%d, count=%d];\n", dotID(edge.From), dotID(edge.To), edge.Points, edge.Points, edge.Count)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// dotID quotes a name for use as a DOT identifier.
+func dotID(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
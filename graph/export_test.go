@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+func testGraph() *Graph {
+	return New([]*database.Edge{
+		{From: "alice", To: `bob "the builder"`, Points: 3, Count: 2},
+	}, []string{"carol"})
+}
+
+func TestWriteDOT(t *testing.T) {
+	var b strings.Builder
+	err := testGraph().WriteDOT(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `digraph karma {
+  "alice" [given=3, received=0];
+  "bob \"the builder\"" [given=0, received=3];
+  "carol" [given=0, received=0];
+  "alice" -> "bob \"the builder\"" [label="3", points=3, count=2];
+}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var b strings.Builder
+	err := testGraph().WriteGraphML(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(b.String(), xml.Header) {
+		t.Errorf("missing XML header in\n%s", b.String())
+	}
+
+	doc := &graphML{}
+	err = xml.Unmarshal([]byte(b.String()), doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Graph.EdgeDefault != "directed" || len(doc.Keys) != 4 {
+		t.Errorf("got graph %+v with keys %+v", doc.Graph, doc.Keys)
+	}
+	if len(doc.Graph.Nodes) != 3 || doc.Graph.Nodes[1].ID != `bob "the builder"` {
+		t.Errorf("got nodes %+v", doc.Graph.Nodes)
+	}
+	if len(doc.Graph.Edges) != 1 {
+		t.Fatalf("got edges %+v; want 1", doc.Graph.Edges)
+	}
+
+	edge := doc.Graph.Edges[0]
+	want := []graphMLData{{Key: "points", Value: 3}, {Key: "count", Value: 2}}
+	if edge.Source != "alice" || edge.Target != `bob "the builder"` || len(edge.Data) != 2 || edge.Data[0] != want[0] || edge.Data[1] != want[1] {
+		t.Errorf("got edge %+v", edge)
+	}
+}
@@ -0,0 +1,130 @@
+// Package graph builds a weighted directed graph of the karma that
+// users gave each other, and computes statistics about it.
+package graph
+
+import (
+	"sort"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+// mostConnectedLimit is the number of users that
+// are listed in Stats.MostConnected.
+const mostConnectedLimit = 10
+
+// A Node is a user in the graph.
+type Node struct {
+	Name string `json:"name"`
+
+	// Given and Received are the points that the user gave and received.
+	Given    int `json:"given"`
+	Received int `json:"received"`
+
+	// Connections is the number of users that the user
+	// gave karma to or received karma from.
+	Connections int `json:"connections"`
+}
+
+// A Graph is a weighted directed graph with an edge from every
+// user to every user that they gave karma to.
+type Graph struct {
+	Nodes []*Node          `json:"nodes"`
+	Edges []*database.Edge `json:"edges"`
+	Stats *Stats           `json:"stats"`
+	index map[string]*Node
+}
+
+// Stats sums up the collaboration patterns in a graph.
+type Stats struct {
+	// MostConnected lists the users with the most connections.
+	MostConnected []*Node `json:"most_connected"`
+
+	// Reciprocity is the fraction of edges whose receiver also gave
+	// karma to the giver, from 0 to 1.
+	Reciprocity float64 `json:"reciprocity"`
+
+	// Isolated lists the users that did not give or receive any karma.
+	Isolated []string `json:"isolated"`
+}
+
+// New builds a graph from edges. users lists all known users, so that
+// the users that are not connected to anyone can be included.
+func New(edges []*database.Edge, users []string) *Graph {
+	g := &Graph{
+		Edges: edges,
+		index: make(map[string]*Node),
+	}
+
+	var (
+		neighbors  = make(map[string]map[string]bool)
+		exists     = make(map[[2]string]bool)
+		reciprocal int
+	)
+	connect := func(a, b string) {
+		if neighbors[a] == nil {
+			neighbors[a] = make(map[string]bool)
+		}
+		neighbors[a][b] = true
+	}
+
+	for _, edge := range edges {
+		g.node(edge.From).Given += edge.Points
+		g.node(edge.To).Received += edge.Points
+		connect(edge.From, edge.To)
+		connect(edge.To, edge.From)
+		exists[[2]string{edge.From, edge.To}] = true
+	}
+	for _, edge := range edges {
+		if exists[[2]string{edge.To, edge.From}] {
+			reciprocal++
+		}
+	}
+
+	g.Stats = &Stats{}
+	for _, user := range users {
+		if _, ok := g.index[user]; !ok {
+			g.node(user)
+			g.Stats.Isolated = append(g.Stats.Isolated, user)
+		}
+	}
+	sort.Strings(g.Stats.Isolated)
+
+	for _, node := range g.Nodes {
+		node.Connections = len(neighbors[node.Name])
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Name < g.Nodes[j].Name
+	})
+
+	if len(edges) > 0 {
+		g.Stats.Reciprocity = float64(reciprocal) / float64(len(edges))
+	}
+
+	mostConnected := make([]*Node, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		if node.Connections > 0 {
+			mostConnected = append(mostConnected, node)
+		}
+	}
+	sort.SliceStable(mostConnected, func(i, j int) bool {
+		return mostConnected[i].Connections > mostConnected[j].Connections
+	})
+	if len(mostConnected) > mostConnectedLimit {
+		mostConnected = mostConnected[:mostConnectedLimit]
+	}
+	g.Stats.MostConnected = mostConnected
+
+	return g
+}
+
+// node returns the node of a user, adding it to the graph if needed.
+func (g *Graph) node(name string) *Node {
+	node, ok := g.index[name]
+	if !ok {
+		node = &Node{Name: name}
+		g.index[name] = node
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	return node
+}
@@ -0,0 +1,47 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+func TestNew(t *testing.T) {
+	edges := []*database.Edge{
+		{From: "alice", To: "bob", Points: 3, Count: 2},
+		{From: "bob", To: "alice", Points: 1, Count: 1},
+		{From: "bob", To: "carol", Points: 2, Count: 2},
+	}
+	g := New(edges, []string{"alice", "bob", "carol", "dave"})
+
+	var names []string
+	for _, node := range g.Nodes {
+		names = append(names, node.Name)
+	}
+	if want := []string{"alice", "bob", "carol", "dave"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got nodes %v; want %v", names, want)
+	}
+
+	bob := g.index["bob"]
+	if bob.Given != 3 || bob.Received != 3 || bob.Connections != 2 {
+		t.Errorf("got bob %+v; want given 3, received 3 and 2 connections", bob)
+	}
+
+	if want := []string{"dave"}; !reflect.DeepEqual(g.Stats.Isolated, want) {
+		t.Errorf("got isolated %v; want %v", g.Stats.Isolated, want)
+	}
+	if want := 2.0 / 3; g.Stats.Reciprocity != want {
+		t.Errorf("got reciprocity %v; want %v", g.Stats.Reciprocity, want)
+	}
+	if len(g.Stats.MostConnected) != 3 || g.Stats.MostConnected[0].Name != "bob" {
+		t.Errorf("got most connected %+v; want bob first and no isolated users", g.Stats.MostConnected)
+	}
+}
+
+func TestNewEmpty(t *testing.T) {
+	g := New(nil, nil)
+	if len(g.Nodes) != 0 || g.Stats.Reciprocity != 0 || len(g.Stats.MostConnected) != 0 {
+		t.Errorf("got %+v for an empty graph", g)
+	}
+}
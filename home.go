@@ -0,0 +1,284 @@
+package karmabot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/nlopes/slack"
+)
+
+// AppHomeOpenedEvent is sent when a user opens one of the tabs of
+// karmabot's App Home. Slack only sends it through the Events API,
+// never over RTM, so it is passed to HandleEvent by the web UI.
+type AppHomeOpenedEvent struct {
+	Type    string `json:"type"`
+	User    string `json:"user"`
+	Channel string `json:"channel"`
+	Tab     string `json:"tab"`
+}
+
+// HandleEvent handles an event from Slack's Events API, such as
+// app_home_opened, that is not sent over RTM. event is the inner
+// event object of the request. The event is queued like the ones
+// that arrive over RTM, and unknown events are ignored.
+func (b *Bot) HandleEvent(ctx context.Context, event json.RawMessage) error {
+	var ev struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(event, &ev)
+	if err != nil {
+		return err
+	}
+
+	switch ev.Type {
+	case "app_home_opened":
+		home := &AppHomeOpenedEvent{}
+		err = json.Unmarshal(event, home)
+		if err != nil {
+			return err
+		}
+
+		b.handle(ctx, home.User, func(ctx context.Context) { b.handleAppHomeOpenedEvent(ctx, home) })
+	}
+
+	return nil
+}
+
+// A View is a Slack surface, such as the Home tab, that is made of
+// Block Kit blocks. Only the blocks that karmabot uses are supported.
+type View struct {
+	Type   string   `json:"type"`
+	Blocks []*Block `json:"blocks"`
+}
+
+// A Block is a Block Kit layout block.
+type Block struct {
+	Type     string  `json:"type"`
+	Text     *Text   `json:"text,omitempty"`
+	Fields   []*Text `json:"fields,omitempty"`
+	Elements []*Text `json:"elements,omitempty"`
+}
+
+// Text is a Block Kit text object.
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func headerBlock(text string) *Block {
+	return &Block{Type: "header", Text: &Text{Type: "plain_text", Text: text}}
+}
+
+func sectionBlock(text string) *Block {
+	return &Block{Type: "section", Text: &Text{Type: "mrkdwn", Text: text}}
+}
+
+func fieldsBlock(fields ...string) *Block {
+	block := &Block{Type: "section"}
+	for _, field := range fields {
+		block.Fields = append(block.Fields, &Text{Type: "mrkdwn", Text: field})
+	}
+
+	return block
+}
+
+func contextBlock(text string) *Block {
+	return &Block{Type: "context", Elements: []*Text{{Type: "mrkdwn", Text: text}}}
+}
+
+func dividerBlock() *Block {
+	return &Block{Type: "divider"}
+}
+
+// PublishView publishes a view to a user's Home tab. nlopes/slack
+// does not support views.publish, so it is called directly.
+func (s SlackChatService) PublishView(user string, view *View) error {
+	body, err := json.Marshal(&struct {
+		UserID string `json:"user_id"`
+		View   *View  `json:"view"`
+	}{
+		UserID: user,
+		View:   view,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, slack.APIURL+"views.publish", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	response := &slack.SlackResponse{}
+	err = json.NewDecoder(res.Body).Decode(response)
+	if err != nil {
+		return fmt.Errorf("views.publish: %s: %v", res.Status, err)
+	}
+
+	return response.Err()
+}
+
+// homeRecords is the number of recent karma operations
+// that the Home tab lists.
+const homeRecords = 5
+
+// handleAppHomeOpenedEvent publishes the user's
+// karma dashboard to their Home tab.
+func (b *Bot) handleAppHomeOpenedEvent(ctx context.Context, ev *AppHomeOpenedEvent) {
+	if ev.Tab != "home" {
+		return
+	}
+
+	bot := *b
+	bot.Config = b.config()
+
+	view, err := bot.homeView(ctx, ev.User)
+	if err != nil {
+		bot.Config.Log.Err(err).KV("user", ev.User).Error("could not build home tab")
+		return
+	}
+
+	err = bot.Config.Slack.PublishView(ev.User, view)
+	if err != nil {
+		bot.Config.Log.Err(err).KV("user", ev.User).Error("could not publish home tab")
+	}
+}
+
+// homeView builds a user's karma dashboard: their total and rank,
+// the karma that they recently received and gave, and this week's
+// leaderboard.
+func (b *Bot) homeView(ctx context.Context, userID string) (*View, error) {
+	name, err := b.getUserNameByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	name, err = b.parseUser(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+
+	view := &View{
+		Type:   "home",
+		Blocks: []*Block{headerBlock("Your karma")},
+	}
+
+	user, err := b.Config.DB.GetUser(ctx, name)
+	switch err {
+	case nil:
+		rank, err := b.Config.DB.GetRank(ctx, b.Config.peopleKind(), name)
+		if err != nil {
+			return nil, err
+		}
+
+		view.Blocks = append(view.Blocks, fieldsBlock(
+			fmt.Sprintf("*Total*\n%s", formatPoints(user)),
+			fmt.Sprintf("*Rank*\n#%d", rank),
+		))
+	case database.ErrNoSuchUser:
+		view.Blocks = append(view.Blocks, sectionBlock(fmt.Sprintf("Nobody has given %s any karma yet.", escapeMrkdwn(name))))
+	default:
+		return nil, err
+	}
+
+	received, err := b.Config.DB.GetUserRecords(ctx, name, homeRecords, 0)
+	if err != nil {
+		return nil, err
+	}
+	given, err := b.Config.DB.GetGivenRecords(ctx, name, homeRecords, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	view.Blocks = append(view.Blocks,
+		dividerBlock(),
+		sectionBlock("*Recently received*\n"+formatHomeRecords(received, true)),
+		sectionBlock("*Recently given*\n"+formatHomeRecords(given, false)),
+	)
+
+	since := startOfWeek(time.Now())
+	leaderboard, err := b.Config.DB.GetLeaderboardSince(ctx, b.Config.peopleKind(), since, b.Config.LeaderboardLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	text := "Nobody has received any karma this week yet."
+	if len(leaderboard) > 0 {
+		var lines []string
+		for i, user := range leaderboard {
+			lines = append(lines, fmt.Sprintf("%d. %s == %d", i+1, escapeMrkdwn(user.Name), user.Points))
+		}
+		text = strings.Join(lines, "\n")
+	}
+
+	view.Blocks = append(view.Blocks,
+		dividerBlock(),
+		headerBlock("This week's leaderboard"),
+		sectionBlock(text),
+		contextBlock(fmt.Sprintf("Karma received since %s.", since.Format("Monday, January 2"))),
+	)
+
+	return view, nil
+}
+
+// formatHomeRecords lists karma operations, naming
+// the giver if received is set and the recipient if not.
+func formatHomeRecords(records []*database.Record, received bool) string {
+	if len(records) == 0 {
+		return "Nothing yet."
+	}
+
+	var lines []string
+	for _, record := range records {
+		points := fmt.Sprintf("%d", record.Points)
+		if record.Points > 0 {
+			points = "+" + points
+		}
+
+		line := fmt.Sprintf("%s to %s", points, escapeMrkdwn(record.To))
+		if received {
+			line = fmt.Sprintf("%s from %s", points, escapeMrkdwn(record.From))
+		}
+		if record.Reason != "" {
+			line += " for " + escapeMrkdwn(record.Reason)
+		}
+
+		lines = append(lines, fmt.Sprintf("%s · %s", line, record.Timestamp.Format("Jan 2")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// startOfWeek returns midnight UTC on the Monday of t's week.
+func startOfWeek(t time.Time) time.Time {
+	t = t.UTC()
+	days := (int(t.Weekday()) + 6) % 7
+
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, time.UTC)
+}
+
+// escapeMrkdwn escapes the characters that Slack's mrkdwn
+// uses for links and mentions.
+func escapeMrkdwn(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,170 @@
+package karmabot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/nlopes/slack"
+)
+
+func TestHandleAppHomeOpenedEvent(t *testing.T) {
+	b, cs, db := newBot(&Config{LeaderboardLimit: 3})
+	db.InsertPoints(context.Background(), &database.Points{
+		From:   "onehundred_points",
+		To:     "someone",
+		Points: 2,
+		Reason: "<reasons>",
+	})
+
+	b.handleAppHomeOpenedEvent(context.Background(), &AppHomeOpenedEvent{
+		Type: "app_home_opened",
+		User: "onehundred_points",
+		Tab:  "home",
+	})
+
+	view := cs.PublishedViews["onehundred_points"]
+	if view == nil {
+		t.Fatalf("did not publish a home tab")
+	}
+	if view.Type != "home" {
+		t.Errorf("published a %q view; want home", view.Type)
+	}
+
+	var text []string
+	for _, block := range view.Blocks {
+		if block.Text != nil {
+			text = append(text, block.Text.Text)
+		}
+		for _, field := range append(block.Fields, block.Elements...) {
+			text = append(text, field.Text)
+		}
+	}
+	all := strings.Join(text, "\n")
+
+	for _, want := range []string{
+		"*Total*\n100",
+		"*Rank*\n#1",
+		"+100 from point_giver",
+		"+2 to someone for &lt;reasons&gt;",
+		"1. onehundred_points == 100\n2. someone == 2",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("home tab does not contain %q:\n%s", want, all)
+		}
+	}
+}
+
+func TestHandleAppHomeOpenedEventMessagesTab(t *testing.T) {
+	b, cs, _ := newBot(&Config{LeaderboardLimit: 3})
+
+	b.handleAppHomeOpenedEvent(context.Background(), &AppHomeOpenedEvent{
+		Type: "app_home_opened",
+		User: "onehundred_points",
+		Tab:  "messages",
+	})
+
+	if len(cs.PublishedViews) != 0 {
+		t.Errorf("published a home tab when the messages tab was opened")
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	b, cs, _ := newBot(&Config{LeaderboardLimit: 3})
+
+	err := b.HandleEvent(context.Background(), json.RawMessage(`{"type":"app_home_opened","user":"onehundred_points","channel":"D1","tab":"home"}`))
+	if err != nil {
+		t.Fatalf("HandleEvent: %v", err)
+	}
+	err = b.HandleEvent(context.Background(), json.RawMessage(`{"type":"team_join"}`))
+	if err != nil {
+		t.Fatalf("HandleEvent: %v", err)
+	}
+
+	// wait for the queued handler
+	err = b.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if cs.PublishedViews["onehundred_points"] == nil {
+		t.Errorf("did not publish a home tab")
+	}
+}
+
+func TestPublishView(t *testing.T) {
+	var got struct {
+		UserID string `json:"user_id"`
+		View   *View  `json:"view"`
+	}
+	var auth string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/views.publish" {
+			http.NotFound(w, r)
+			return
+		}
+
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	apiURL := slack.APIURL
+	slack.APIURL = server.URL + "/"
+	defer func() { slack.APIURL = apiURL }()
+
+	cs := SlackChatService{Token: "xoxb-test"}
+	err := cs.PublishView("U1", &View{Type: "home", Blocks: []*Block{headerBlock("hi")}})
+	if err != nil {
+		t.Fatalf("PublishView: %v", err)
+	}
+
+	if auth != "Bearer xoxb-test" {
+		t.Errorf("Authorization header is %q", auth)
+	}
+	if got.UserID != "U1" || got.View == nil || got.View.Type != "home" || len(got.View.Blocks) != 1 {
+		t.Errorf("published %#v", got)
+	}
+}
+
+func TestPublishViewError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"not_enabled"}`))
+	}))
+	defer server.Close()
+
+	apiURL := slack.APIURL
+	slack.APIURL = server.URL + "/"
+	defer func() { slack.APIURL = apiURL }()
+
+	err := SlackChatService{}.PublishView("U1", &View{Type: "home"})
+	if err == nil || !strings.Contains(err.Error(), "not_enabled") {
+		t.Errorf("PublishView: got error %v; want not_enabled", err)
+	}
+}
+
+func TestStartOfWeek(t *testing.T) {
+	tt := []struct {
+		t, want string
+	}{
+		{"2019-05-15T13:04:05Z", "2019-05-13T00:00:00Z"},
+		{"2019-05-13T00:00:00Z", "2019-05-13T00:00:00Z"},
+		{"2019-05-19T23:59:59Z", "2019-05-13T00:00:00Z"},
+		{"2019-06-02T10:00:00Z", "2019-05-27T00:00:00Z"},
+	}
+
+	for _, tc := range tt {
+		in, _ := time.Parse(time.RFC3339, tc.t)
+		if got := startOfWeek(in).Format(time.RFC3339); got != tc.want {
+			t.Errorf("startOfWeek(%s): got %s; want %s", tc.t, got, tc.want)
+		}
+	}
+}
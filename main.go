@@ -1,11 +1,16 @@
 package karmabot
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kamaln7/karmabot/database"
 	"github.com/kamaln7/karmabot/munge"
@@ -18,34 +23,105 @@ import (
 
 var (
 	regexps = struct {
-		Motivate, GiveKarma, QueryKarma, Leaderboard, URL, SlackUser, Throwback *regexp.Regexp
+		Motivate, GiveKarma, QueryKarma, Leaderboard, Things, URL, SlackUser, Throwback, Admin *regexp.Regexp
 	}{
 		Motivate:    karmaReg.GetMotivate(),
 		GiveKarma:   karmaReg.GetGive(),
 		QueryKarma:  karmaReg.GetQuery(),
 		Leaderboard: regexp.MustCompile(`^karma(?:bot)? (?:leaderboard|top|highscores) ?([0-9]+)?$`),
+		Things:      regexp.MustCompile(`^karma(?:bot)? things ?([0-9]+)?$`),
 		URL:         regexp.MustCompile(`^karma(?:bot)? (?:url|web|link)?$`),
 		SlackUser:   regexp.MustCompile(`^<@([A-Za-z0-9]+)>$`),
 		Throwback:   karmaReg.GetThrowback(),
+		Admin:       regexp.MustCompile(`^karma(?:bot)? admin(?:\s+(.*))?$`),
 	}
 )
 
 // Database is an abstraction around the database, mostly designed for use in tests.
 type Database interface {
-	// InsertPoints persistently records that points have been given or deducted.
-	InsertPoints(points *database.Points) error
+	// InsertPointsBatch persistently and atomically records that points have been
+	// given or deducted, and returns the resulting totals of the users that received them.
+	InsertPointsBatch(ctx context.Context, points []*database.Points) (map[string]*database.User, error)
+
+	// UpdatePoints passes the current totals of users to fn and records the points that
+	// it returns in the same transaction, and returns the resulting totals.
+	UpdatePoints(ctx context.Context, users []string, fn func(totals map[string]int) ([]*database.Points, error)) (map[string]*database.User, error)
+
+	// UpdatePointsAudited is UpdatePoints that also records the change to every user's
+	// total in the audit log, in the same transaction.
+	UpdatePointsAudited(ctx context.Context, users []string, entry *database.AuditEntry, fn func(totals map[string]int) ([]*database.Points, error)) (map[string]*database.User, error)
 
 	// GetUser returns information about a user, including their current number of points.
-	GetUser(name string) (*database.User, error)
+	GetUser(ctx context.Context, name string) (*database.User, error)
+
+	// GetLeaderboard returns the top X users of a kind with the most points, in order.
+	GetLeaderboard(ctx context.Context, kind database.Kind, limit int) (database.Leaderboard, error)
+
+	// GetLeaderboardSince returns the top X users of a kind with the most points received since a point in time.
+	GetLeaderboardSince(ctx context.Context, kind database.Kind, since time.Time, limit int) (database.Leaderboard, error)
+
+	// GetRank returns a user's position in the leaderboard of a kind, starting at 1.
+	GetRank(ctx context.Context, kind database.Kind, name string) (int, error)
+
+	// GetKind returns whether a name belongs to a person or a thing, if it is known.
+	GetKind(ctx context.Context, name string) (database.Kind, error)
 
-	// GetLeaderboard returns the top X users with the most points, in order.
-	GetLeaderboard(limit int) (database.Leaderboard, error)
+	// SetKind classifies a name as a person or a thing.
+	SetKind(ctx context.Context, name string, kind database.Kind) error
+
+	// GetUserRecords returns the karma operations that a user received, newest first.
+	GetUserRecords(ctx context.Context, name string, limit, offset int) ([]*database.Record, error)
+
+	// GetGivenRecords returns the karma operations that a user made, newest first.
+	GetGivenRecords(ctx context.Context, name string, limit, offset int) ([]*database.Record, error)
 
 	// GetTotalPoints returns the total number of points transferred across all users.
-	GetTotalPoints() (int, error)
+	GetTotalPoints(ctx context.Context) (int, error)
 
 	// GetThrowback returns a random karma operation on a specific user.
-	GetThrowback(user string) (*database.Throwback, error)
+	GetThrowback(ctx context.Context, user string) (*database.Throwback, error)
+
+	// GetChannelPolicy returns the config overrides for a channel.
+	GetChannelPolicy(ctx context.Context, channel string) (*database.ChannelPolicy, error)
+
+	// GetAlias returns the main name that an alias maps to.
+	GetAlias(ctx context.Context, alias string) (string, error)
+
+	// GetAliases returns all aliases.
+	GetAliases(ctx context.Context) ([]*database.Alias, error)
+
+	// SetAlias maps an alias to a user.
+	SetAlias(ctx context.Context, alias, user string) error
+
+	// DeleteAlias removes an alias.
+	DeleteAlias(ctx context.Context, alias string) error
+
+	// IsBlacklisted checks whether karma operations on a name should be ignored.
+	IsBlacklisted(ctx context.Context, name string) (bool, error)
+
+	// GetBlacklist returns all blacklisted names.
+	GetBlacklist(ctx context.Context) ([]string, error)
+
+	// AddToBlacklist adds a name to the blacklist.
+	AddToBlacklist(ctx context.Context, name string) error
+
+	// RemoveFromBlacklist removes a name from the blacklist.
+	RemoveFromBlacklist(ctx context.Context, name string) error
+
+	// GetRole returns the role of a Slack user.
+	GetRole(ctx context.Context, user string) (database.Role, error)
+
+	// GetRoles returns all assigned roles.
+	GetRoles(ctx context.Context) ([]*database.UserRole, error)
+
+	// SetRole assigns a role to a Slack user.
+	SetRole(ctx context.Context, user string, role database.Role) error
+
+	// DeleteRole removes a Slack user's role.
+	DeleteRole(ctx context.Context, user string) error
+
+	// InsertAuditEntry records an administrative action.
+	InsertAuditEntry(ctx context.Context, entry *database.AuditEntry) error
 }
 
 // ChatService is an abstraction around Slack, mostly designed for use in tests.
@@ -68,11 +144,18 @@ type ChatService interface {
 
 	// PostEphemeral sends an ephemeral message to a user in a channel.
 	PostEphemeral(channelID, userID string, options ...slack.MsgOption) (string, error)
+
+	// PublishView publishes a view to a user's Home tab.
+	PublishView(user string, view *View) error
 }
 
 // SlackChatService is an implementation of ChatService using github.com/nlopes/slack.
+// Token is the bot token, which is needed for the API methods that
+// nlopes/slack does not support, and HTTPClient is used for them if set.
 type SlackChatService struct {
-	slack.RTM
+	*slack.RTM
+	Token      string
+	HTTPClient *http.Client
 }
 
 // IncomingEventsChan returns a channel of real-time messaging events.
@@ -101,45 +184,195 @@ type Config struct {
 	Aliases                     UserAliases
 	Reactji                     *ReactjiConfig
 	ReplyType                   string
+
+	// Admins is a list of Slack user IDs that always have the admin role.
+	Admins StringList
+
+	// DefaultRole is the role of users that have not been assigned one
+	// in the database. It defaults to database.RoleMember.
+	DefaultRole database.Role
+
+	// Permissions overrides DefaultPermissions for some actions.
+	Permissions Permissions
+
+	// Workspace is the ID of the Slack workspace that the bot is
+	// connected to. It is used to link to the workspace's pages
+	// in the web UI.
+	Workspace string
+
+	// Channels contains config overrides for specific channels. Policies
+	// that are stored in the database take precedence over these.
+	Channels ChannelPolicies
+
+	// Things is how karma for things and topics, as opposed to people,
+	// is handled: ThingsMixed (the default), ThingsSeparate or
+	// ThingsDisabled.
+	Things string
+
+	// karmaDisabled is set by channel policies that turn karma off.
+	karmaDisabled bool
+
+	// Workers is the number of events that are handled concurrently,
+	// and QueueSize is the number of events that each worker may have
+	// waiting before Listen stops reading new events from Slack.
+	Workers, QueueSize int
 }
 
 // A Bot is an instance of karmabot.
 type Bot struct {
-	Config *Config
+	// Config is the bot's current config. It may be replaced by
+	// Reload while the bot is running, so it should only be read
+	// directly by event handlers, which work on a snapshot of it.
+	Config   *Config
+	configMu *sync.RWMutex
+
+	// handlers run with their own context so that shutting down the
+	// listener does not cut off karma operations that are in flight.
+	handlersCtx    context.Context
+	cancelHandlers context.CancelFunc
+	pool           *workerPool
 }
 
 // New returns a pointer to an new instance of karmabot.
 func New(config *Config) *Bot {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Bot{
-		Config: config,
+		Config:         config,
+		configMu:       new(sync.RWMutex),
+		handlersCtx:    ctx,
+		cancelHandlers: cancel,
+		pool:           newWorkerPool(config.Workers, config.QueueSize),
 	}
 }
 
 // Listen starts listening for Slack messages and calls the
-// appropriate handlers.
-func (b *Bot) Listen() {
-	for msg := range b.Config.Slack.IncomingEventsChan() {
+// appropriate handlers. It returns when ctx is cancelled or
+// the incoming events channel is closed.
+func (b *Bot) Listen(ctx context.Context) {
+	events := b.config().Slack.IncomingEventsChan()
+
+	for {
+		var msg slack.RTMEvent
+		select {
+		case <-ctx.Done():
+			return
+		case m, ok := <-events:
+			if !ok {
+				return
+			}
+			msg = m
+		}
+
+		config := b.config()
 		switch ev := msg.Data.(type) {
 		case *slack.ReactionAddedEvent:
-			go b.handleReactionAddedEvent(msg.Data.(*slack.ReactionAddedEvent))
+			b.handle(ctx, ev.ItemUser, func(ctx context.Context) { b.handleReactionAddedEvent(ctx, ev) })
 		case *slack.ReactionRemovedEvent:
-			go b.handleReactionRemovedEvent(msg.Data.(*slack.ReactionRemovedEvent))
+			b.handle(ctx, ev.ItemUser, func(ctx context.Context) { b.handleReactionRemovedEvent(ctx, ev) })
 		case *slack.MessageEvent:
-			go b.handleMessageEvent(msg.Data.(*slack.MessageEvent))
+			b.handle(ctx, messageEventKey(ev), func(ctx context.Context) { b.handleMessageEvent(ctx, ev) })
 		case *slack.ConnectedEvent:
-			b.Config.Log.Info("connected to slack")
+			config.Log.Info("connected to slack")
 
-			if b.Config.Debug {
-				b.Config.Log.KV("info", ev.Info).Info("got slack info")
-				b.Config.Log.KV("connections", ev.ConnectionCount).Info("got connection count")
+			if config.Debug {
+				config.Log.KV("info", ev.Info).Info("got slack info")
+				config.Log.KV("connections", ev.ConnectionCount).Info("got connection count")
 			}
 		case *slack.RTMError:
-			b.Config.Log.Err(ev).Error("slack rtm error")
+			config.Log.Err(ev).Error("slack rtm error")
 		case *slack.InvalidAuthEvent:
-			b.Config.Log.Fatal("invalid slack token")
+			config.Log.Fatal("invalid slack token")
 		default:
-			b.Config.Log.KV("data", msg.Data).KV("event", reflect.TypeOf(msg.Data)).Info("unexpected slack api event")
+			config.Log.KV("data", msg.Data).KV("event", reflect.TypeOf(msg.Data)).Info("unexpected slack api event")
+		}
+	}
+}
+
+// messageEventKey returns the key that a message is queued under. Karma
+// operations are keyed by their target so that operations on the same
+// user are applied in order. Everything else is keyed by channel.
+func messageEventKey(ev *slack.MessageEvent) string {
+	match := regexps.GiveKarma.FindStringSubmatch(ev.Text)
+	if len(match) == 0 {
+		return ev.Channel
+	}
+
+	target := match[1]
+	if target == "" {
+		target = match[4]
+	}
+
+	if m := regexps.SlackUser.FindStringSubmatch(target); len(m) > 0 {
+		return m[1]
+	}
+
+	return strings.ToLower(target)
+}
+
+// handle queues an event handler on the worker pool. Handlers that
+// share a key run in the order in which they were queued. If the
+// handler's queue is full, handle blocks until there is room, or
+// drops the event if ctx is cancelled first.
+func (b *Bot) handle(ctx context.Context, key string, fn func(ctx context.Context)) {
+	job := func() { fn(b.handlersCtx) }
+	config := b.config()
+
+	if b.pool.trySubmit(key, job) {
+		if config.Debug {
+			config.Log.KV("depth", b.QueueDepth()).Info("queued event")
 		}
+		return
+	}
+
+	config.Log.KV("depth", b.QueueDepth()).Info("event queue is full, waiting for workers")
+	if !b.pool.submit(ctx, key, job) {
+		config.Log.KV("key", key).Info("dropped event while shutting down")
+	}
+}
+
+// Reload replaces the bot's config without interrupting its connection
+// to Slack. Events that are already being handled keep using the config
+// that they started with. Workers and QueueSize can not be changed.
+func (b *Bot) Reload(config *Config) {
+	b.configMu.Lock()
+	b.Config = config
+	b.configMu.Unlock()
+}
+
+func (b *Bot) config() *Config {
+	b.configMu.RLock()
+	defer b.configMu.RUnlock()
+
+	return b.Config
+}
+
+// QueueDepth returns the number of events that are waiting
+// to be handled.
+func (b *Bot) QueueDepth() int {
+	return b.pool.depth()
+}
+
+// Shutdown stops the workers once they have handled every queued
+// event. If ctx expires first, the handlers' context is cancelled
+// and ctx's error is returned. Listen must have returned before
+// Shutdown is called.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	b.pool.close()
+
+	done := make(chan struct{})
+	go func() {
+		b.pool.wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		b.cancelHandlers()
+		return nil
+	case <-ctx.Done():
+		b.cancelHandlers()
+		return ctx.Err()
 	}
 }
 
@@ -218,8 +451,14 @@ func (b *Bot) handleError(err error, message *slack.MessageEvent) bool {
 	return true
 }
 
-func (b *Bot) handleReactionAddedEvent(ev *slack.ReactionAddedEvent) {
-	if !b.Config.Reactji.Enabled {
+func (b *Bot) handleReactionAddedEvent(ctx context.Context, ev *slack.ReactionAddedEvent) {
+	channelBot, err := b.inChannel(ctx, ev.Item.Channel)
+	if b.handleError(err, nil) {
+		return
+	}
+	b = channelBot
+
+	if !b.Config.Reactji.Enabled || b.Config.karmaDisabled {
 		return
 	}
 
@@ -237,11 +476,17 @@ func (b *Bot) handleReactionAddedEvent(ev *slack.ReactionAddedEvent) {
 	}
 
 	reason = fmt.Sprintf("added a :%s: reactji", ev.Reaction)
-	b.handleReactionEvent(ev, reason, points)
+	b.handleReactionEvent(ctx, ev, reason, points)
 }
 
-func (b *Bot) handleReactionRemovedEvent(ev *slack.ReactionRemovedEvent) {
-	if !b.Config.Reactji.Enabled {
+func (b *Bot) handleReactionRemovedEvent(ctx context.Context, ev *slack.ReactionRemovedEvent) {
+	channelBot, err := b.inChannel(ctx, ev.Item.Channel)
+	if b.handleError(err, nil) {
+		return
+	}
+	b = channelBot
+
+	if !b.Config.Reactji.Enabled || b.Config.karmaDisabled {
 		return
 	}
 
@@ -259,11 +504,20 @@ func (b *Bot) handleReactionRemovedEvent(ev *slack.ReactionRemovedEvent) {
 	}
 
 	reason = fmt.Sprintf("removed a :%s: reactji", ev.Reaction)
-	b.handleReactionEvent((*slack.ReactionAddedEvent)(ev), reason, points)
+	b.handleReactionEvent(ctx, (*slack.ReactionAddedEvent)(ev), reason, points)
 }
 
 // at this point there is no difference between ReactionAddedEvent and ReactionRemovedEvent
-func (b *Bot) handleReactionEvent(ev *slack.ReactionAddedEvent, reason string, points int) {
+func (b *Bot) handleReactionEvent(ctx context.Context, ev *slack.ReactionAddedEvent, reason string, points int) {
+	allowed, err := b.canGive(ctx, ev.User, points)
+	if b.handleError(err, nil) {
+		return
+	}
+	if !allowed {
+		b.Config.Log.KV("user", ev.User).Info("user is not allowed to give karma, ignoring reactji")
+		return
+	}
+
 	// look up usernames
 	from, err := b.getUserNameByID(ev.User)
 	if b.handleError(err, nil) {
@@ -279,33 +533,42 @@ func (b *Bot) handleReactionEvent(ev *slack.ReactionAddedEvent, reason string, p
 
 	from, to = strings.ToLower(from), strings.ToLower(to)
 
+	err = b.setKinds(ctx, to, database.KindPerson, from)
+	if b.handleError(err, nil) {
+		return
+	}
+
 	// insert points
 	record := &database.Points{
 		From:   from,
 		To:     to,
 		Points: points,
 		Reason: reason,
+		Source: database.SourceReactji,
 	}
 
-	err = b.Config.DB.InsertPoints(record)
+	totals, err := b.Config.DB.InsertPointsBatch(ctx, []*database.Points{record})
 	if b.handleError(err, nil) {
 		return
 	}
 
-	pointsMsg, err := b.getUserPointsMessage(to, reason, points)
-	if b.handleError(err, nil) {
-		return
-	}
+	pointsMsg := pointsMessage(totals[to], reason, points)
 
 	// reply as ephemeral message
 	b.SendMessageEphemeral(pointsMsg, ev.Item.Channel, ev.User, "")
 }
 
-func (b *Bot) handleMessageEvent(ev *slack.MessageEvent) {
+func (b *Bot) handleMessageEvent(ctx context.Context, ev *slack.MessageEvent) {
 	if ev.Type != "message" {
 		return
 	}
 
+	channelBot, err := b.inChannel(ctx, ev.Channel)
+	if b.handleError(err, ev) {
+		return
+	}
+	b = channelBot
+
 	// convert motivates into karmabot syntax
 	if b.Config.Motivate {
 		if match := regexps.Motivate.FindStringSubmatch(ev.Text); len(match) > 0 {
@@ -314,25 +577,47 @@ func (b *Bot) handleMessageEvent(ev *slack.MessageEvent) {
 	}
 
 	switch {
+	case regexps.Admin.MatchString(ev.Text):
+		b.handleAdminCommand(ctx, ev)
+
 	case regexps.URL.MatchString(ev.Text):
-		b.printURL(ev)
+		b.printURL(ctx, ev)
 
 	case regexps.GiveKarma.MatchString(ev.Text):
-		b.givePoints(ev)
+		b.givePoints(ctx, ev)
 
 	case regexps.Leaderboard.MatchString(ev.Text):
-		b.printLeaderboard(ev)
+		b.printLeaderboard(ctx, ev)
+
+	case regexps.Things.MatchString(ev.Text):
+		b.printThings(ctx, ev)
 
 	case regexps.Throwback.MatchString(ev.Text):
-		b.getThrowback(ev)
+		b.getThrowback(ctx, ev)
 
 	case regexps.QueryKarma.MatchString(ev.Text):
-		b.queryKarma(ev)
+		b.queryKarma(ctx, ev)
 	}
 }
 
-func (b *Bot) printURL(ev *slack.MessageEvent) {
-	url, err := b.Config.UI.GetURL("/")
+func (b *Bot) printURL(ctx context.Context, ev *slack.MessageEvent) {
+	allowed, err := b.can(ctx, ev.User, ActionWebUI)
+	if b.handleError(err, ev) {
+		return
+	}
+	if !allowed {
+		b.SendReply("Sorry, you are not allowed to do that.", ev)
+		return
+	}
+
+	name, err := b.getUserNameByID(ev.User)
+	if b.handleError(err, ev) {
+		return
+	}
+
+	// login links sign in whoever clicks them, so they are only sent
+	// to the user that asked for one
+	url, err := b.Config.UI.GetLoginURL(b.Config.Workspace, ev.User, strings.ToLower(name), "/")
 	if b.handleError(err, ev) {
 		return
 	}
@@ -342,15 +627,33 @@ func (b *Bot) printURL(ev *slack.MessageEvent) {
 		return
 	}
 
-	b.SendReply(url, ev)
+	b.DMUser(fmt.Sprintf("Here is your personal link to the web UI. It can only be used once, so please do not share it: %s", url), ev.User)
+	if !strings.HasPrefix(ev.Channel, "D") {
+		b.SendReply("I sent you a link in a direct message.", ev)
+	}
 }
 
-func (b *Bot) givePoints(ev *slack.MessageEvent) {
+// getURL returns a link to a page of the web UI that is scoped
+// to the bot's workspace.
+func (b *Bot) getURL(URI string) (string, error) {
+	if b.Config.Workspace != "" {
+		URI = fmt.Sprintf("/workspace/%s%s", b.Config.Workspace, URI)
+	}
+
+	return b.Config.UI.GetURL(URI)
+}
+
+func (b *Bot) givePoints(ctx context.Context, ev *slack.MessageEvent) {
 	match := regexps.GiveKarma.FindStringSubmatch(ev.Text)
 	if len(match) == 0 {
 		return
 	}
 
+	if b.Config.karmaDisabled {
+		b.Config.Log.KV("channel", ev.Channel).Info("karma is disabled in channel, ignoring karma command")
+		return
+	}
+
 	// forgive me
 	if match[1] != "" {
 		// we matched the first alt expression
@@ -364,13 +667,17 @@ func (b *Bot) givePoints(ev *slack.MessageEvent) {
 	if b.handleError(err, ev) {
 		return
 	}
-	to, err := b.parseUser(match[1])
+	to, err := b.parseUser(ctx, match[1])
 	if b.handleError(err, ev) {
 		return
 	}
 	to = strings.ToLower(to)
 
-	if _, blacklisted := b.Config.UserBlacklist[to]; blacklisted {
+	blacklisted, err := b.isBlacklisted(ctx, to)
+	if b.handleError(err, ev) {
+		return
+	}
+	if blacklisted {
 		b.Config.Log.KV("user", to).Info("user is blacklisted, ignoring karma command")
 		return
 	}
@@ -381,32 +688,48 @@ func (b *Bot) givePoints(ev *slack.MessageEvent) {
 	}
 	reason := match[3]
 
-	if !b.Config.SelfKarma && from == to {
+	allowed, err := b.canGive(ctx, ev.User, points)
+	if b.handleError(err, ev) {
+		return
+	}
+	if !allowed || !b.Config.SelfKarma && from == to {
 		b.SendReply("Sorry, you are not allowed to do that.", ev)
 		return
 	}
 
+	kind, err := b.targetKind(ctx, match[1], to)
+	if b.handleError(err, ev) {
+		return
+	}
+	if kind == database.KindThing && b.Config.Things == ThingsDisabled {
+		b.SendReply("Sorry, karma for things is turned off. Mention people with an @ to give them karma.", ev)
+		return
+	}
+
+	err = b.setKinds(ctx, to, kind, strings.ToLower(from))
+	if b.handleError(err, ev) {
+		return
+	}
+
 	record := &database.Points{
 		From:   from,
 		To:     to,
 		Points: points,
 		Reason: reason,
+		Source: database.SourceMessage,
 	}
 
-	err = b.Config.DB.InsertPoints(record)
+	totals, err := b.Config.DB.InsertPointsBatch(ctx, []*database.Points{record})
 	if b.handleError(err, ev) {
 		return
 	}
 
-	pointsMsg, err := b.getUserPointsMessage(to, reason, points)
-	if b.handleError(err, ev) {
-		return
-	}
+	pointsMsg := pointsMessage(totals[to], reason, points)
 
 	b.SendReply(pointsMsg, ev)
 }
 
-func (b *Bot) getThrowback(ev *slack.MessageEvent) {
+func (b *Bot) getThrowback(ctx context.Context, ev *slack.MessageEvent) {
 	match := regexps.Throwback.FindStringSubmatch(ev.Text)
 	if len(match) == 0 {
 		return
@@ -417,11 +740,20 @@ func (b *Bot) getThrowback(ev *slack.MessageEvent) {
 		err  error
 	)
 	if match[1] != "" {
-		user, err = b.parseUser(match[1])
+		user, err = b.parseUser(ctx, match[1])
 		if b.handleError(err, ev) {
 			return
 		}
 		user = strings.ToLower(user)
+
+		allowed, err := b.canSeeHistory(ctx, ev.User, user)
+		if b.handleError(err, ev) {
+			return
+		}
+		if !allowed {
+			b.SendReply("Sorry, you are not allowed to do that.", ev)
+			return
+		}
 	} else {
 		user, err = b.getUserNameByID(ev.User)
 		if b.handleError(err, ev) {
@@ -429,7 +761,7 @@ func (b *Bot) getThrowback(ev *slack.MessageEvent) {
 		}
 	}
 
-	throwback, err := b.Config.DB.GetThrowback(user)
+	throwback, err := b.Config.DB.GetThrowback(ctx, user)
 	if err == database.ErrNoSuchUser {
 		b.SendReply(fmt.Sprintf("could not find any karma operations for %s", user), ev)
 		return
@@ -448,13 +780,20 @@ func (b *Bot) getThrowback(ev *slack.MessageEvent) {
 	b.SendReply(text, ev)
 }
 
-func (b *Bot) getUserPointsMessage(name, reason string, points int) (string, error) {
-	user, err := b.Config.DB.GetUser(name)
-	if err != nil {
-		return "", err
+// formatPoints formats a user's points, followed by their
+// decayed points if the workspace has karma decay.
+func formatPoints(user *database.User) string {
+	if user.Decayed == nil {
+		return strconv.Itoa(user.Points)
 	}
 
-	text := fmt.Sprintf("%s == %d (", name, user.Points)
+	return fmt.Sprintf("%d, decayed %d", user.Points, *user.Decayed)
+}
+
+// pointsMessage builds the reply to a karma operation, which shows
+// the user's new total and the change.
+func pointsMessage(user *database.User, reason string, points int) string {
+	text := fmt.Sprintf("%s == %s (", user.Name, formatPoints(user))
 
 	if points > 0 {
 		text += "+"
@@ -466,47 +805,60 @@ func (b *Bot) getUserPointsMessage(name, reason string, points int) (string, err
 	}
 	text += ")"
 
-	return text, nil
+	return text
 }
 
-func (b *Bot) printLeaderboard(ev *slack.MessageEvent) {
+func (b *Bot) printLeaderboard(ctx context.Context, ev *slack.MessageEvent) {
 	match := regexps.Leaderboard.FindStringSubmatch(ev.Text)
 	if len(match) == 0 {
 		return
 	}
 
+	b.sendLeaderboard(ctx, ev, match[1], b.Config.peopleKind(), "leaderboard", "/leaderboard")
+}
+
+// sendLeaderboard replies with the top names of a kind, linking
+// to the same list at URI in the web UI. limitS is the number
+// of names that were asked for, if any.
+func (b *Bot) sendLeaderboard(ctx context.Context, ev *slack.MessageEvent, limitS string, kind database.Kind, title, URI string) {
 	limit := b.Config.LeaderboardLimit
-	if match[1] != "" {
+	if limitS != "" {
 		var err error
-		limit, err = strconv.Atoi(match[1])
+		limit, err = strconv.Atoi(limitS)
 		if b.handleError(err, ev) {
 			return
 		}
 	}
 
-	text := fmt.Sprintf("*top %d leaderboard*\n", limit)
+	text := fmt.Sprintf("*top %d %s*\n", limit, title)
 
-	url, err := b.Config.UI.GetURL(fmt.Sprintf("/leaderboard/%d", limit))
+	showURL, err := b.can(ctx, ev.User, ActionWebUI)
 	if b.handleError(err, ev) {
 		return
 	}
-	if url != "" {
-		text = fmt.Sprintf("%s%s\n", text, url)
+	if showURL {
+		url, err := b.getURL(fmt.Sprintf("%s/%d", URI, limit))
+		if b.handleError(err, ev) {
+			return
+		}
+		if url != "" {
+			text = fmt.Sprintf("%s%s\n", text, url)
+		}
 	}
 
-	leaderboard, err := b.Config.DB.GetLeaderboard(limit)
+	leaderboard, err := b.Config.DB.GetLeaderboard(ctx, kind, limit)
 	if b.handleError(err, ev) {
 		return
 	}
 
 	for i, user := range leaderboard {
-		text += fmt.Sprintf("%d. %s == %d\n", i+1, munge.Munge(user.Name), user.Points)
+		text += fmt.Sprintf("%d. %s == %s\n", i+1, munge.Munge(user.Name), formatPoints(user))
 	}
 
 	b.SendReply(text, ev)
 }
 
-func (b *Bot) parseUser(user string) (string, error) {
+func (b *Bot) parseUser(ctx context.Context, user string) (string, error) {
 	if match := regexps.SlackUser.FindStringSubmatch(user); len(match) > 0 {
 		var err error
 		user, err = b.getUserNameByID(match[1])
@@ -517,12 +869,62 @@ func (b *Bot) parseUser(user string) (string, error) {
 
 	// check if it is aliased
 	if alias, ok := b.Config.Aliases[user]; ok {
+		return alias, nil
+	}
+
+	alias, err := b.Config.DB.GetAlias(ctx, strings.ToLower(user))
+	switch err {
+	case nil:
 		user = alias
+	case database.ErrNoSuchAlias:
+	default:
+		return "", err
 	}
 
 	return user, nil
 }
 
+// resolveUser converts a Slack mention into a lowercase username
+// without resolving aliases.
+func (b *Bot) resolveUser(user string) (string, error) {
+	if match := regexps.SlackUser.FindStringSubmatch(user); len(match) > 0 {
+		var err error
+		user, err = b.getUserNameByID(match[1])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.ToLower(user), nil
+}
+
+// setKinds classifies the names that take part in a karma operation.
+// The recipient is of kind, and the giver is always a person, even
+// if they gave karma to their own name.
+func (b *Bot) setKinds(ctx context.Context, to string, kind database.Kind, from string) error {
+	err := b.Config.DB.SetKind(ctx, to, kind)
+	if err != nil {
+		return err
+	}
+
+	return b.Config.DB.SetKind(ctx, from, database.KindPerson)
+}
+
+// isBlacklisted checks both the configured blacklist and the
+// blacklist that is managed through admin commands.
+func (b *Bot) isBlacklisted(ctx context.Context, name string) (bool, error) {
+	if b.Config.UserBlacklist.Contains(name) {
+		return true, nil
+	}
+
+	return b.Config.DB.IsBlacklisted(ctx, name)
+}
+
+// UserName returns the Slack username of the user with the given ID.
+func (b *Bot) UserName(id string) (string, error) {
+	return b.getUserNameByID(id)
+}
+
 func (b *Bot) getUserNameByID(id string) (string, error) {
 	userInfo, err := b.Config.Slack.GetUserInfo(id)
 	if err != nil {
@@ -532,25 +934,43 @@ func (b *Bot) getUserNameByID(id string) (string, error) {
 	return userInfo.Name, nil
 }
 
-func (b *Bot) queryKarma(ev *slack.MessageEvent) {
+func (b *Bot) queryKarma(ctx context.Context, ev *slack.MessageEvent) {
 	match := regexps.QueryKarma.FindStringSubmatch(ev.Text)
 	if len(match) == 0 {
 		return
 	}
 
-	name, err := b.parseUser(match[1])
+	name, err := b.parseUser(ctx, match[1])
 	if b.handleError(err, ev) {
 		return
 	}
 	name = strings.ToLower(name)
 
-	user, err := b.Config.DB.GetUser(name)
+	user, err := b.Config.DB.GetUser(ctx, name)
 	switch {
 	case err == database.ErrNoSuchUser:
 		// override debug mode
 		b.SendReply(err.Error(), ev)
 	case b.handleError(err, ev):
 	default:
-		b.SendReply(fmt.Sprintf("%s == %d", user.Name, user.Points), ev)
+		text := fmt.Sprintf("%s == %s", user.Name, formatPoints(user))
+
+		allowed, err := b.can(ctx, ev.User, ActionWebUI)
+		if b.handleError(err, ev) {
+			return
+		}
+		if allowed {
+			profile, err := b.getURL("/user/" + url.PathEscape(user.Name))
+			if b.handleError(err, ev) {
+				return
+			}
+
+			// ui is disabled
+			if profile != "" {
+				text += "\n" + profile
+			}
+		}
+
+		b.SendReply(text, ev)
 	}
 }
@@ -1,10 +1,14 @@
 package karmabot
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/kamaln7/karmabot/database"
+	"github.com/kamaln7/karmabot/ui/blankui"
+
+	"github.com/aybabtme/log"
 	"github.com/nlopes/slack"
 )
 
@@ -26,7 +30,7 @@ func newBot(cfg *Config) (*Bot, *TestChatService, *TestDatabase) {
 		IncomingEvents: make(chan slack.RTMEvent),
 	}
 	db := &TestDatabase{}
-	db.InsertPoints(&database.Points{
+	db.InsertPoints(context.Background(), &database.Points{
 		From:   "point_giver",
 		To:     "onehundred_points",
 		Points: 100,
@@ -34,6 +38,12 @@ func newBot(cfg *Config) (*Bot, *TestChatService, *TestDatabase) {
 	})
 	cfg.Slack = cs
 	cfg.DB = db
+	if cfg.Log == nil {
+		cfg.Log = log.KV("test", true)
+	}
+	if cfg.UI == nil {
+		cfg.UI = blankui.New()
+	}
 	return New(cfg), cs, db
 }
 
@@ -43,7 +53,7 @@ func TestListen(t *testing.T) {
 	hasStarted := make(chan int)
 	go func() {
 		close(hasStarted)
-		b.Listen()
+		b.Listen(context.Background())
 		hasExited = true
 	}()
 	<-hasStarted
@@ -60,6 +70,27 @@ func TestListen(t *testing.T) {
 	// TODO: To properly test Listen, it needs to be decoupled further from what it actually does.
 }
 
+func TestListenContextCancelled(t *testing.T) {
+	b, _, _ := newBot(&Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	exited := make(chan struct{})
+	go func() {
+		b.Listen(ctx)
+		close(exited)
+	}()
+
+	cancel()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("Listen: did not exit after cancelling its context")
+	}
+
+	if err := b.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
 func TestHandleSlackEvent(t *testing.T) {
 	tt := []struct {
 		Name                 string
@@ -186,13 +217,13 @@ func TestHandleSlackEvent(t *testing.T) {
 		})
 
 		if tc.ReactionAddedEvent != nil {
-			b.handleReactionAddedEvent(tc.ReactionAddedEvent)
+			b.handleReactionAddedEvent(context.Background(), tc.ReactionAddedEvent)
 		}
 		if tc.ReactionRemovedEvent != nil {
-			b.handleReactionRemovedEvent(tc.ReactionRemovedEvent)
+			b.handleReactionRemovedEvent(context.Background(), tc.ReactionRemovedEvent)
 		}
 		if tc.MessageEvent != nil {
-			b.handleMessageEvent(tc.MessageEvent)
+			b.handleMessageEvent(context.Background(), tc.MessageEvent)
 		}
 
 		if len(cs.SentMessages) != 0 && tc.ExpectMessage == "" {
@@ -211,7 +242,7 @@ func TestHandleSlackEvent(t *testing.T) {
 			}
 		}
 
-		u, err := db.GetUser("onehundred_points")
+		u, err := db.GetUser(context.Background(), "onehundred_points")
 		if err != nil {
 			t.Fatalf("%s: db.GetUser: %v", tc.Name, err)
 		}
@@ -221,3 +252,51 @@ func TestHandleSlackEvent(t *testing.T) {
 		}
 	}
 }
+
+func TestReload(t *testing.T) {
+	b, cs, _ := newBot(&Config{
+		MaxPoints: 6,
+	})
+
+	config := *b.Config
+	config.MaxPoints = 1
+	b.Reload(&config)
+
+	b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+		Msg: slack.Msg{
+			Type:    "message",
+			Channel: "C1",
+			User:    "user",
+			Text:    "onehundred_points+++",
+		},
+	})
+
+	if len(cs.SentMessages) != 1 {
+		t.Fatalf("Reload: sent %d messages; want 1", len(cs.SentMessages))
+	}
+	if want := "onehundred_points == 101 (+1)"; cs.SentMessages[0].Text != want {
+		t.Errorf("Reload: sent message %q; want %q", cs.SentMessages[0].Text, want)
+	}
+}
+
+func TestPointsMessage(t *testing.T) {
+	decayed := 3
+
+	tt := []struct {
+		User   *database.User
+		Reason string
+		Points int
+		Want   string
+	}{
+		{&database.User{Name: "alice", Points: 5}, "", 1, "alice == 5 (+1)"},
+		{&database.User{Name: "alice", Points: 5}, "the review", -2, "alice == 5 (-2 for the review)"},
+		{&database.User{Name: "alice", Points: 5, Decayed: &decayed}, "the review", 1, "alice == 5, decayed 3 (+1 for the review)"},
+	}
+
+	for _, tc := range tt {
+		got := pointsMessage(tc.User, tc.Reason, tc.Points)
+		if got != tc.Want {
+			t.Errorf("pointsMessage(%+v, %q, %d): got %q; want %q", tc.User, tc.Reason, tc.Points, got, tc.Want)
+		}
+	}
+}
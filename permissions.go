@@ -0,0 +1,137 @@
+package karmabot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+// An Action is something that users need permission to do.
+type Action string
+
+// Actions that are subject to permissions.
+const (
+	// ActionGiveKarma is giving karma, either in a message or with a reactji.
+	ActionGiveKarma Action = "givekarma"
+	// ActionNegativeKarma is taking karma away from someone.
+	ActionNegativeKarma Action = "negativekarma"
+	// ActionHistory is looking at the karma history of someone else.
+	ActionHistory Action = "history"
+	// ActionAdmin is running admin commands.
+	ActionAdmin Action = "admin"
+	// ActionWebUI is getting links to the web UI and using it.
+	ActionWebUI Action = "webui"
+	// ActionAudit is reading the audit log in the web UI. It always
+	// requires at least the moderator role.
+	ActionAudit Action = "audit"
+)
+
+// Permissions maps actions to the least privileged role that may
+// perform them.
+type Permissions map[Action]database.Role
+
+// DefaultPermissions are used for actions that are not
+// listed in Config.Permissions.
+var DefaultPermissions = Permissions{
+	ActionGiveKarma:     database.RoleMember,
+	ActionNegativeKarma: database.RoleMember,
+	ActionHistory:       database.RoleMember,
+	ActionAdmin:         database.RoleAdmin,
+	ActionWebUI:         database.RoleMember,
+	ActionAudit:         database.RoleModerator,
+}
+
+// Validate checks that all actions and roles exist.
+func (p Permissions) Validate() error {
+	for action, role := range p {
+		if _, ok := DefaultPermissions[action]; !ok {
+			return fmt.Errorf("unknown action %q", action)
+		}
+		if _, err := database.ParseRole(string(role)); err != nil {
+			return err
+		}
+		if action == ActionAudit && !role.AtLeast(database.RoleModerator) {
+			return fmt.Errorf("%s requires at least the %s role", action, database.RoleModerator)
+		}
+	}
+
+	return nil
+}
+
+// role returns the role of a Slack user. Users that are listed in
+// Config.Admins are always admins, and users without a role in the
+// database have Config.DefaultRole.
+func (b *Bot) role(ctx context.Context, userID string) (database.Role, error) {
+	if b.Config.Admins.Contains(userID) {
+		return database.RoleAdmin, nil
+	}
+
+	role, err := b.Config.DB.GetRole(ctx, userID)
+	switch err {
+	case nil:
+		return role, nil
+	case database.ErrNoSuchRole:
+	default:
+		return "", err
+	}
+
+	if b.Config.DefaultRole != "" {
+		return b.Config.DefaultRole, nil
+	}
+
+	return database.RoleMember, nil
+}
+
+// can checks whether a Slack user may perform an action.
+func (b *Bot) can(ctx context.Context, userID string, action Action) (bool, error) {
+	required, ok := b.Config.Permissions[action]
+	if !ok {
+		required = DefaultPermissions[action]
+	}
+
+	role, err := b.role(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return role.AtLeast(required), nil
+}
+
+// Can checks whether a Slack user may perform an action outside
+// of chat, e.g. in the web UI, with the bot's current config.
+func (b *Bot) Can(ctx context.Context, userID string, action Action) (bool, error) {
+	return Can(ctx, b.config(), userID, action)
+}
+
+// Can checks whether a Slack user may perform an action, given the
+// admins, default role and permissions in config and the roles in
+// config.DB.
+func Can(ctx context.Context, config *Config, userID string, action Action) (bool, error) {
+	return (&Bot{Config: config}).can(ctx, userID, action)
+}
+
+// canGive checks whether a Slack user may give an amount of points.
+func (b *Bot) canGive(ctx context.Context, userID string, points int) (bool, error) {
+	allowed, err := b.can(ctx, userID, ActionGiveKarma)
+	if err != nil || !allowed || points >= 0 {
+		return allowed, err
+	}
+
+	return b.can(ctx, userID, ActionNegativeKarma)
+}
+
+// canSeeHistory checks whether a Slack user may look at the karma
+// history of name. Everyone may look at their own history.
+func (b *Bot) canSeeHistory(ctx context.Context, userID, name string) (bool, error) {
+	self, err := b.getUserNameByID(userID)
+	if err != nil {
+		return false, err
+	}
+	if strings.ToLower(self) == name {
+		return true, nil
+	}
+
+	return b.can(ctx, userID, ActionHistory)
+}
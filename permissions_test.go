@@ -0,0 +1,164 @@
+package karmabot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/nlopes/slack"
+)
+
+func TestPermissions(t *testing.T) {
+	tt := []struct {
+		Name             string
+		Role             database.Role
+		DefaultRole      database.Role
+		Permissions      Permissions
+		Text             string
+		ExpectMessage    string
+		ShouldHavePoints int
+	}{
+		{
+			Name:             "members may give karma",
+			Text:             "onehundred_points++",
+			ExpectMessage:    "onehundred_points == 101 (+1)",
+			ShouldHavePoints: 101,
+		},
+		{
+			Name:             "read-only users may not give karma",
+			Role:             database.RoleReadOnly,
+			Text:             "onehundred_points++",
+			ExpectMessage:    "Sorry, you are not allowed to do that.",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "the default role applies to users without a role",
+			DefaultRole:      database.RoleReadOnly,
+			Text:             "onehundred_points++",
+			ExpectMessage:    "Sorry, you are not allowed to do that.",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "members may not give negative karma if restricted",
+			Permissions:      Permissions{ActionNegativeKarma: database.RoleModerator},
+			Text:             "onehundred_points--",
+			ExpectMessage:    "Sorry, you are not allowed to do that.",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "moderators may give negative karma if restricted",
+			Role:             database.RoleModerator,
+			Permissions:      Permissions{ActionNegativeKarma: database.RoleModerator},
+			Text:             "onehundred_points--",
+			ExpectMessage:    "onehundred_points == 99 (-1)",
+			ShouldHavePoints: 99,
+		},
+		{
+			Name:             "members may not see others' history if restricted",
+			Permissions:      Permissions{ActionHistory: database.RoleModerator},
+			Text:             "karmabot throwback onehundred_points",
+			ExpectMessage:    "Sorry, you are not allowed to do that.",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "moderators may run admin commands if allowed",
+			Role:             database.RoleModerator,
+			Permissions:      Permissions{ActionAdmin: database.RoleModerator},
+			Text:             "karmabot admin set onehundred_points 5",
+			ExpectMessage:    "onehundred_points == 5 (-95 for overridden by an admin)",
+			ShouldHavePoints: 5,
+		},
+		{
+			Name:             "members may not run admin commands",
+			Text:             "karmabot admin set onehundred_points 5",
+			ExpectMessage:    "Sorry, you are not allowed to do that.",
+			ShouldHavePoints: 100,
+		},
+		{
+			Name:             "read-only users may not get web UI links",
+			Role:             database.RoleReadOnly,
+			Text:             "karmabot web",
+			ExpectMessage:    "Sorry, you are not allowed to do that.",
+			ShouldHavePoints: 100,
+		},
+	}
+
+	for _, tc := range tt {
+		b, cs, db := newBot(&Config{
+			MaxPoints:   6,
+			SelfKarma:   true,
+			DefaultRole: tc.DefaultRole,
+			Permissions: tc.Permissions,
+			UI:          &TestUIProvider{},
+		})
+		if tc.Role != "" {
+			db.SetRole(context.Background(), "user", tc.Role)
+		}
+
+		b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+			Msg: slack.Msg{
+				Type:    "message",
+				Channel: "C1",
+				User:    "user",
+				Text:    tc.Text,
+			},
+		})
+
+		if len(cs.SentMessages) != 1 {
+			t.Errorf("%s: sent %d messages; want 1", tc.Name, len(cs.SentMessages))
+		} else if msg := cs.SentMessages[0]; msg.Text != tc.ExpectMessage {
+			t.Errorf("%s: sent message %q; want %q", tc.Name, msg.Text, tc.ExpectMessage)
+		}
+
+		u, err := db.GetUser(context.Background(), "onehundred_points")
+		if err != nil {
+			t.Fatalf("%s: db.GetUser: %v", tc.Name, err)
+		}
+		if u.Points != tc.ShouldHavePoints {
+			t.Errorf("%s: user has %d points; want %d", tc.Name, u.Points, tc.ShouldHavePoints)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	b, _, db := newBot(&Config{
+		Admins:      newStringList([]string{"admin"}),
+		DefaultRole: database.RoleReadOnly,
+	})
+	db.SetRole(context.Background(), "member", database.RoleMember)
+
+	tt := []struct {
+		User   string
+		Action Action
+		Expect bool
+	}{
+		{"admin", ActionAdmin, true},
+		{"member", ActionWebUI, true},
+		{"member", ActionAdmin, false},
+		{"nobody", ActionWebUI, false},
+		{"", ActionWebUI, false},
+	}
+
+	for _, tc := range tt {
+		allowed, err := b.Can(context.Background(), tc.User, tc.Action)
+		if err != nil {
+			t.Fatalf("Can(%q, %s): %v", tc.User, tc.Action, err)
+		}
+		if allowed != tc.Expect {
+			t.Errorf("Can(%q, %s) = %v; want %v", tc.User, tc.Action, allowed, tc.Expect)
+		}
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	if !database.RoleAdmin.AtLeast(database.RoleModerator) {
+		t.Errorf("admin is not at least moderator")
+	}
+	if database.RoleReadOnly.AtLeast(database.RoleMember) {
+		t.Errorf("read-only is at least member")
+	}
+	if database.Role("bogus").AtLeast(database.RoleReadOnly) {
+		t.Errorf("unknown role is at least read-only")
+	}
+}
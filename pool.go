@@ -0,0 +1,110 @@
+package karmabot
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// DefaultWorkers is the number of event handling workers that
+	// are started if Config.Workers is not set.
+	DefaultWorkers = 4
+
+	// DefaultQueueSize is the number of events that each worker can
+	// have queued if Config.QueueSize is not set.
+	DefaultQueueSize = 64
+)
+
+// A workerPool runs jobs on a fixed number of workers. Jobs that
+// share a key are always run by the same worker, in the order in
+// which they were submitted.
+type workerPool struct {
+	queues    []chan func()
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	p := &workerPool{
+		queues: make([]chan func(), workers),
+	}
+
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), queueSize)
+
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+
+	return p
+}
+
+func (p *workerPool) work(queue chan func()) {
+	defer p.wg.Done()
+
+	for job := range queue {
+		job()
+	}
+}
+
+func (p *workerPool) queue(key string) chan func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+// trySubmit queues a job without blocking. It returns false
+// if the job's queue is full.
+func (p *workerPool) trySubmit(key string, job func()) bool {
+	select {
+	case p.queue(key) <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// submit queues a job, blocking until there is room in its queue.
+// It returns false if ctx is cancelled before the job is queued.
+func (p *workerPool) submit(ctx context.Context, key string, job func()) bool {
+	select {
+	case p.queue(key) <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// depth returns the number of jobs that are waiting to be run.
+func (p *workerPool) depth() int {
+	var depth int
+	for _, q := range p.queues {
+		depth += len(q)
+	}
+
+	return depth
+}
+
+// close stops accepting jobs. Workers exit once they have run
+// every job that was already queued.
+func (p *workerPool) close() {
+	p.closeOnce.Do(func() {
+		for _, q := range p.queues {
+			close(q)
+		}
+	})
+}
+
+// wait blocks until all workers have exited.
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,119 @@
+package karmabot
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestWorkerPoolOrdering(t *testing.T) {
+	p := newWorkerPool(4, 1)
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string][]int)
+		keys = []string{"alice", "bob", "carol", "dave", "erin"}
+	)
+	for i := 0; i < 100; i++ {
+		for _, key := range keys {
+			i, key := i, key
+			p.submit(context.Background(), key, func() {
+				mu.Lock()
+				seen[key] = append(seen[key], i)
+				mu.Unlock()
+			})
+		}
+	}
+
+	p.close()
+	p.wait()
+
+	for _, key := range keys {
+		if len(seen[key]) != 100 {
+			t.Fatalf("key %q: ran %d jobs; want 100", key, len(seen[key]))
+		}
+
+		for i, n := range seen[key] {
+			if n != i {
+				t.Errorf("key %q: job %d ran at position %d", key, n, i)
+				break
+			}
+		}
+	}
+}
+
+func TestWorkerPoolBackpressure(t *testing.T) {
+	p := newWorkerPool(1, 2)
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.submit(context.Background(), "key", func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	for i := 0; i < 2; i++ {
+		if !p.trySubmit("key", func() {}) {
+			t.Fatalf("trySubmit: queue full after %d jobs; want room for 2", i)
+		}
+	}
+	if p.trySubmit("key", func() {}) {
+		t.Errorf("trySubmit: accepted a job while the queue was full")
+	}
+	if depth := p.depth(); depth != 2 {
+		t.Errorf("depth: got %d; want 2", depth)
+	}
+
+	close(block)
+	p.close()
+	p.wait()
+
+	if depth := p.depth(); depth != 0 {
+		t.Errorf("depth after close: got %d; want 0", depth)
+	}
+}
+
+func TestWorkerPoolSubmitCancelled(t *testing.T) {
+	p := newWorkerPool(1, 1)
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.submit(context.Background(), "key", func() {
+		close(started)
+		<-block
+	})
+	<-started
+	p.submit(context.Background(), "key", func() {})
+
+	// the queue is full, so submit must give up once ctx is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if p.submit(ctx, "key", func() {}) {
+		t.Errorf("submit: queued a job after ctx was cancelled")
+	}
+
+	close(block)
+	p.close()
+	p.wait()
+}
+
+func TestMessageEventKey(t *testing.T) {
+	tt := []struct {
+		Text, Channel, Want string
+	}{
+		{"Alice++", "C1", "alice"},
+		{"<@U123> ++ for the review", "C1", "U123"},
+		{"thanks <@U123>++", "C1", "U123"},
+		{"karmabot top", "C1", "C1"},
+	}
+
+	for _, tc := range tt {
+		key := messageEventKey(&slack.MessageEvent{Msg: slack.Msg{Text: tc.Text, Channel: tc.Channel}})
+		if key != tc.Want {
+			t.Errorf("messageEventKey(%q): got %q; want %q", tc.Text, key, tc.Want)
+		}
+	}
+}
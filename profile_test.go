@@ -0,0 +1,31 @@
+package karmabot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+func TestQueryKarmaProfileURL(t *testing.T) {
+	b, cs, _ := newBot(&Config{
+		UI:        TestUIProvider{},
+		Workspace: "T123",
+	})
+
+	b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+		Msg: slack.Msg{
+			Type:    "message",
+			Channel: "C1",
+			User:    "user",
+			Text:    "onehundred_points==",
+		},
+	})
+
+	if len(cs.SentMessages) != 1 {
+		t.Fatalf("sent %d messages; want 1", len(cs.SentMessages))
+	}
+	if want := "onehundred_points == 100\nhttp://ui/workspace/T123/user/onehundred_points"; cs.SentMessages[0].Text != want {
+		t.Errorf("sent message %q; want %q", cs.SentMessages[0].Text, want)
+	}
+}
@@ -103,6 +103,21 @@ var regexTests = map[regexPattern]regexTestSuite{
 			"<@>",
 		},
 	},
+	regexPattern{
+		Regex: regexps.Things,
+		Name:  "things",
+	}: regexTestSuite{
+		true: []string{
+			"karma things",
+			"karmabot things",
+			"karmabot things 20",
+		},
+		false: []string{
+			"karmabot things 20f",
+			"karmabot things++",
+			"things++",
+		},
+	},
 	regexPattern{
 		Regex: regexps.URL,
 		Name:  "karmabot web ui",
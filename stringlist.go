@@ -10,6 +10,15 @@ type StringList map[string]struct{}
 
 var _ flag.Value = new(StringList)
 
+func newStringList(values []string) StringList {
+	sl := make(StringList, len(values))
+	for _, v := range values {
+		sl.Set(v)
+	}
+
+	return sl
+}
+
 func (sl *StringList) String() string {
 	var (
 		keys = make([]string, len(*sl))
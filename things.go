@@ -0,0 +1,80 @@
+package karmabot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/nlopes/slack"
+)
+
+// Ways of handling karma for things and topics, as opposed to people.
+// With ThingsMixed, things and people share a leaderboard. With
+// ThingsSeparate, things are left out of the leaderboard and ranked on
+// their own. ThingsDisabled also ignores karma for things.
+const (
+	ThingsMixed    = "mixed"
+	ThingsSeparate = "separate"
+	ThingsDisabled = "disabled"
+)
+
+// ThingsModes lists the valid values of Config.Things.
+var ThingsModes = []string{ThingsMixed, ThingsSeparate, ThingsDisabled}
+
+// ValidThingsMode checks whether mode is one of ThingsModes.
+func ValidThingsMode(mode string) bool {
+	for _, m := range ThingsModes {
+		if m == mode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// peopleKind returns the kind that the leaderboard is limited
+// to, which is everybody unless things are ranked separately.
+func (c *Config) peopleKind() database.Kind {
+	switch c.Things {
+	case ThingsSeparate, ThingsDisabled:
+		return database.KindPerson
+	default:
+		return ""
+	}
+}
+
+// targetKind classifies the target of a karma operation as a person or
+// a thing. target is the name as it was written and name is what it
+// resolved to. Slack mentions, aliases and names that are known to
+// belong to Slack users are people, and everything else is a thing.
+func (b *Bot) targetKind(ctx context.Context, target, name string) (database.Kind, error) {
+	if regexps.SlackUser.MatchString(target) || !strings.EqualFold(target, name) {
+		return database.KindPerson, nil
+	}
+
+	kind, err := b.Config.DB.GetKind(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if kind == database.KindPerson {
+		return kind, nil
+	}
+
+	return database.KindThing, nil
+}
+
+// printThings lists the things with the most karma.
+func (b *Bot) printThings(ctx context.Context, ev *slack.MessageEvent) {
+	match := regexps.Things.FindStringSubmatch(ev.Text)
+	if len(match) == 0 {
+		return
+	}
+
+	if b.Config.Things == ThingsDisabled {
+		b.SendReply("Sorry, karma for things is turned off.", ev)
+		return
+	}
+
+	b.sendLeaderboard(ctx, ev, match[1], database.KindThing, "things", "/things")
+}
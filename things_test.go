@@ -0,0 +1,188 @@
+package karmabot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/nlopes/slack"
+)
+
+func TestGivePointsKinds(t *testing.T) {
+	tt := []struct {
+		Name, Text, Things string
+		Known              map[string]database.Kind
+		To                 string
+		Kind               database.Kind
+		ExpectMessage      string
+	}{
+		{
+			Name:          "thing",
+			Text:          "golang++",
+			To:            "golang",
+			Kind:          database.KindThing,
+			ExpectMessage: "golang == 1 (+1)",
+		},
+		{
+			Name:          "mention",
+			Text:          "<@U1>++",
+			To:            "u1",
+			Kind:          database.KindPerson,
+			ExpectMessage: "u1 == 1 (+1)",
+		},
+		{
+			Name:          "alias",
+			Text:          "ali++",
+			To:            "alice",
+			Kind:          database.KindPerson,
+			ExpectMessage: "alice == 1 (+1)",
+		},
+		{
+			Name:          "known person",
+			Text:          "bob++",
+			Known:         map[string]database.Kind{"bob": database.KindPerson},
+			To:            "bob",
+			Kind:          database.KindPerson,
+			ExpectMessage: "bob == 1 (+1)",
+		},
+		{
+			Name:          "thing with thing karma disabled",
+			Text:          "golang++",
+			Things:        ThingsDisabled,
+			ExpectMessage: "Sorry, karma for things is turned off. Mention people with an @ to give them karma.",
+		},
+		{
+			Name:          "mention with thing karma disabled",
+			Text:          "<@U1>++",
+			Things:        ThingsDisabled,
+			To:            "u1",
+			Kind:          database.KindPerson,
+			ExpectMessage: "u1 == 1 (+1)",
+		},
+	}
+
+	for _, tc := range tt {
+		b, cs, db := newBot(&Config{
+			MaxPoints: 5,
+			SelfKarma: true,
+			Things:    tc.Things,
+			Aliases:   UserAliases{"ali": "alice"},
+		})
+		for name, kind := range tc.Known {
+			db.SetKind(context.Background(), name, kind)
+		}
+
+		b.givePoints(context.Background(), &slack.MessageEvent{
+			Msg: slack.Msg{
+				Type:    "message",
+				Text:    tc.Text,
+				Channel: "channel",
+				User:    "giver",
+			},
+		})
+
+		if len(cs.SentMessages) != 1 {
+			t.Fatalf("%s: sent %d messages; want 1", tc.Name, len(cs.SentMessages))
+		}
+		if got := cs.SentMessages[0].Text; got != tc.ExpectMessage {
+			t.Errorf("%s: sent message %q; want %q", tc.Name, got, tc.ExpectMessage)
+		}
+
+		if tc.To == "" {
+			if len(db.records) != 1 {
+				t.Errorf("%s: recorded karma for a thing", tc.Name)
+			}
+			continue
+		}
+
+		if got := db.kinds[tc.To]; got != tc.Kind {
+			t.Errorf("%s: %s is a %q; want %q", tc.Name, tc.To, got, tc.Kind)
+		}
+		if got := db.kinds["giver"]; got != database.KindPerson {
+			t.Errorf("%s: the giver is a %q; want a person", tc.Name, got)
+		}
+	}
+}
+
+func TestPrintThings(t *testing.T) {
+	tt := []struct {
+		Name, Text, Things string
+		ExpectMessage      string
+	}{
+		{
+			Name:          "leaderboard with mixed things",
+			Text:          "karmabot leaderboard 5",
+			ExpectMessage: "*top 5 leaderboard*\n1. önehundred_points == 100\n2. ġolang == 3\n",
+		},
+		{
+			Name:          "leaderboard with separate things",
+			Text:          "karmabot leaderboard 5",
+			Things:        ThingsSeparate,
+			ExpectMessage: "*top 5 leaderboard*\n1. önehundred_points == 100\n",
+		},
+		{
+			Name:          "things",
+			Text:          "karmabot things",
+			Things:        ThingsSeparate,
+			ExpectMessage: "*top 10 things*\n1. ġolang == 3\n",
+		},
+		{
+			Name:          "things with thing karma disabled",
+			Text:          "karmabot things",
+			Things:        ThingsDisabled,
+			ExpectMessage: "Sorry, karma for things is turned off.",
+		},
+	}
+
+	for _, tc := range tt {
+		b, cs, db := newBot(&Config{
+			LeaderboardLimit: 10,
+			Things:           tc.Things,
+		})
+		db.InsertPoints(context.Background(), &database.Points{
+			From:   "point_giver",
+			To:     "golang",
+			Points: 3,
+		})
+		db.SetKind(context.Background(), "golang", database.KindThing)
+
+		b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+			Msg: slack.Msg{
+				Type:    "message",
+				Text:    tc.Text,
+				Channel: "channel",
+				User:    "user",
+			},
+		})
+
+		if len(cs.SentMessages) != 1 {
+			t.Fatalf("%s: sent %d messages; want 1", tc.Name, len(cs.SentMessages))
+		}
+		if got := cs.SentMessages[0].Text; got != tc.ExpectMessage {
+			t.Errorf("%s: sent message %q; want %q", tc.Name, got, tc.ExpectMessage)
+		}
+	}
+}
+
+func TestThingsURL(t *testing.T) {
+	b, cs, db := newBot(&Config{
+		LeaderboardLimit: 10,
+		UI:               &TestUIProvider{},
+	})
+	db.SetKind(context.Background(), "golang", database.KindThing)
+
+	b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+		Msg: slack.Msg{
+			Type:    "message",
+			Text:    "karmabot things 3",
+			Channel: "channel",
+			User:    "user",
+		},
+	})
+
+	if len(cs.SentMessages) != 1 || !strings.Contains(cs.SentMessages[0].Text, "http://ui/things/3") {
+		t.Errorf("did not link to the things page: %v", cs.SentMessages)
+	}
+}
@@ -1,6 +1,8 @@
 package blankui
 
 import (
+	"context"
+
 	"github.com/kamaln7/karmabot/ui"
 )
 
@@ -21,8 +23,19 @@ func (p *Provider) Listen() error {
 	return nil
 }
 
+// Shutdown does nothing.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return nil
+}
+
 // GetURL returns an empty string which
 // signifies that the UI is disabled.
 func (p *Provider) GetURL(URI string) (string, error) {
 	return "", nil
 }
+
+// GetLoginURL returns an empty string which
+// signifies that the UI is disabled.
+func (p *Provider) GetLoginURL(team, user, name, URI string) (string, error) {
+	return "", nil
+}
@@ -1,8 +1,12 @@
 package ui
 
+import "context"
+
 // A Provider provides a UI service that can be
 // attached to karmabot.
 type Provider interface {
 	GetURL(URI string) (string, error)
+	GetLoginURL(team, user, name, URI string) (string, error)
 	Listen() error
+	Shutdown(ctx context.Context) error
 }
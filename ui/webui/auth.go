@@ -1,25 +1,226 @@
 package webui
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kamaln7/karmabot/database"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Actions that sessions need permission for, as checked by
+// Config.Authorize. They match the bot's actions of the same name.
+const (
+	// ActionWebUI is using the web UI at all.
+	ActionWebUI = "webui"
+	// ActionHistory is looking at the profile of someone else.
+	ActionHistory = "history"
+	// ActionAudit is reading the audit log.
+	ActionAudit = "audit"
 )
 
+// errNotAllowed is returned when a session may not perform an action.
+var errNotAllowed = errors.New("you are not allowed to see this page")
+
+// sessionKey is the context key of the session of a request.
+type sessionKey struct{}
+
 // MustAuth wraps an http.HandlerFunc and ensures that the
 // user is authenticated before the said HandlerFunc is
 // executed. The user is redirected to a "session expired"
-// page if they are not authenticated.
+// page if they are not authenticated, or to Slack's sign
+// in page when signing in with Slack. Users that may not
+// use the web UI are turned away.
 func (h *Handlers) MustAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authed, err := h.ui.authenticator.Authenticate(w, r)
+		session, err := h.ui.authenticator.Authenticate(w, r)
 		if err != nil {
 			h.ui.renderError(w, err)
+			return
 		}
 
-		if authed {
+		switch {
+		case session != nil:
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, session))
+
+			allowed, err := h.allowed(r, ActionWebUI)
+			if err != nil {
+				h.ui.renderError(w, err)
+				return
+			}
+			if !allowed {
+				h.ui.renderError(w, errors.New("you are not allowed to use the web UI"))
+				return
+			}
+
 			next(w, r)
-		} else {
-			h.ui.renderError(w, errors.New(`your session has expired. Please type "karmabot web" and click on the generated url`))
+		case h.ui.oidc != nil && r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/"):
+			values := url.Values{}
+			values.Set("next", r.URL.RequestURI())
+			http.Redirect(w, r, "/auth/slack/login?"+values.Encode(), http.StatusFound)
+		case h.ui.oidc != nil:
+			h.ui.renderError(w, errors.New("please sign in with slack"))
+		default:
+			h.ui.renderError(w, errors.New(`please type "karmabot web" in Slack and click on the link that karmabot sends you`))
 		}
 	}
 }
+
+// session returns the session that MustAuth
+// authenticated the request with.
+func session(r *http.Request) *database.Session {
+	session, _ := r.Context().Value(sessionKey{}).(*database.Session)
+	return session
+}
+
+// allowed checks whether the user of the session of the request may
+// perform an action.
+func (h *Handlers) allowed(r *http.Request, action string) (bool, error) {
+	s := session(r)
+	if h.ui.Config.Authorize == nil || s == nil {
+		return true, nil
+	}
+
+	allowed, err := h.ui.Config.Authorize(r.Context(), s.Team, s.User, action)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", s.User).KV("action", action).Error("could not check permissions")
+
+		return false, err
+	}
+
+	return allowed, nil
+}
+
+// oidcCookie holds the state and nonce of a sign in with Slack, and
+// the page to return to afterwards, until Slack sends the user back.
+const oidcCookie = "oidc"
+
+// SlackLogin sends the user to Slack's sign in page.
+func (h *Handlers) SlackLogin(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		state = uuid.NewV4().String()
+		nonce = uuid.NewV4().String()
+		team  string
+	)
+
+	// ask users to sign in to the workspace, if there is only one
+	workspaces, err := h.ui.Config.DB.GetWorkspaces(ctx)
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not get workspaces")
+		h.ui.renderError(w, err)
+		return
+	}
+	if len(workspaces) == 1 {
+		team = workspaces[0].ID
+	}
+
+	authURL, err := h.ui.oidc.AuthCodeURL(ctx, state, nonce, team)
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not start signing in with slack")
+		h.ui.renderError(w, errors.New("could not sign in with slack"))
+		return
+	}
+
+	values := url.Values{}
+	values.Set("state", state)
+	values.Set("nonce", nonce)
+	values.Set("next", r.URL.Query().Get("next"))
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    values.Encode(),
+		Path:     "/auth/slack/",
+		MaxAge:   10 * 60,
+		Secure:   !h.ui.Config.InsecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// SlackCallback signs in users that Slack sent back
+// after they signed in, if they are members of one of
+// karmabot's workspaces.
+func (h *Handlers) SlackCallback(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx   = r.Context()
+		query = r.URL.Query()
+	)
+
+	if e := query.Get("error"); e != "" {
+		h.ui.renderError(w, errors.New("could not sign in with slack: "+e))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		h.ui.renderError(w, errors.New("your sign in has expired. Please try again"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcCookie,
+		Path:   "/auth/slack/",
+		MaxAge: -1,
+	})
+
+	saved, err := url.ParseQuery(cookie.Value)
+	if err != nil || saved.Get("state") == "" || saved.Get("state") != query.Get("state") {
+		h.ui.renderError(w, errors.New("your sign in has expired. Please try again"))
+		return
+	}
+
+	user, err := h.ui.oidc.Exchange(ctx, query.Get("code"), saved.Get("nonce"))
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not sign in with slack")
+		h.ui.renderError(w, errors.New("could not sign in with slack"))
+		return
+	}
+
+	workspaces, err := h.ui.Config.DB.GetWorkspaces(ctx)
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not get workspaces")
+		h.ui.renderError(w, err)
+		return
+	}
+
+	member := false
+	for _, workspace := range workspaces {
+		if workspace.ID == user.TeamID {
+			member = true
+			break
+		}
+	}
+	if !member {
+		h.ui.Config.Log.KV("user", user.UserID).KV("workspace", user.TeamID).Info("rejected sign in from another workspace")
+		h.ui.renderError(w, errors.New("you are not a member of this workspace"))
+		return
+	}
+
+	if h.ui.Config.UserName != nil {
+		user.Name, err = h.ui.Config.UserName(ctx, user.TeamID, user.UserID)
+		if err != nil {
+			h.ui.Config.Log.Err(err).KV("user", user.UserID).KV("workspace", user.TeamID).Error("could not look up the slack username")
+			h.ui.renderError(w, errors.New("could not sign in with slack"))
+			return
+		}
+	}
+
+	_, err = h.ui.authenticator.Login(w, r, user)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+	h.ui.Config.Log.KV("user", user.UserID).KV("workspace", user.TeamID).Info("signed in with slack")
+
+	// only redirect to pages on this site
+	next := saved.Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
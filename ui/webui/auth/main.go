@@ -1,127 +1,268 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"net/http"
-	"sync"
 	"time"
 
+	"github.com/kamaln7/karmabot/database"
+
 	"github.com/aybabtme/log"
-	"github.com/pquerna/otp/totp"
-	"github.com/satori/go.uuid"
 )
 
+// DefaultLifetime is how long sessions last by default.
+const DefaultLifetime = 48 * time.Hour
+
+// LoginLinkLifetime is how long single-use login links
+// can be used for.
+const LoginLinkLifetime = 10 * time.Minute
+
+// cookieName is the name of the session cookie.
+const cookieName = "session"
+
 // Config contains the config options for the
-// TOTP authentication serivce that is used
+// authentication serivce that is used
 // for the web UI.
 type Config struct {
-	Token string
-	Log   *log.Log
+	Log *log.Log
+	DB  *database.DB
+
+	// Lifetime is how long sessions last. It defaults to DefaultLifetime.
+	Lifetime time.Duration
+
+	// InsecureCookies allows session cookies to be sent over plain
+	// HTTP. It should only be set when the web UI is not served over
+	// HTTPS.
+	InsecureCookies bool
+
+	// Done stops deleting expired sessions when it is closed.
+	Done <-chan struct{}
 }
 
-// An Authenticator contains a list of authenticated
-// web UI sessions and exposes a few functions
+// An Authenticator keeps track of authenticated web UI
+// sessions in the database and exposes a few functions
 // for authenticating users and generating tokens.
 type Authenticator struct {
-	Config        *Config
-	authedClients []*Client
-	clientsMutex  sync.RWMutex
-}
-
-// A Client is an authenticated web UI session
-type Client struct {
-	UUID  string
-	Added time.Time
+	Config *Config
 }
 
 // New returns a new Authenticator instance and spins
-// up a goroutine that handles expiring sessions
+// up a goroutine that deletes expired sessions until
+// config.Done is closed
 func New(config *Config) *Authenticator {
+	if config.Lifetime <= 0 {
+		config.Lifetime = DefaultLifetime
+	}
+
 	authenticator := &Authenticator{
 		Config: config,
 	}
 
-	go authenticator.ExpireClients()
+	go authenticator.ExpireSessions()
 	return authenticator
 }
 
 // Authenticate logs in the client if the request contains
-// a token and checks whether the current request is
+// a login token and returns the session of the current request.
+// It returns a nil session if the request is not
 // authenticated.
-func (a *Authenticator) Authenticate(w http.ResponseWriter, r *http.Request) (bool, error) {
-	cookie, err := r.Cookie("session")
+func (a *Authenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*database.Session, error) {
+	// a login link signs in its user even if the client
+	// already has a session, e.g. of someone else
+	user, err := a.useLoginToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return a.Login(w, r, user)
+	}
+
+	session, err := a.Session(r)
+	if err == nil {
+		return session, nil
+	}
+	if err != database.ErrNoSuchSession {
+		a.Config.Log.Err(err).Error("could not authenticate user")
 
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// Session returns the session of the current request. It returns
+// database.ErrNoSuchSession if the request is not authenticated.
+func (a *Authenticator) Session(r *http.Request) (*database.Session, error) {
+	cookie, err := r.Cookie(cookieName)
+	if err == http.ErrNoCookie {
+		return nil, database.ErrNoSuchSession
+	}
 	if err != nil {
-		if err != http.ErrNoCookie {
-			a.Config.Log.Err(err).Error("could not authenticate user")
+		return nil, err
+	}
 
-			return false, err
-		}
+	session, err := a.Config.DB.GetSession(r.Context(), hashToken(cookie.Value))
+	if err != nil {
+		return nil, err
+	}
 
-		err = nil
+	// sessions that were started with TOTP tokens, before they were
+	// replaced by login links, do not belong to anyone
+	if session.User == "" {
+		return nil, database.ErrNoSuchSession
 	}
 
-	authed := false
-	if cookie != nil {
-		a.clientsMutex.RLock()
-		for _, client := range a.authedClients {
-			if cookie.Value == client.UUID {
-				authed = true
-				break
-			}
-		}
-		a.clientsMutex.RUnlock()
+	return session, nil
+}
+
+// Login starts a new session for a user that signed in with
+// OpenID Connect or a login link.
+func (a *Authenticator) Login(w http.ResponseWriter, r *http.Request, user *Identity) (*database.Session, error) {
+	token, err := newToken()
+	if err != nil {
+		a.Config.Log.Err(err).Error("could not generate session token")
+
+		return nil, err
 	}
 
-	if !authed && a.hasValidToken(r) {
-		cookie = &http.Cookie{
-			Name:  "session",
-			Value: uuid.NewV4().String(),
-			Path:  "/",
-		}
+	now := time.Now()
+	session := &database.Session{
+		ID:      hashToken(token),
+		Team:    user.TeamID,
+		User:    user.UserID,
+		Name:    user.Name,
+		Created: now,
+		Expires: now.Add(a.Config.Lifetime),
+	}
 
-		a.clientsMutex.Lock()
-		a.authedClients = append(a.authedClients, &Client{
-			UUID:  cookie.Value,
-			Added: time.Now(),
-		})
-		a.clientsMutex.Unlock()
+	err = a.Config.DB.CreateSession(r.Context(), session)
+	if err != nil {
+		a.Config.Log.Err(err).Error("could not save session")
+
+		return nil, err
+	}
+
+	http.SetCookie(w, a.cookie(token, int(a.Config.Lifetime.Seconds())))
+	return session, nil
+}
+
+// NewLoginToken returns a single-use token that signs in the given
+// user. It expires after LoginLinkLifetime.
+func (a *Authenticator) NewLoginToken(ctx context.Context, user *Identity) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
 
-		authed = true
-		http.SetCookie(w, cookie)
+	now := time.Now()
+	err = a.Config.DB.CreateLoginToken(ctx, &database.Session{
+		ID:      hashToken(token),
+		Team:    user.TeamID,
+		User:    user.UserID,
+		Name:    user.Name,
+		Created: now,
+		Expires: now.Add(LoginLinkLifetime),
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return authed, nil
+	return token, nil
 }
 
-func (a *Authenticator) hasValidToken(r *http.Request) bool {
-	token := r.URL.Query().Get("token")
+// useLoginToken returns the user that the login token in the
+// request signs in, or nil if there is no valid login token.
+func (a *Authenticator) useLoginToken(r *http.Request) (*Identity, error) {
+	token := r.URL.Query().Get("login")
 	if token == "" {
-		return false
+		return nil, nil
+	}
+
+	login, err := a.Config.DB.UseLoginToken(r.Context(), hashToken(token))
+	if err == database.ErrNoSuchSession {
+		return nil, nil
+	}
+	if err != nil {
+		a.Config.Log.Err(err).Error("could not use login token")
+
+		return nil, err
 	}
 
-	return totp.Validate(token, a.Config.Token)
+	return &Identity{
+		UserID: login.User,
+		TeamID: login.Team,
+		Name:   login.Name,
+	}, nil
 }
 
-// ExpireClients expires all sessions that have been logged
-// in for 48+ hours.
-func (a *Authenticator) ExpireClients() {
-	for {
-		<-time.After(2 * time.Minute)
+// Logout ends the session of the current request, if any.
+func (a *Authenticator) Logout(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, a.cookie("", -1))
+
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return nil
+	}
+
+	err = a.Config.DB.DeleteSession(r.Context(), hashToken(cookie.Value))
+	if err == database.ErrNoSuchSession {
+		return nil
+	}
+
+	return err
+}
+
+// cookie returns a session cookie. Session cookies can not be read by
+// JavaScript, are not sent along with cross-site subrequests and, unless
+// InsecureCookies is set, are only sent over HTTPS.
+func (a *Authenticator) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     cookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   !a.Config.InsecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
 
-		now := time.Now()
+// ExpireSessions periodically deletes expired sessions
+// from the database until Config.Done is closed.
+func (a *Authenticator) ExpireSessions() {
+	for {
+		select {
+		case <-a.Config.Done:
+			return
+		case <-time.After(2 * time.Minute):
+		}
 
-		a.clientsMutex.Lock()
-		for i := len(a.authedClients) - 1; i >= 0; i-- {
-			if now.Sub(a.authedClients[i].Added).Hours() >= 48 {
-				a.authedClients = append(a.authedClients[:i], a.authedClients[i+1:]...)
-			}
+		n, err := a.Config.DB.DeleteExpiredSessions(context.Background())
+		if err != nil {
+			a.Config.Log.Err(err).Error("could not delete expired sessions")
+		} else if n > 0 {
+			a.Config.Log.KV("sessions", n).Info("deleted expired sessions")
 		}
-		a.clientsMutex.Unlock()
 	}
 }
 
-// GetToken generates a TOTP token that is
-// valid for 30 seconds.
-func (a *Authenticator) GetToken() (string, error) {
-	return totp.GenerateCode(a.Config.Token, time.Now())
+// newToken returns a random session token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the ID of the session with the given token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
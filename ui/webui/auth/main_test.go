@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/aybabtme/log"
+)
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	db, err := database.New(&database.Config{Path: filepath.Join(t.TempDir(), "karma.sqlite3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	return New(&Config{
+		Log:  log.KV("test", true),
+		DB:   db,
+		Done: done,
+	})
+}
+
+func TestSession(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAuthenticator(t)
+
+	now := time.Now()
+	for token, user := range map[string]string{"totp": "", "user": "U1"} {
+		err := a.Config.DB.CreateSession(ctx, &database.Session{
+			ID:      hashToken(token),
+			Team:    "T1",
+			User:    user,
+			Created: now,
+			Expires: now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		Name       string
+		Cookie     string
+		ExpectUser string
+		ExpectErr  error
+	}{
+		{
+			Name:      "no cookie",
+			ExpectErr: database.ErrNoSuchSession,
+		},
+		{
+			Name:      "unknown session",
+			Cookie:    "unknown",
+			ExpectErr: database.ErrNoSuchSession,
+		},
+		{
+			Name:      "totp session",
+			Cookie:    "totp",
+			ExpectErr: database.ErrNoSuchSession,
+		},
+		{
+			Name:       "user session",
+			Cookie:     "user",
+			ExpectUser: "U1",
+		},
+	}
+
+	for _, tc := range tt {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.Cookie != "" {
+			r.AddCookie(&http.Cookie{Name: cookieName, Value: tc.Cookie})
+		}
+
+		session, err := a.Session(r)
+		if err != tc.ExpectErr {
+			t.Errorf("%s: got error %v; want %v", tc.Name, err, tc.ExpectErr)
+		}
+		if err == nil && session.User != tc.ExpectUser {
+			t.Errorf("%s: got user %q; want %q", tc.Name, session.User, tc.ExpectUser)
+		}
+	}
+}
+
+func TestAuthenticateLoginToken(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAuthenticator(t)
+
+	token, err := a.NewLoginToken(ctx, &Identity{TeamID: "T1", UserID: "U1", Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	session, err := a.Authenticate(w, httptest.NewRequest("GET", "/?login="+token, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session == nil || session.Team != "T1" || session.User != "U1" || session.Name != "alice" {
+		t.Fatalf("got session %+v; want a session of alice", session)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != cookieName {
+		t.Fatalf("got cookies %+v; want a session cookie", cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	if got, err := a.Session(r); err != nil || got.ID != session.ID {
+		t.Errorf("got session %+v, %v for the cookie; want %+v", got, err, session)
+	}
+
+	// login links can only be used once
+	session, err = a.Authenticate(httptest.NewRecorder(), httptest.NewRequest("GET", "/?login="+token, nil))
+	if err != nil || session != nil {
+		t.Errorf("got session %+v, %v for a used login token; want none", session, err)
+	}
+}
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlackIssuer is the OpenID Connect issuer of "Sign in with Slack".
+const SlackIssuer = "https://slack.com"
+
+// OIDCConfig contains the config options for
+// signing in with an OpenID Connect provider.
+type OIDCConfig struct {
+	// Issuer is the URL of the provider. It defaults to SlackIssuer,
+	// and can point at a local provider for testing.
+	Issuer string
+
+	ClientID, ClientSecret string
+
+	// RedirectURL is the URL that the provider sends
+	// users back to after they sign in.
+	RedirectURL string
+
+	// HTTPClient is used to talk to the provider.
+	// It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// An OIDC signs users in with an OpenID Connect provider using the
+// authorization code flow.
+type OIDC struct {
+	Config *OIDCConfig
+
+	// the provider's endpoints are discovered on first use
+	provider      *oidcProvider
+	providerMutex sync.Mutex
+}
+
+// An Identity is a user that signed in with an OpenID Connect provider.
+type Identity struct {
+	UserID, TeamID, Name, Email string
+}
+
+// oidcProvider is the part of an OpenID Connect provider's
+// configuration document that karmabot uses.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// NewOIDC returns a new OIDC instance.
+func NewOIDC(config *OIDCConfig) *OIDC {
+	if config.Issuer == "" {
+		config.Issuer = SlackIssuer
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	return &OIDC{
+		Config: config,
+	}
+}
+
+// AuthCodeURL returns the URL of the provider's sign in page. state
+// and nonce should be random values that are checked when the user
+// is sent back. If team is not empty, Slack asks the user to sign in
+// to that workspace.
+func (o *OIDC) AuthCodeURL(ctx context.Context, state, nonce, team string) (string, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("scope", "openid profile email")
+	query.Set("client_id", o.Config.ClientID)
+	query.Set("redirect_uri", o.Config.RedirectURL)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	if team != "" {
+		query.Set("team", team)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange redeems the authorization code that the provider sent the
+// user back with, and returns the user's identity from the ID token.
+// nonce must be the nonce that was passed to AuthCodeURL.
+func (o *OIDC) Exchange(ctx context.Context, code, nonce string) (*Identity, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.Config.RedirectURL)
+	form.Set("client_id", o.Config.ClientID)
+	form.Set("client_secret", o.Config.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		IDToken string `json:"id_token"`
+
+		// Slack responds with 200 OK and ok: false on errors
+		OK    *bool  `json:"ok"`
+		Error string `json:"error"`
+	}
+	err = o.do(req, &token)
+	if err != nil {
+		return nil, fmt.Errorf("could not redeem authorization code: %v", err)
+	}
+	if token.OK != nil && !*token.OK || token.Error != "" {
+		return nil, fmt.Errorf("could not redeem authorization code: %s", token.Error)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("the provider did not return an ID token")
+	}
+
+	return o.verify(token.IDToken, provider.Issuer, nonce)
+}
+
+// verify checks an ID token's claims and returns the identity that it
+// contains. The token's signature is not checked: the token was
+// received directly from the token endpoint over TLS, so the OpenID
+// Connect spec allows relying on TLS to authenticate it instead
+// (OpenID Connect Core 1.0, section 3.1.3.7).
+func (o *OIDC) verify(idToken, issuer, nonce string) (*Identity, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token: %v", err)
+	}
+
+	var claims struct {
+		Issuer   string   `json:"iss"`
+		Subject  string   `json:"sub"`
+		Audience audience `json:"aud"`
+		Expiry   int64    `json:"exp"`
+		Nonce    string   `json:"nonce"`
+		Name     string   `json:"name"`
+		Email    string   `json:"email"`
+
+		// Slack adds the user's and workspace's IDs
+		UserID string `json:"https://slack.com/user_id"`
+		TeamID string `json:"https://slack.com/team_id"`
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token: %v", err)
+	}
+
+	switch {
+	case claims.Issuer != issuer:
+		return nil, fmt.Errorf("ID token was issued by %q instead of %q", claims.Issuer, issuer)
+	case !claims.Audience.contains(o.Config.ClientID):
+		return nil, errors.New("ID token was issued to another client")
+	case time.Now().After(time.Unix(claims.Expiry, 0)):
+		return nil, errors.New("ID token has expired")
+	case claims.Nonce != nonce:
+		return nil, errors.New("ID token has an invalid nonce")
+	}
+
+	identity := &Identity{
+		UserID: claims.UserID,
+		TeamID: claims.TeamID,
+		Name:   claims.Name,
+		Email:  claims.Email,
+	}
+	if identity.UserID == "" {
+		identity.UserID = claims.Subject
+	}
+
+	return identity, nil
+}
+
+// discover fetches and caches the provider's configuration document.
+func (o *OIDC) discover(ctx context.Context) (*oidcProvider, error) {
+	o.providerMutex.Lock()
+	defer o.providerMutex.Unlock()
+
+	if o.provider != nil {
+		return o.provider, nil
+	}
+
+	issuer := strings.TrimSuffix(o.Config.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &oidcProvider{}
+	err = o.do(req, provider)
+	if err != nil {
+		return nil, fmt.Errorf("could not discover the OpenID Connect provider %s: %v", issuer, err)
+	}
+
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("the OpenID Connect provider %s claims to be %q", issuer, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" {
+		return nil, fmt.Errorf("the OpenID Connect provider %s is missing an authorization or token endpoint", issuer)
+	}
+
+	o.provider = provider
+	return provider, nil
+}
+
+// do sends a request and decodes the JSON response into v.
+func (o *OIDC) do(req *http.Request, v interface{}) error {
+	res, err := o.Config.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// audience is an ID token's aud claim, which
+// is either a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+
+	return false
+}
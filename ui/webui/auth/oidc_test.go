@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOIDCProvider is a local OpenID Connect provider that issues
+// ID tokens with the claims that Slack uses.
+type fakeOIDCProvider struct {
+	*httptest.Server
+
+	// claims are added to every ID token
+	claims map[string]interface{}
+	codes  map[string]string // code -> nonce
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	p := &fakeOIDCProvider{
+		codes: make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "secret" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_client"})
+			return
+		}
+
+		nonce, ok := p.codes[r.FormValue("code")]
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "invalid_code"})
+			return
+		}
+
+		claims := map[string]interface{}{
+			"iss":                       p.URL,
+			"sub":                       "U1",
+			"aud":                       r.FormValue("client_id"),
+			"exp":                       time.Now().Add(time.Hour).Unix(),
+			"nonce":                     nonce,
+			"name":                      "Alice",
+			"https://slack.com/user_id": "U1",
+			"https://slack.com/team_id": "T1",
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+
+		payload, _ := json.Marshal(claims)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":       true,
+			"id_token": "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".",
+		})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func newTestOIDC(p *fakeOIDCProvider) *OIDC {
+	return NewOIDC(&OIDCConfig{
+		Issuer:       p.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://karmabot/auth/slack/callback",
+	})
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	p := newFakeOIDCProvider(t)
+	o := newTestOIDC(p)
+
+	authURL, err := o.AuthCodeURL(context.Background(), "state", "nonce", "T1")
+	if err != nil {
+		t.Fatalf("could not get auth code url: %v", err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth code url %q: %v", authURL, err)
+	}
+	if got, want := u.Scheme+"://"+u.Host+u.Path, p.URL+"/authorize"; got != want {
+		t.Errorf("got authorization endpoint %q, want %q", got, want)
+	}
+
+	query := u.Query()
+	for param, want := range map[string]string{
+		"response_type": "code",
+		"client_id":     "client",
+		"redirect_uri":  "http://karmabot/auth/slack/callback",
+		"state":         "state",
+		"nonce":         "nonce",
+		"team":          "T1",
+	} {
+		if got := query.Get(param); got != want {
+			t.Errorf("got %s %q, want %q", param, got, want)
+		}
+	}
+	if !strings.Contains(query.Get("scope"), "openid") {
+		t.Errorf("scope %q does not include openid", query.Get("scope"))
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		code   string
+		nonce  string
+		want   *Identity
+		err    string
+	}{
+		{
+			name:  "valid",
+			code:  "code",
+			nonce: "nonce",
+			want:  &Identity{UserID: "U1", TeamID: "T1", Name: "Alice"},
+		},
+		{
+			name:   "audience list",
+			claims: map[string]interface{}{"aud": []string{"other", "client"}},
+			code:   "code",
+			nonce:  "nonce",
+			want:   &Identity{UserID: "U1", TeamID: "T1", Name: "Alice"},
+		},
+		{
+			name:  "wrong nonce",
+			code:  "code",
+			nonce: "other",
+			err:   "nonce",
+		},
+		{
+			name:  "unknown code",
+			code:  "other",
+			nonce: "nonce",
+			err:   "invalid_code",
+		},
+		{
+			name:   "another client",
+			claims: map[string]interface{}{"aud": "other"},
+			code:   "code",
+			nonce:  "nonce",
+			err:    "another client",
+		},
+		{
+			name:   "another issuer",
+			claims: map[string]interface{}{"iss": "https://example.com"},
+			code:   "code",
+			nonce:  "nonce",
+			err:    "issued by",
+		},
+		{
+			name:   "expired",
+			claims: map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()},
+			code:   "code",
+			nonce:  "nonce",
+			err:    "expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newFakeOIDCProvider(t)
+			p.claims = tt.claims
+			p.codes["code"] = "nonce"
+
+			got, err := newTestOIDC(p).Exchange(context.Background(), tt.code, tt.nonce)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("could not exchange code: %v", err)
+			}
+			if *got != *tt.want {
+				t.Errorf("got identity %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxSlackRequestAge is how old a request from Slack may be,
+// so that captured requests can not be replayed later on.
+const maxSlackRequestAge = 5 * time.Minute
+
+// maxSlackRequestSize limits the size of request bodies from Slack.
+const maxSlackRequestSize = 1 << 20
+
+// ErrInvalidSignature is returned for requests that were
+// not signed with the Slack app's signing secret.
+var ErrInvalidSignature = errors.New("invalid slack request signature")
+
+// VerifySlackRequest checks that a request was signed by Slack with the
+// app's signing secret in the last few minutes, and returns its body.
+// See https://api.slack.com/authentication/verifying-requests-from-slack.
+func VerifySlackRequest(r *http.Request, secret string, now time.Time) ([]byte, error) {
+	if secret == "" {
+		return nil, ErrInvalidSignature
+	}
+
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > maxSlackRequestAge || age < -maxSlackRequestAge {
+		return nil, ErrInvalidSignature
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSlackRequestSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(r.Header.Get("X-Slack-Signature")), []byte(SignSlackRequest(secret, timestamp, body))) {
+		return nil, ErrInvalidSignature
+	}
+
+	return body, nil
+}
+
+// SignSlackRequest returns the signature of a request
+// from Slack with the given timestamp and body.
+func SignSlackRequest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
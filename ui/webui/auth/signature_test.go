@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySlackRequest(t *testing.T) {
+	var (
+		now  = time.Unix(1700000000, 0)
+		body = `{"type":"event_callback"}`
+	)
+
+	tt := []struct {
+		Name             string
+		Secret, SignedBy string
+		Timestamp        time.Time
+		Body             string
+		ExpectErr        bool
+	}{
+		{
+			Name:      "valid",
+			Secret:    "secret",
+			SignedBy:  "secret",
+			Timestamp: now,
+		},
+		{
+			Name:      "other secret",
+			Secret:    "secret",
+			SignedBy:  "guess",
+			Timestamp: now,
+			ExpectErr: true,
+		},
+		{
+			Name:      "no secret",
+			Timestamp: now,
+			ExpectErr: true,
+		},
+		{
+			Name:      "old",
+			Secret:    "secret",
+			SignedBy:  "secret",
+			Timestamp: now.Add(-10 * time.Minute),
+			ExpectErr: true,
+		},
+		{
+			Name:      "tampered body",
+			Secret:    "secret",
+			SignedBy:  "secret",
+			Timestamp: now,
+			Body:      `{"type":"url_verification"}`,
+			ExpectErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		timestamp := strconv.FormatInt(tc.Timestamp.Unix(), 10)
+		sent := body
+		if tc.Body != "" {
+			sent = tc.Body
+		}
+
+		r := httptest.NewRequest("POST", "/slack/events", strings.NewReader(sent))
+		r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		r.Header.Set("X-Slack-Signature", SignSlackRequest(tc.SignedBy, timestamp, []byte(body)))
+
+		got, err := VerifySlackRequest(r, tc.Secret, now)
+		if tc.ExpectErr {
+			if err == nil {
+				t.Errorf("%s: accepted the request", tc.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.Name, err)
+		} else if string(got) != body {
+			t.Errorf("%s: got body %q; want %q", tc.Name, got, body)
+		}
+	}
+}
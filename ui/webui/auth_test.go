@@ -0,0 +1,134 @@
+package webui
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+	"github.com/kamaln7/karmabot/ui/webui/auth"
+
+	"github.com/aybabtme/log"
+)
+
+// newSlackProvider returns a local OpenID Connect provider that signs
+// in user U1 of the workspace team for the code "code".
+func newSlackProvider(t *testing.T, team string) *httptest.Server {
+	var p *httptest.Server
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"iss":                       p.URL,
+			"sub":                       "U1",
+			"aud":                       r.FormValue("client_id"),
+			"exp":                       time.Now().Add(time.Hour).Unix(),
+			"nonce":                     "nonce",
+			"name":                      "Alice",
+			"https://slack.com/user_id": "U1",
+			"https://slack.com/team_id": team,
+		})
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":       true,
+			"id_token": "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".",
+		})
+	})
+
+	p = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func TestSlackCallback(t *testing.T) {
+	tt := []struct {
+		Name         string
+		Team         string
+		ExpectStatus int
+		ExpectError  string
+	}{
+		{
+			Name:         "member",
+			Team:         "T1",
+			ExpectStatus: http.StatusFound,
+		},
+		{
+			Name:         "another workspace",
+			Team:         "T2",
+			ExpectStatus: http.StatusOK,
+			ExpectError:  "you are not a member of this workspace",
+		},
+	}
+
+	for _, tc := range tt {
+		ctx := context.Background()
+		db, err := database.New(&database.Config{Path: filepath.Join(t.TempDir(), "karma.sqlite3")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		err = db.SaveWorkspace(ctx, &database.Workspace{ID: "T1", Name: "one"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := newSlackProvider(t, tc.Team)
+		provider, err := New(&Config{
+			URL:  "http://karmabot",
+			Auth: AuthSlack,
+			Slack: &auth.OIDCConfig{
+				Issuer:       p.URL,
+				ClientID:     "client",
+				ClientSecret: "secret",
+			},
+			UserName: func(ctx context.Context, team, user string) (string, error) {
+				return "alice", nil
+			},
+			InsecureCookies: true,
+			Log:             log.KV("test", true),
+			DB:              db,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest("GET", "/auth/slack/callback?code=code&state=state", nil)
+		r.AddCookie(&http.Cookie{Name: oidcCookie, Value: "state=state&nonce=nonce&next=%2Fleaderboard"})
+		w := httptest.NewRecorder()
+		provider.ui.router.ServeHTTP(w, r)
+
+		if w.Code != tc.ExpectStatus {
+			t.Errorf("%s: got status %d; want %d", tc.Name, w.Code, tc.ExpectStatus)
+		}
+		if tc.ExpectError != "" && !strings.Contains(w.Body.String(), tc.ExpectError) {
+			t.Errorf("%s: got body %q; want %q", tc.Name, w.Body.String(), tc.ExpectError)
+		}
+		if tc.ExpectStatus == http.StatusFound && w.Header().Get("Location") != "/leaderboard" {
+			t.Errorf("%s: redirected to %q; want /leaderboard", tc.Name, w.Header().Get("Location"))
+		}
+
+		sessions, err := db.GetSessions(ctx, "U1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signedIn := len(sessions) == 1; signedIn != (tc.ExpectError == "") {
+			t.Errorf("%s: got sessions %+v", tc.Name, sessions)
+		} else if signedIn && sessions[0].Name != "alice" {
+			t.Errorf("%s: got session name %q; want the slack username alice", tc.Name, sessions[0].Name)
+		}
+	}
+}
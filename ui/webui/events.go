@@ -0,0 +1,44 @@
+package webui
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kamaln7/karmabot/ui/webui/auth"
+)
+
+// eventsRequest is a request from Slack's Events API.
+type eventsRequest struct {
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	TeamID    string          `json:"team_id"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// SlackEvents receives events from Slack's Events API and passes them
+// to Config.Events. Requests that were not signed with the Slack app's
+// signing secret are rejected.
+func (h *Handlers) SlackEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := auth.VerifySlackRequest(r, h.ui.Config.SigningSecret, time.Now())
+	if err != nil {
+		h.ui.Config.Log.Err(err).Info("rejected slack event")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	req := &eventsRequest{}
+	err = json.Unmarshal(body, req)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(req.Challenge))
+	case "event_callback":
+		h.ui.Config.Events(r.Context(), req.TeamID, req.Event)
+	}
+}
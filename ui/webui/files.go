@@ -0,0 +1,80 @@
+package webui
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/kamaln7/karmabot/www"
+)
+
+// files serves the web UI's templates and assets. They are embedded
+// in the binary, and each of them can be overridden by a file with the
+// same name in an optional directory on disk, e.g. for custom themes.
+type files struct {
+	// override is nil if there is no override directory.
+	override fs.FS
+	embedded fs.FS
+}
+
+func newFiles(path string) *files {
+	f := &files{
+		embedded: www.Files,
+	}
+	if path != "" {
+		f.override = os.DirFS(path)
+	}
+
+	return f
+}
+
+// Open implements fs.FS.
+func (f *files) Open(name string) (fs.File, error) {
+	if f.override != nil {
+		file, err := f.override.Open(name)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return file, err
+		}
+	}
+
+	return f.embedded.Open(name)
+}
+
+// list returns the names of all files in dir and its subdirectories,
+// both embedded and in the override directory, in lexical order.
+func (f *files) list(dir string) ([]string, error) {
+	var (
+		names []string
+		seen  = make(map[string]bool)
+	)
+
+	for _, fsys := range []fs.FS{f.override, f.embedded} {
+		if fsys == nil {
+			continue
+		}
+
+		err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+			// the override directory does not have to contain dir
+			if name == dir && errors.Is(err, fs.ErrNotExist) && fsys == f.override {
+				return fs.SkipDir
+			}
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,184 @@
+package webui
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/kamaln7/karmabot/graph"
+)
+
+// graphData is the data that is passed to the
+// graph template and returned by the API.
+type graphData struct {
+	Workspace string       `json:"workspace,omitempty"`
+	Since     string       `json:"since,omitempty"`
+	Until     string       `json:"until,omitempty"`
+	Graph     *graph.Graph `json:"graph"`
+
+	// Layout places the graph's nodes on a circle, and
+	// Reciprocity is the graph's reciprocity as a percentage.
+	Layout      *graphLayout `json:"-"`
+	Reciprocity int          `json:"-"`
+}
+
+// Graph serves the view of who gave karma to whom.
+func (h *Handlers) Graph(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getGraph(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "graph.html", &templateData{
+		Config: config,
+		Data:   data,
+	})
+}
+
+// APIGraph serves the graph of who gave karma to whom as JSON.
+func (h *Handlers) APIGraph(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getGraph(r)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	h.ui.renderJSON(w, data)
+}
+
+// getGraph builds the graph of the karma that was given between the
+// since and until query parameters, which are YYYY-MM-DD dates in UTC.
+// Both are inclusive and optional.
+func (h *Handlers) getGraph(r *http.Request) (*graphData, error) {
+	var (
+		ctx   = r.Context()
+		query = r.URL.Query()
+		data  = &graphData{
+			Since: query.Get("since"),
+			Until: query.Get("until"),
+		}
+		since, until time.Time
+		err          error
+	)
+
+	if data.Since != "" {
+		since, err = time.Parse("2006-01-02", data.Since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", data.Since)
+		}
+	}
+	if data.Until != "" {
+		until, err = time.Parse("2006-01-02", data.Until)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", data.Until)
+		}
+		until = until.AddDate(0, 0, 1)
+	}
+
+	db := h.db(r)
+	data.Workspace = db.Team()
+
+	edges, err := db.GetEdges(ctx, since, until)
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not get karma graph")
+
+		return nil, err
+	}
+
+	users, err := db.GetUserNames(ctx)
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not get users")
+
+		return nil, err
+	}
+
+	data.Graph = graph.New(edges, users)
+	data.Layout = newGraphLayout(data.Graph)
+	data.Reciprocity = int(math.Round(data.Graph.Stats.Reciprocity * 100))
+
+	return data, nil
+}
+
+// graphSize is the width and height of the graph, in SVG user units.
+const graphSize = 800
+
+// A graphLayout positions a graph's nodes evenly on a circle, and
+// draws its edges as lines between them.
+type graphLayout struct {
+	Size  int
+	Nodes []*layoutNode
+	Edges []*layoutEdge
+}
+
+type layoutNode struct {
+	Name   string
+	X, Y   float64
+	Anchor string
+}
+
+type layoutEdge struct {
+	X1, Y1, X2, Y2 float64
+	Width          float64
+	Title          string
+}
+
+func newGraphLayout(g *graph.Graph) *graphLayout {
+	var (
+		layout = &graphLayout{Size: graphSize}
+		center = float64(graphSize) / 2
+		radius = center * 0.7
+		index  = make(map[string]*layoutNode)
+		max    = 1
+	)
+
+	for i, node := range g.Nodes {
+		angle := 2 * math.Pi * float64(i) / float64(len(g.Nodes))
+		n := &layoutNode{
+			Name:   node.Name,
+			X:      center + radius*math.Cos(angle),
+			Y:      center + radius*math.Sin(angle),
+			Anchor: "start",
+		}
+		if math.Cos(angle) < 0 {
+			n.Anchor = "end"
+		}
+
+		index[node.Name] = n
+		layout.Nodes = append(layout.Nodes, n)
+	}
+
+	for _, edge := range g.Edges {
+		if points := abs(edge.Points); points > max {
+			max = points
+		}
+	}
+	for _, edge := range g.Edges {
+		from, to := index[edge.From], index[edge.To]
+		layout.Edges = append(layout.Edges, &layoutEdge{
+			X1:    from.X,
+			Y1:    from.Y,
+			X2:    to.X,
+			Y2:    to.Y,
+			Width: 1 + 4*float64(abs(edge.Points))/float64(max),
+			Title: fmt.Sprintf("%s → %s: %d points in %d operation(s)", edge.From, edge.To, edge.Points, edge.Count),
+		})
+	}
+
+	return layout
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -1,8 +1,10 @@
 package webui
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/kamaln7/karmabot/database"
@@ -16,13 +18,227 @@ type Handlers struct {
 	ui *UI
 }
 
+// leaderboardData is the data that is passed to the
+// leaderboard template and returned by the API.
+type leaderboardData struct {
+	Workspace   string               `json:"workspace,omitempty"`
+	Kind        database.Kind        `json:"kind,omitempty"`
+	Limit       int                  `json:"limit"`
+	TotalPoints int                  `json:"total_points"`
+	Leaderboard database.Leaderboard `json:"leaderboard"`
+
+	// Decay is the workspace's karma decay, if it has any. MixedDecay
+	// is set when the karma of all workspaces combined decays with the
+	// different decays of the workspaces.
+	Decay      *database.Decay `json:"decay,omitempty"`
+	MixedDecay bool            `json:"mixed_decay,omitempty"`
+}
+
 // Home redirects to the leaderboard view.
 func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/leaderboard", 302)
+	http.Redirect(w, r, basePath(r)+"/leaderboard", 302)
 }
 
 // Leaderboard serves the leaderboard view.
 func (h *Handlers) Leaderboard(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getLeaderboard(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "leaderboard.html", &templateData{
+		Config: config,
+		Data:   data,
+	})
+}
+
+// APILeaderboard serves the leaderboard as JSON.
+func (h *Handlers) APILeaderboard(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getLeaderboard(r)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	h.ui.renderJSON(w, data)
+}
+
+// Things serves the leaderboard of things and topics.
+func (h *Handlers) Things(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getKindLeaderboard(r, database.KindThing)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "leaderboard.html", &templateData{
+		Config: config,
+		Data:   data,
+	})
+}
+
+// APIThings serves the leaderboard of things and topics as JSON.
+func (h *Handlers) APIThings(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getKindLeaderboard(r, database.KindThing)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	h.ui.renderJSON(w, data)
+}
+
+// APIWorkspaces lists all known workspaces as JSON.
+func (h *Handlers) APIWorkspaces(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := h.ui.Config.DB.GetWorkspaces(r.Context())
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not list workspaces")
+
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	h.ui.renderJSON(w, workspaces)
+}
+
+// auditPageSize is the number of audit entries on each page.
+const auditPageSize = 50
+
+// auditData is the data that is passed to the
+// audit template and returned by the API.
+type auditData struct {
+	Workspace string                 `json:"workspace,omitempty"`
+	User      string                 `json:"user,omitempty"`
+	Page      int                    `json:"page"`
+	Entries   []*database.AuditEntry `json:"entries"`
+
+	// Previous and Next link to the adjacent pages, if any.
+	Previous string `json:"-"`
+	Next     string `json:"-"`
+}
+
+// Audit serves the audit log view.
+func (h *Handlers) Audit(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getAudit(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "audit.html", &templateData{
+		Config: config,
+		Data:   data,
+	})
+}
+
+// APIAudit serves the audit log as JSON.
+func (h *Handlers) APIAudit(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getAudit(r)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	h.ui.renderJSON(w, data)
+}
+
+func (h *Handlers) getAudit(r *http.Request) (*auditData, error) {
+	var (
+		query = r.URL.Query()
+		page  = 1
+		err   error
+	)
+
+	allowed, err := h.allowed(r, ActionAudit)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, errNotAllowed
+	}
+
+	if pageS := query.Get("page"); pageS != "" {
+		page, err = strconv.Atoi(pageS)
+		if err != nil || page < 1 {
+			return nil, fmt.Errorf("invalid page %q", pageS)
+		}
+	}
+
+	db := h.db(r)
+	user := query.Get("user")
+
+	// fetch one extra entry to find out whether there is a next page
+	entries, err := db.GetAuditLog(r.Context(), &database.AuditQuery{
+		User:   user,
+		Limit:  auditPageSize + 1,
+		Offset: (page - 1) * auditPageSize,
+	})
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not get audit log")
+
+		return nil, err
+	}
+
+	data := &auditData{
+		Workspace: db.Team(),
+		User:      user,
+		Page:      page,
+		Entries:   entries,
+	}
+
+	pageURL := func(page int) string {
+		values := url.Values{}
+		if user != "" {
+			values.Set("user", user)
+		}
+		values.Set("page", strconv.Itoa(page))
+
+		return basePath(r) + "/audit?" + values.Encode()
+	}
+	if page > 1 {
+		data.Previous = pageURL(page - 1)
+	}
+	if len(entries) > auditPageSize {
+		data.Entries = entries[:auditPageSize]
+		data.Next = pageURL(page + 1)
+	}
+
+	return data, nil
+}
+
+// getLeaderboard returns the leaderboard, which leaves things out
+// if they are ranked separately.
+func (h *Handlers) getLeaderboard(r *http.Request) (*leaderboardData, error) {
+	var kind database.Kind
+	if h.ui.Config.SeparateThings {
+		kind = database.KindPerson
+	}
+
+	return h.getKindLeaderboard(r, kind)
+}
+
+// getKindLeaderboard returns the leaderboard of a kind,
+// or of people and things combined if kind is empty.
+func (h *Handlers) getKindLeaderboard(r *http.Request, kind database.Kind) (*leaderboardData, error) {
 	var (
 		limit int
 		err   error
@@ -36,36 +252,126 @@ func (h *Handlers) Leaderboard(w http.ResponseWriter, r *http.Request) {
 		limit, err = strconv.Atoi(limitS)
 
 		if err != nil {
-			h.ui.renderError(w, err)
-			return
+			return nil, err
 		}
 	}
 
-	points, err := h.ui.Config.DB.GetTotalPoints()
+	db := h.db(r)
+	points, err := db.GetTotalPoints(r.Context())
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not get total points")
+
+		return nil, err
+	}
 
-	leaderboard, err := h.ui.Config.DB.GetLeaderboard(limit)
+	leaderboard, err := db.GetLeaderboard(r.Context(), kind, limit)
 	if err != nil {
 		h.ui.Config.Log.Err(err).KV("limit", limit).Error("could not generate leaderboard")
 
-		h.ui.renderError(w, err)
-		return
+		return nil, err
 	}
 
-	data := &templateData{
-		Config: &templateConfig{
-			LeaderboardLimit: h.ui.Config.LeaderboardLimit,
-		},
-		Data: &struct {
-			Limit, TotalPoints int
-			Leaderboard        database.Leaderboard
-		}{
-			Limit:       limit,
-			TotalPoints: points,
-			Leaderboard: leaderboard,
-		},
+	decay, err := db.GetDecay(r.Context())
+	switch err {
+	case nil:
+	case database.ErrNoSuchDecay:
+		decay = nil
+	default:
+		return nil, err
+	}
+
+	mixed := false
+	if db.Team() == "" && decay != nil {
+		mixed, err = h.mixedDecay(r.Context())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &leaderboardData{
+		Workspace:   db.Team(),
+		Kind:        kind,
+		Limit:       limit,
+		TotalPoints: points,
+		Leaderboard: leaderboard,
+		Decay:       decay,
+		MixedDecay:  mixed,
+	}, nil
+}
+
+// mixedDecay checks whether the karma of some workspaces decays
+// differently than the karma of others.
+func (h *Handlers) mixedDecay(ctx context.Context) (bool, error) {
+	workspaces, err := h.ui.Config.DB.GetWorkspaces(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var first *database.Decay
+	for i, workspace := range workspaces {
+		decay, err := h.ui.Config.DB.WithTeam(workspace.ID).GetDecay(ctx)
+		switch err {
+		case nil:
+		case database.ErrNoSuchDecay:
+			decay = &database.Decay{}
+		default:
+			return false, err
+		}
+
+		if i == 0 {
+			first = decay
+		} else if decay.Model != first.Model || decay.Months != first.Months {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// db returns the database scoped to the workspace
+// in the request's URL, if any.
+func (h *Handlers) db(r *http.Request) *database.DB {
+	return h.ui.Config.DB.WithTeam(mux.Vars(r)["workspace"])
+}
+
+// basePath returns the URL prefix of the workspace
+// in the request's URL, if any.
+func basePath(r *http.Request) string {
+	if workspace := mux.Vars(r)["workspace"]; workspace != "" {
+		return "/workspace/" + workspace
+	}
+
+	return ""
+}
+
+func (h *Handlers) templateConfig(r *http.Request) (*templateConfig, error) {
+	workspaces, err := h.ui.Config.DB.GetWorkspaces(r.Context())
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not list workspaces")
+
+		return nil, err
+	}
+
+	config := &templateConfig{
+		LeaderboardLimit: h.ui.Config.LeaderboardLimit,
+		BasePath:         basePath(r),
+		Workspaces:       workspaces,
+		Theme:            h.ui.theme,
+	}
+
+	config.Audit, err = h.allowed(r, ActionAudit)
+	if err != nil {
+		return nil, err
+	}
+
+	current := mux.Vars(r)["workspace"]
+	for _, workspace := range workspaces {
+		if workspace.ID == current {
+			config.Workspace = workspace
+		}
 	}
 
-	h.ui.renderTemplate(w, "leaderboard.html", data)
+	return config, nil
 }
 
 // NotFound handles invalid URIs that do not
@@ -0,0 +1,136 @@
+package webui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/aybabtme/log"
+)
+
+// newTestProvider returns a web UI with the workspaces T1 and T2.
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	db, err := database.New(&database.Config{Path: filepath.Join(t.TempDir(), "karma.sqlite3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, team := range []string{"T1", "T2"} {
+		err = db.SaveWorkspace(context.Background(), &database.Workspace{ID: team, Name: strings.ToLower(team)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider, err := New(&Config{
+		URL:             "http://karmabot",
+		InsecureCookies: true,
+		Log:             log.KV("test", true),
+		DB:              db,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+// get serves a GET request for URI, signed in with a login link.
+func get(t *testing.T, provider *Provider, URI string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	link, err := provider.GetLoginURL("T1", "U1", "alice", URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	provider.ui.router.ServeHTTP(w, httptest.NewRequest("GET", link, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d for %s; want 200", w.Code, URI)
+	}
+
+	return w
+}
+
+func TestLeaderboardMixedDecay(t *testing.T) {
+	exponential := &database.Decay{Model: database.DecayExponential, Months: 6}
+	linear := &database.Decay{Model: database.DecayLinear, Months: 6}
+
+	tt := []struct {
+		Name        string
+		URI         string
+		Decays      map[string]*database.Decay
+		ExpectDecay bool
+		ExpectMixed bool
+	}{
+		{
+			Name: "no decay",
+			URI:  "/api/leaderboard",
+		},
+		{
+			Name:        "same decay",
+			URI:         "/api/leaderboard",
+			Decays:      map[string]*database.Decay{"T1": exponential, "T2": exponential},
+			ExpectDecay: true,
+		},
+		{
+			Name:        "decay of all workspaces",
+			URI:         "/api/leaderboard",
+			Decays:      map[string]*database.Decay{"": exponential},
+			ExpectDecay: true,
+		},
+		{
+			Name:        "different decays",
+			URI:         "/api/leaderboard",
+			Decays:      map[string]*database.Decay{"T1": exponential, "T2": linear},
+			ExpectDecay: true,
+			ExpectMixed: true,
+		},
+		{
+			Name:        "decay in one workspace",
+			URI:         "/api/leaderboard",
+			Decays:      map[string]*database.Decay{"T2": linear},
+			ExpectDecay: true,
+			ExpectMixed: true,
+		},
+		{
+			Name:        "one workspace",
+			URI:         "/api/workspace/T1/leaderboard",
+			Decays:      map[string]*database.Decay{"T1": exponential, "T2": linear},
+			ExpectDecay: true,
+		},
+	}
+
+	for _, tc := range tt {
+		provider := newTestProvider(t)
+		for team, decay := range tc.Decays {
+			err := provider.Config.DB.WithTeam(team).SetDecay(context.Background(), decay)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		data := &leaderboardData{}
+		err := json.NewDecoder(get(t, provider, tc.URI).Body).Decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.Name, err)
+		}
+
+		if (data.Decay != nil) != tc.ExpectDecay {
+			t.Errorf("%s: got decay %+v; want decay %v", tc.Name, data.Decay, tc.ExpectDecay)
+		}
+		if data.MixedDecay != tc.ExpectMixed {
+			t.Errorf("%s: got mixed decay %v; want %v", tc.Name, data.MixedDecay, tc.ExpectMixed)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package webui
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kamaln7/karmabot/database"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// profilePageSize is the number of karma operations
+	// on each page of a user's profile.
+	profilePageSize = 20
+
+	// profileTopUsers is the number of users that are listed
+	// as a user's top givers and recipients.
+	profileTopUsers = 10
+)
+
+// profileData is the data that is passed to the
+// profile template and returned by the API.
+type profileData struct {
+	Workspace  string                 `json:"workspace,omitempty"`
+	User       *database.User         `json:"user"`
+	Rank       int                    `json:"rank"`
+	Kind       database.Kind          `json:"kind,omitempty"`
+	History    []*database.DailyTotal `json:"history"`
+	Givers     []*database.User       `json:"givers"`
+	Recipients []*database.User       `json:"recipients"`
+	Page       int                    `json:"page"`
+	Records    []*database.Record     `json:"records"`
+
+	// Chart plots the user's total over time.
+	Chart *chart `json:"-"`
+
+	// Previous and Next link to the adjacent pages, if any.
+	Previous string `json:"-"`
+	Next     string `json:"-"`
+}
+
+// Profile serves a user's profile view.
+func (h *Handlers) Profile(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getProfile(r)
+	if err == database.ErrNoSuchUser {
+		h.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "profile.html", &templateData{
+		Config: config,
+		Data:   data,
+	})
+}
+
+// APIProfile serves a user's profile as JSON.
+func (h *Handlers) APIProfile(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getProfile(r)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	h.ui.renderJSON(w, data)
+}
+
+func (h *Handlers) getProfile(r *http.Request) (*profileData, error) {
+	var (
+		ctx  = r.Context()
+		name = strings.ToLower(mux.Vars(r)["name"])
+		page = 1
+		err  error
+	)
+
+	if pageS := r.URL.Query().Get("page"); pageS != "" {
+		page, err = strconv.Atoi(pageS)
+		if err != nil || page < 1 {
+			return nil, fmt.Errorf("invalid page %q", pageS)
+		}
+	}
+
+	// everyone may look at their own profile
+	if s := session(r); s == nil || s.User == "" || !strings.EqualFold(s.Name, name) {
+		allowed, err := h.allowed(r, ActionHistory)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, errNotAllowed
+		}
+	}
+
+	db := h.db(r)
+	data := &profileData{
+		Workspace: db.Team(),
+		Page:      page,
+	}
+
+	data.User, err = db.GetUser(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// people and things are ranked separately if the leaderboard
+	// leaves things out
+	if h.ui.Config.SeparateThings {
+		data.Kind, err = db.GetKind(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if data.Kind == "" {
+			data.Kind = database.KindPerson
+		}
+	}
+
+	data.Rank, err = db.GetRank(ctx, data.Kind, name)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", name).Error("could not get rank")
+
+		return nil, err
+	}
+
+	data.History, err = db.GetDailyTotals(ctx, name)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", name).Error("could not get karma history")
+
+		return nil, err
+	}
+	data.Chart = newChart(data.History)
+
+	data.Givers, err = db.GetTopGivers(ctx, name, profileTopUsers)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", name).Error("could not get top givers")
+
+		return nil, err
+	}
+
+	data.Recipients, err = db.GetTopRecipients(ctx, name, profileTopUsers)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", name).Error("could not get top recipients")
+
+		return nil, err
+	}
+
+	// fetch one extra record to find out whether there is a next page
+	records, err := db.GetUserRecords(ctx, name, profilePageSize+1, (page-1)*profilePageSize)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", name).Error("could not get karma operations")
+
+		return nil, err
+	}
+	data.Records = records
+
+	pageURL := func(page int) string {
+		values := url.Values{}
+		values.Set("page", strconv.Itoa(page))
+
+		return basePath(r) + "/user/" + url.PathEscape(name) + "?" + values.Encode()
+	}
+	if page > 1 {
+		data.Previous = pageURL(page - 1)
+	}
+	if len(records) > profilePageSize {
+		data.Records = records[:profilePageSize]
+		data.Next = pageURL(page + 1)
+	}
+
+	return data, nil
+}
+
+// Dimensions of the profile chart, in SVG user units.
+const (
+	chartWidth  = 600
+	chartHeight = 200
+)
+
+// A chart is a line chart of a user's total points over time
+// that is drawn as an SVG polyline.
+type chart struct {
+	Width, Height int
+
+	// Points is the polyline's points attribute, and Zero is
+	// the y coordinate of 0 points.
+	Points string
+	Zero   float64
+
+	Min, Max    int
+	First, Last string
+}
+
+// newChart plots daily totals with time on the x axis. It returns nil
+// if the user has not received any karma.
+func newChart(history []*database.DailyTotal) *chart {
+	if len(history) == 0 {
+		return nil
+	}
+
+	// start the line at 0 points on the day before the first karma
+	history = append([]*database.DailyTotal{{Date: history[0].Date.AddDate(0, 0, -1)}}, history...)
+
+	c := &chart{
+		Width:  chartWidth,
+		Height: chartHeight,
+		First:  history[0].Date.Format("2006-01-02"),
+		Last:   history[len(history)-1].Date.Format("2006-01-02"),
+	}
+
+	// always include 0 so that the chart shows where the total changes sign
+	for _, day := range history {
+		if day.Total < c.Min {
+			c.Min = day.Total
+		}
+		if day.Total > c.Max {
+			c.Max = day.Total
+		}
+	}
+
+	var (
+		start    = history[0].Date
+		duration = history[len(history)-1].Date.Sub(start).Hours()
+		span     = float64(c.Max - c.Min)
+		points   []string
+	)
+	if span == 0 {
+		span = 1
+	}
+
+	y := func(total int) float64 {
+		return chartHeight - float64(total-c.Min)/span*chartHeight
+	}
+	for _, day := range history {
+		x := day.Date.Sub(start).Hours() / duration * chartWidth
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y(day.Total)))
+	}
+
+	c.Points = strings.Join(points, " ")
+	c.Zero = y(0)
+
+	return c
+}
@@ -1,25 +1,79 @@
 package webui
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/kamaln7/karmabot/database"
 	"github.com/kamaln7/karmabot/ui"
+	"github.com/kamaln7/karmabot/ui/webui/auth"
 
 	"github.com/aybabtme/log"
-	"github.com/pquerna/otp/totp"
 )
 
 // Config contains all the necessary config
 // options to start and serve a web UI.
 type Config struct {
-	ListenAddr, URL, TOTP, FilesPath string
-	LeaderboardLimit                 int
-	Log                              *log.Log
-	Debug                            bool
-	DB                               *database.DB
+	ListenAddr, URL, FilesPath string
+
+	// Auth is the authentication mode, AuthLinks (the default) or
+	// AuthSlack. Slack configures "Sign in with Slack" for AuthSlack.
+	Auth  string
+	Slack *auth.OIDCConfig
+
+	// SessionLifetime is how long users stay signed in. InsecureCookies
+	// allows session cookies to be sent over plain HTTP.
+	SessionLifetime time.Duration
+	InsecureCookies bool
+
+	// Theme customizes the look of the web UI.
+	Theme *Theme
+
+	// SeparateThings leaves things and topics, as opposed to people,
+	// out of the leaderboard. They are listed on the things page.
+	SeparateThings bool
+
+	// Authorize checks whether the Slack user of a session may perform
+	// an action, such as ActionWebUI, in a workspace. Everybody may do
+	// everything if Authorize is nil.
+	Authorize func(ctx context.Context, team, user, action string) (bool, error)
+
+	// UserName looks up the Slack username of a user in a workspace,
+	// which is the name that karma is given to, when they sign in with
+	// Slack. Without it, sessions have the user's display name instead.
+	UserName func(ctx context.Context, team, user string) (string, error)
+
+	// SigningSecret is the signing secret of the Slack app. If it is
+	// set, the web UI receives events from Slack's Events API at
+	// /slack/events and passes the ones that Slack signed to Events,
+	// along with the ID of their workspace.
+	SigningSecret string
+	Events        func(ctx context.Context, team string, event json.RawMessage)
+
+	LeaderboardLimit int
+	Log              *log.Log
+	Debug            bool
+	DB               *database.DB
 }
 
+// Authentication modes. With AuthLinks, users sign in with personal,
+// single-use links that karmabot sends them in chat. With AuthSlack,
+// users sign in with Slack and must be members of one of the
+// workspaces that karmabot is connected to.
+const (
+	AuthLinks = "links"
+	AuthSlack = "slack"
+)
+
+// authTOTP is the name that AuthLinks had when links contained a
+// shared TOTP token. It is still accepted in existing configs.
+const authTOTP = "totp"
+
 // A Provider provides a UI service that can be
 // attached to karmabot.
 type Provider struct {
@@ -31,24 +85,34 @@ type Provider struct {
 var _ ui.Provider = new(Provider)
 
 // New returns a new instance the web UI provider.
-// It also generates a TOTP token and quits if one is not
-// passed.
 func New(config *Config) (*Provider, error) {
 	if config.URL == "" {
 		config.URL = fmt.Sprintf("http://%s", config.ListenAddr)
 	}
 
-	if config.TOTP == "" {
-		key, err := totp.Generate(totp.GenerateOpts{
-			Issuer:      "karmabot",
-			AccountName: "slack",
-		})
+	if !config.InsecureCookies && strings.HasPrefix(config.URL, "http://") {
+		config.Log.KV("url", config.URL).Info("session cookies are only sent over HTTPS, so signing in will not work unless the web UI is served over HTTPS or insecure cookies are allowed")
+	}
 
-		if err != nil {
-			config.Log.Err(err).Fatal("an error occurred while generating a TOTP key")
-		} else {
-			config.Log.KV("totpKey", key.Secret()).Fatal("please use the following TOTP key")
+	switch config.Auth {
+	case "", AuthLinks, authTOTP:
+		config.Auth = AuthLinks
+	case AuthSlack:
+		if config.Slack == nil || config.Slack.ClientID == "" || config.Slack.ClientSecret == "" {
+			return nil, errors.New("signing in with slack requires a client ID and a client secret")
 		}
+
+		config.Slack.RedirectURL = config.URL + "/auth/slack/callback"
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q, must be %s or %s", config.Auth, AuthLinks, AuthSlack)
+	}
+
+	if config.Theme == nil {
+		config.Theme = &Theme{}
+	}
+	err := config.Theme.validate()
+	if err != nil {
+		return nil, err
 	}
 
 	provider := &Provider{
@@ -62,19 +126,44 @@ func New(config *Config) (*Provider, error) {
 // Listen starts the HTTP server.
 func (p *Provider) Listen() error {
 	p.Config.Log.Info("webui listening")
-	p.ui.Listen()
 
-	return nil
+	return p.ui.Listen()
+}
+
+// Shutdown gracefully stops the HTTP server.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return p.ui.Shutdown(ctx)
 }
 
-// GetURL returns the passed URI as a full URL
-// with an authentication token that is valid
-// for 30 seconds.
+// GetURL returns the passed URI as a full URL. It does not sign
+// anyone in, so it can be shared: visitors that are not signed in
+// are asked to sign in first.
 func (p *Provider) GetURL(URI string) (string, error) {
-	token, err := p.ui.authenticator.GetToken()
+	return p.Config.URL + URI, nil
+}
+
+// GetLoginURL returns the passed URI as a full URL with
+// a single-use token that signs in the given Slack user.
+// The token expires after auth.LoginLinkLifetime.
+func (p *Provider) GetLoginURL(team, user, name, URI string) (string, error) {
+	token, err := p.ui.authenticator.NewLoginToken(context.Background(), &auth.Identity{
+		UserID: user,
+		TeamID: team,
+		Name:   name,
+	})
 	if err != nil {
+		p.Config.Log.Err(err).KV("user", user).Error("could not create login token")
+
 		return "", err
 	}
 
-	return fmt.Sprintf("%s%s?token=%s", p.Config.URL, URI, token), nil
+	return LoginURL(p.Config.URL, URI, token), nil
+}
+
+// LoginURL returns the URL of a page of the web UI at baseURL
+// with a login token that signs in its user.
+func LoginURL(baseURL, URI, token string) string {
+	values := url.Values{}
+	values.Set("login", token)
+	return fmt.Sprintf("%s%s?%s", baseURL, URI, values.Encode())
 }
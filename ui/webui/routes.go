@@ -1,8 +1,8 @@
 package webui
 
 import (
+	"io/fs"
 	"net/http"
-	"path"
 )
 
 func (u *UI) setupRoutes() {
@@ -16,14 +16,57 @@ func (u *UI) setupRoutes() {
 	)
 
 	// assets
-	assetsPath := path.Join(u.Config.FilesPath, "assets")
-	assetsHandler := http.StripPrefix("/assets/", http.FileServer(http.Dir(assetsPath)))
+	assets, err := fs.Sub(u.files, "assets")
+	if err != nil {
+		u.Config.Log.Err(err).Fatal("could not load assets. exiting.")
+	}
+	assetsHandler := http.StripPrefix("/assets/", http.FileServer(http.FS(assets)))
 	r.PathPrefix("/assets/").Handler(assetsHandler)
 
+	// sign in with slack
+	if u.oidc != nil {
+		r.HandleFunc("/auth/slack/login", h.SlackLogin).Methods("GET")
+		r.HandleFunc("/auth/slack/callback", h.SlackCallback).Methods("GET")
+	}
+
+	// slack events api
+	if u.Config.SigningSecret != "" && u.Config.Events != nil {
+		r.HandleFunc("/slack/events", h.SlackEvents).Methods("POST")
+	}
+
 	// routes
-	r.HandleFunc("/", h.MustAuth(h.Home)).Methods("GET")
-	r.HandleFunc("/leaderboard", h.MustAuth(h.Leaderboard)).Methods("GET")
-	r.HandleFunc(`/leaderboard/{limit:\d+}`, h.MustAuth(h.Leaderboard)).Methods("GET")
+	// every page is served for all workspaces combined
+	// and for each workspace separately
+	for _, prefix := range []string{"", "/workspace/{workspace}"} {
+		r.HandleFunc(prefix+"/", h.MustAuth(h.Home)).Methods("GET")
+		r.HandleFunc(prefix+"/leaderboard", h.MustAuth(h.Leaderboard)).Methods("GET")
+		r.HandleFunc(prefix+`/leaderboard/{limit:\d+}`, h.MustAuth(h.Leaderboard)).Methods("GET")
+		r.HandleFunc(prefix+"/things", h.MustAuth(h.Things)).Methods("GET")
+		r.HandleFunc(prefix+`/things/{limit:\d+}`, h.MustAuth(h.Things)).Methods("GET")
+		r.HandleFunc(prefix+"/audit", h.MustAuth(h.Audit)).Methods("GET")
+		r.HandleFunc(prefix+"/user/{name}", h.MustAuth(h.Profile)).Methods("GET")
+		r.HandleFunc(prefix+"/graph", h.MustAuth(h.Graph)).Methods("GET")
+		r.HandleFunc(prefix+"/tv", h.MustAuth(h.TV)).Methods("GET")
+		r.HandleFunc(prefix+`/tv/{limit:\d+}`, h.MustAuth(h.TV)).Methods("GET")
+
+		// api
+		r.HandleFunc("/api"+prefix+"/leaderboard", h.MustAuth(h.APILeaderboard)).Methods("GET")
+		r.HandleFunc("/api"+prefix+`/leaderboard/{limit:\d+}`, h.MustAuth(h.APILeaderboard)).Methods("GET")
+		r.HandleFunc("/api"+prefix+"/things", h.MustAuth(h.APIThings)).Methods("GET")
+		r.HandleFunc("/api"+prefix+`/things/{limit:\d+}`, h.MustAuth(h.APIThings)).Methods("GET")
+		r.HandleFunc("/api"+prefix+"/audit", h.MustAuth(h.APIAudit)).Methods("GET")
+		r.HandleFunc("/api"+prefix+"/user/{name}", h.MustAuth(h.APIProfile)).Methods("GET")
+		r.HandleFunc("/api"+prefix+"/graph", h.MustAuth(h.APIGraph)).Methods("GET")
+		r.HandleFunc("/api"+prefix+"/stream", h.MustAuth(h.Stream)).Methods("GET")
+		r.HandleFunc("/api"+prefix+`/stream/{limit:\d+}`, h.MustAuth(h.Stream)).Methods("GET")
+	}
+	r.HandleFunc("/api/workspaces", h.MustAuth(h.APIWorkspaces)).Methods("GET")
+
+	// sessions
+	r.HandleFunc("/sessions", h.MustAuth(h.Sessions)).Methods("GET")
+	r.HandleFunc("/sessions/revoke", h.MustAuth(h.RevokeSession)).Methods("POST")
+	r.HandleFunc("/api/sessions", h.MustAuth(h.APISessions)).Methods("GET")
+	r.HandleFunc("/logout", h.Logout).Methods("POST")
 
 	// custom handlers
 	r.NotFoundHandler = http.HandlerFunc(h.NotFound)
@@ -0,0 +1,148 @@
+package webui
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+// sessionsData is the data that is passed to the
+// sessions template and returned by the API.
+type sessionsData struct {
+	// Current is the ID of the session of the current request.
+	Current  string              `json:"current"`
+	Sessions []*database.Session `json:"sessions"`
+}
+
+// Sessions serves the list of the signed in user's sessions.
+func (h *Handlers) Sessions(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getSessions(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "sessions.html", &templateData{
+		Config: config,
+		Data:   data,
+	})
+}
+
+// APISessions serves the signed in user's sessions as JSON.
+func (h *Handlers) APISessions(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getSessions(r)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	h.ui.renderJSON(w, data)
+}
+
+// getSessions returns all sessions of the user of the current
+// session.
+func (h *Handlers) getSessions(r *http.Request) (*sessionsData, error) {
+	current, err := h.ui.authenticator.Session(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &sessionsData{Current: current.ID}
+	data.Sessions, err = h.ui.Config.DB.WithTeam(current.Team).GetSessions(r.Context(), current.User)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", current.User).Error("could not get sessions")
+
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// RevokeSession signs out one of the signed in user's sessions.
+func (h *Handlers) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		id  = r.FormValue("id")
+	)
+
+	current, err := h.ui.authenticator.Session(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	if id == current.ID {
+		h.Logout(w, r)
+		return
+	}
+
+	// users can only revoke their own sessions
+	sessions, err := h.ui.Config.DB.WithTeam(current.Team).GetSessions(ctx, current.User)
+	if err != nil {
+		h.ui.Config.Log.Err(err).KV("user", current.User).Error("could not get sessions")
+		h.ui.renderError(w, err)
+		return
+	}
+
+	owned := false
+	for _, session := range sessions {
+		if session.ID == id {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		h.ui.renderError(w, errors.New("no such session"))
+		return
+	}
+
+	err = h.ui.Config.DB.DeleteSession(ctx, id)
+	if err != nil && err != database.ErrNoSuchSession {
+		h.ui.Config.Log.Err(err).KV("user", current.User).Error("could not revoke session")
+		h.ui.renderError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+}
+
+// Logout signs out the current session.
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	err := h.ui.authenticator.Logout(w, r)
+	if err != nil {
+		h.ui.Config.Log.Err(err).Error("could not sign out")
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "signedout.html", &templateData{
+		Config: config,
+		Data: &struct {
+			SignInURL string
+		}{
+			SignInURL: h.signInURL(),
+		},
+	})
+}
+
+// signInURL returns the URL of the sign in page, if there is one.
+func (h *Handlers) signInURL() string {
+	if h.ui.oidc == nil {
+		return ""
+	}
+
+	return "/auth/slack/login"
+}
@@ -0,0 +1,323 @@
+package webui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment, so that
+// proxies do not close it.
+const streamHeartbeat = 30 * time.Second
+
+// streamPoll is how often streams look for karma that was recorded
+// without an event, e.g. by another process or by an import.
+const streamPoll = 5 * time.Second
+
+// A rankedUser is a leaderboard entry along with how it
+// changed since the previous leaderboard that was sent.
+type rankedUser struct {
+	*database.User
+
+	Rank int `json:"rank"`
+
+	// PreviousRank is 0 if the user was not on the previous leaderboard.
+	PreviousRank int `json:"previous_rank,omitempty"`
+
+	// Change is the number of points that the user
+	// received since the previous leaderboard.
+	Change int `json:"change"`
+}
+
+// leaderboardUpdate is a leaderboard that is sent to streams.
+type leaderboardUpdate struct {
+	Limit       int           `json:"limit"`
+	TotalPoints int           `json:"total_points"`
+	Leaderboard []*rankedUser `json:"leaderboard"`
+}
+
+// newLeaderboardUpdate ranks a leaderboard and compares
+// it to the previous one, which may be nil.
+func newLeaderboardUpdate(data *leaderboardData, previous *leaderboardUpdate) *leaderboardUpdate {
+	before := make(map[string]*rankedUser)
+	if previous != nil {
+		for _, user := range previous.Leaderboard {
+			before[user.Name] = user
+		}
+	}
+
+	update := &leaderboardUpdate{
+		Limit:       data.Limit,
+		TotalPoints: data.TotalPoints,
+		Leaderboard: make([]*rankedUser, len(data.Leaderboard)),
+	}
+	for i, user := range data.Leaderboard {
+		ranked := &rankedUser{
+			User: user,
+			Rank: i + 1,
+		}
+		if old, ok := before[user.Name]; ok {
+			ranked.PreviousRank = old.Rank
+			ranked.Change = user.Points - old.Points
+		} else if previous == nil {
+			ranked.PreviousRank = ranked.Rank
+		}
+
+		update.Leaderboard[i] = ranked
+	}
+
+	return update
+}
+
+// TV serves a leaderboard that updates itself whenever
+// karma is given, for showing on a screen in the office.
+func (h *Handlers) TV(w http.ResponseWriter, r *http.Request) {
+	data, err := h.getLeaderboard(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	config, err := h.templateConfig(r)
+	if err != nil {
+		h.ui.renderError(w, err)
+		return
+	}
+
+	h.ui.renderTemplate(w, "tv.html", &templateData{
+		Config: config,
+		Data: &struct {
+			*leaderboardUpdate
+			StreamURL string
+		}{
+			leaderboardUpdate: newLeaderboardUpdate(data, nil),
+			StreamURL:         fmt.Sprintf("/api%s/stream/%d", basePath(r), data.Limit),
+		},
+	})
+}
+
+// Stream sends karma events and leaderboard updates as Server-Sent
+// Events. It sends the current leaderboard when it connects, and then
+// a "karma" event for every karma operation followed by a
+// "leaderboard" event with the updated leaderboard. Karma that is
+// given through this process is sent right away, and karma that is
+// recorded elsewhere, e.g. by karmabot while the web UI is served by
+// karmabotctl, is picked up by polling the database.
+func (h *Handlers) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.ui.renderJSONError(w, errors.New("streaming is not supported"))
+		return
+	}
+
+	// subscribe before reading the leaderboard,
+	// so that no karma is missed in between
+	db := h.db(r)
+	events, cancel := db.Subscribe()
+	defer cancel()
+
+	connected := time.Now().Truncate(time.Second)
+	poller, err := newStreamPoller(r.Context(), db)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+
+	data, err := h.getLeaderboard(r)
+	if err != nil {
+		h.ui.renderJSONError(w, err)
+		return
+	}
+	update := newLeaderboardUpdate(data, nil)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// ask nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	send := func(event string, data interface{}) error {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		return err
+	}
+
+	err = send("leaderboard", update)
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(streamPoll)
+	defer poll.Stop()
+
+	// updateLeaderboard sends the leaderboard after karma was recorded
+	updateLeaderboard := func() error {
+		data, err := h.getLeaderboard(r)
+		if err != nil {
+			return err
+		}
+		update = newLeaderboardUpdate(data, update)
+
+		return send("leaderboard", update)
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.ui.done:
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case <-poll.C:
+			var (
+				found  bool
+				recent []*database.KarmaEvent
+			)
+			found, recent, err = poller.poll(r.Context(), connected)
+			if err != nil || !found {
+				break
+			}
+
+			for _, event := range recent {
+				if err = send("karma", event); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = updateLeaderboard()
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			// send all queued events before updating the leaderboard once
+			sent := false
+			for queued := len(events); err == nil; queued-- {
+				if poller.seen(event) {
+					sent = true
+					err = send("karma", event)
+				}
+				if queued == 0 {
+					break
+				}
+				event = <-events
+			}
+			if err == nil && sent {
+				err = updateLeaderboard()
+			}
+		}
+		if err != nil {
+			h.ui.Config.Log.Err(err).Info("closing stream")
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// A streamPoller finds karma that was recorded without
+// sending an event to a stream's subscription.
+type streamPoller struct {
+	db *database.DB
+
+	// lastID is the ID of the latest record that was polled,
+	// and sent holds the IDs of later records whose events
+	// were already sent.
+	lastID int64
+	sent   map[int64]bool
+}
+
+func newStreamPoller(ctx context.Context, db *database.DB) (*streamPoller, error) {
+	lastID, err := db.LastRecordID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamPoller{
+		db:     db,
+		lastID: lastID,
+		sent:   make(map[int64]bool),
+	}, nil
+}
+
+// seen records that an event was received from the subscription, and
+// returns false if the poller has already found its record.
+func (p *streamPoller) seen(event *database.KarmaEvent) bool {
+	if event.ID <= p.lastID || p.sent[event.ID] {
+		return false
+	}
+
+	p.sent[event.ID] = true
+	return true
+}
+
+// poll looks for records that were added since the last poll. found is
+// whether there were any, and events are the ones that were not sent
+// yet and were recorded after since. Older records, such as imported
+// or compacted karma, only change the leaderboard.
+func (p *streamPoller) poll(ctx context.Context, since time.Time) (found bool, events []*database.KarmaEvent, err error) {
+	lastID, err := p.db.LastRecordID(ctx)
+	if err != nil || lastID <= p.lastID {
+		return false, nil, err
+	}
+
+	err = p.db.WalkRecords(ctx, &database.RecordQuery{AfterID: p.lastID}, func(record *database.Record) error {
+		if record.ID > lastID {
+			return nil
+		}
+
+		found = found || !p.sent[record.ID]
+		if p.sent[record.ID] || record.Timestamp.Before(since) {
+			return nil
+		}
+
+		events = append(events, &database.KarmaEvent{
+			ID:        record.ID,
+			From:      record.From,
+			To:        record.To,
+			Reason:    record.Reason,
+			Team:      record.Team,
+			Source:    record.Source,
+			Points:    record.Points,
+			Timestamp: record.Timestamp,
+		})
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	for id := range p.sent {
+		if id <= lastID {
+			delete(p.sent, id)
+		}
+	}
+	p.lastID = lastID
+
+	// events show the resulting totals of their users
+	for _, event := range events {
+		user, err := p.db.GetUser(ctx, event.To)
+		if err != nil && err != database.ErrNoSuchUser {
+			return false, nil, err
+		}
+		if user != nil {
+			event.Total = user.Points
+			event.Decayed = user.Decayed
+		}
+	}
+
+	return found, events, nil
+}
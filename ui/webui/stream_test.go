@@ -0,0 +1,287 @@
+package webui
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamaln7/karmabot/database"
+)
+
+func TestNewLeaderboardUpdate(t *testing.T) {
+	first := newLeaderboardUpdate(&leaderboardData{
+		Limit: 10,
+		Leaderboard: database.Leaderboard{
+			{Name: "alice", Points: 5},
+			{Name: "bob", Points: 3},
+		},
+	}, nil)
+
+	for _, user := range first.Leaderboard {
+		if user.PreviousRank != user.Rank || user.Change != 0 {
+			t.Errorf("got %+v in the first update; want it unchanged", user)
+		}
+	}
+
+	second := newLeaderboardUpdate(&leaderboardData{
+		Limit: 10,
+		Leaderboard: database.Leaderboard{
+			{Name: "bob", Points: 7},
+			{Name: "alice", Points: 5},
+			{Name: "carol", Points: 1},
+		},
+	}, first)
+
+	want := []rankedUser{
+		{Rank: 1, PreviousRank: 2, Change: 4},
+		{Rank: 2, PreviousRank: 1, Change: 0},
+		{Rank: 3, PreviousRank: 0, Change: 0},
+	}
+	for i, user := range second.Leaderboard {
+		if user.Rank != want[i].Rank || user.PreviousRank != want[i].PreviousRank || user.Change != want[i].Change {
+			t.Errorf("got %s ranked %+v; want %+v", user.Name, user, want[i])
+		}
+	}
+}
+
+func TestStreamPoller(t *testing.T) {
+	var (
+		ctx = context.Background()
+		db  = newTestProvider(t).Config.DB.WithTeam("T1")
+	)
+
+	err := db.InsertPoints(ctx, &database.Points{From: "alice", To: "bob", Points: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Now().Add(-time.Minute)
+	poller, err := newStreamPoller(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, events, err := poller.poll(ctx, since)
+	if err != nil || found || len(events) != 0 {
+		t.Fatalf("got %v, %+v, %v before any new karma; want nothing", found, events, err)
+	}
+
+	// karma that was sent to the subscription is not sent again
+	sub, cancel := db.Subscribe()
+	defer cancel()
+	err = db.InsertPoints(ctx, &database.Points{From: "alice", To: "bob", Points: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-sub; !poller.seen(event) {
+		t.Errorf("got event %+v as seen; want it new", event)
+	}
+
+	// karma from other processes and other workspaces is found in
+	// the database, and old karma only changes the leaderboard
+	for _, q := range []string{
+		"insert into karma (`from`, `to`, `points`, `reason`, `team`) values ('alice', 'bob', 3, '', 'T1')",
+		"insert into karma (`from`, `to`, `points`, `reason`, `team`) values ('alice', 'bob', 10, '', 'T2')",
+		"insert into karma (`from`, `to`, `points`, `reason`, `team`, `timestamp`) values ('alice', 'carol', 4, '', 'T1', '2001-01-01 00:00:00')",
+	} {
+		_, err = db.SQL.Exec(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, events, err = poller.poll(ctx, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || len(events) != 1 {
+		t.Fatalf("got %v, %+v; want the new karma only", found, events)
+	}
+	if event := events[0]; event.To != "bob" || event.Points != 3 || event.Total != 6 {
+		t.Errorf("got event %+v; want 3 points for bob and a total of 6", event)
+	}
+
+	found, events, err = poller.poll(ctx, since)
+	if err != nil || found || len(events) != 0 {
+		t.Errorf("got %v, %+v, %v when polling again; want nothing", found, events, err)
+	}
+}
+
+// sseEvent is an event that was read from a stream.
+type sseEvent struct {
+	Name, Data string
+}
+
+// openStream connects to a stream of the web UI at
+// server and returns its events as they arrive.
+func openStream(t *testing.T, provider *Provider, server *httptest.Server, URI string) <-chan *sseEvent {
+	t.Helper()
+
+	link, err := provider.GetLoginURL("T1", "U1", "alice", URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+strings.TrimPrefix(link, provider.Config.URL), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d and content type %q for %s", res.StatusCode, res.Header.Get("Content-Type"), URI)
+	}
+
+	events := make(chan *sseEvent)
+	go func() {
+		defer res.Body.Close()
+		defer close(events)
+
+		event := &sseEvent{}
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event.Name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = strings.TrimPrefix(line, "data: ")
+			case line == "" && event.Name != "":
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+				event = &sseEvent{}
+			}
+		}
+	}()
+
+	return events
+}
+
+// nextEvent returns the next event of a stream.
+func nextEvent(t *testing.T, events <-chan *sseEvent) *sseEvent {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("the stream was closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+
+	return nil
+}
+
+func TestStream(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		provider = newTestProvider(t)
+		server   = httptest.NewServer(provider.ui.router)
+	)
+	// closing the server waits for the streams, so
+	// they are closed first, by their own cleanup
+	t.Cleanup(server.Close)
+
+	streams := map[string]<-chan *sseEvent{
+		"all workspaces": openStream(t, provider, server, "/api/stream/5"),
+		"T1":             openStream(t, provider, server, "/api/workspace/T1/stream/5"),
+		"T2":             openStream(t, provider, server, "/api/workspace/T2/stream/5"),
+	}
+	for name, events := range streams {
+		update := &leaderboardUpdate{}
+		event := nextEvent(t, events)
+		if err := json.Unmarshal([]byte(event.Data), update); event.Name != "leaderboard" || err != nil {
+			t.Fatalf("%s: got first event %+v; want the leaderboard", name, event)
+		}
+		if update.Limit != 5 || len(update.Leaderboard) != 0 {
+			t.Errorf("%s: got leaderboard %+v; want an empty leaderboard of 5", name, update)
+		}
+	}
+
+	for _, team := range []string{"T1", "T2"} {
+		err := provider.Config.DB.WithTeam(team).InsertPoints(ctx, &database.Points{From: "alice", To: "bob", Points: 2, Reason: team})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tt := []struct {
+		Name         string
+		ExpectKarma  []string
+		ExpectPoints int
+	}{
+		{
+			Name:         "all workspaces",
+			ExpectKarma:  []string{"T1", "T2"},
+			ExpectPoints: 4,
+		},
+		{
+			Name:         "T1",
+			ExpectKarma:  []string{"T1"},
+			ExpectPoints: 2,
+		},
+		{
+			Name:         "T2",
+			ExpectKarma:  []string{"T2"},
+			ExpectPoints: 2,
+		},
+	}
+
+	for _, tc := range tt {
+		events := streams[tc.Name]
+
+		var update *leaderboardUpdate
+		for _, team := range tc.ExpectKarma {
+			event := nextEvent(t, events)
+			for event.Name == "leaderboard" {
+				event = nextEvent(t, events)
+			}
+
+			karma := &database.KarmaEvent{}
+			if err := json.Unmarshal([]byte(event.Data), karma); event.Name != "karma" || err != nil {
+				t.Fatalf("%s: got event %+v; want karma", tc.Name, event)
+			}
+			if karma.Team != team || karma.To != "bob" || karma.Reason != team || karma.Points != 2 {
+				t.Errorf("%s: got karma %+v; want 2 points for bob in %s", tc.Name, karma, team)
+			}
+		}
+
+		for update == nil || update.Leaderboard[0].Points != tc.ExpectPoints {
+			event := nextEvent(t, events)
+			if event.Name != "leaderboard" {
+				t.Fatalf("%s: got event %+v; want the leaderboard", tc.Name, event)
+			}
+
+			update = &leaderboardUpdate{}
+			if err := json.Unmarshal([]byte(event.Data), update); err != nil {
+				t.Fatal(err)
+			}
+			if len(update.Leaderboard) != 1 || update.Leaderboard[0].Name != "bob" {
+				t.Fatalf("%s: got leaderboard %+v; want bob", tc.Name, update.Leaderboard)
+			}
+		}
+
+		// karma from other workspaces is not sent, and
+		// the next poll and heartbeat are seconds away
+		select {
+		case event := <-events:
+			t.Errorf("%s: got event %+v; want none", tc.Name, event)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
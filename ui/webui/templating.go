@@ -1,16 +1,29 @@
 package webui
 
 import (
+	"encoding/json"
 	"html/template"
+	"io/fs"
 	"net/http"
-	"os"
 	"path"
-	"path/filepath"
 	"strings"
+
+	"github.com/kamaln7/karmabot/database"
 )
 
 type templateConfig struct {
 	LeaderboardLimit int
+
+	// BasePath is the URL prefix of the workspace that is being
+	// viewed, or empty when viewing all workspaces combined.
+	BasePath   string
+	Workspace  *database.Workspace
+	Workspaces []*database.Workspace
+
+	// Audit is whether the user may read the audit log.
+	Audit bool
+
+	Theme *templateTheme
 }
 
 type templateData struct {
@@ -21,21 +34,24 @@ type templateData struct {
 func (u *UI) setupTemplates() {
 	u.templates = template.New("")
 
-	templatesPath := path.Join(u.Config.FilesPath, "templates")
-	err := filepath.Walk(templatesPath, func(path string, info os.FileInfo, err error) error {
-		if strings.HasSuffix(path, ".html") {
-			_, err = u.templates.ParseFiles(path)
+	names, err := u.files.list("templates")
+	if err != nil {
+		u.Config.Log.Err(err).Fatal("could not list templates. exiting.")
+	}
 
-			if err != nil {
-				u.Config.Log.Err(err).KV("template", path).Error("could not parse template")
-			}
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".html") {
+			continue
 		}
 
-		return err
-	})
+		data, err := fs.ReadFile(u.files, name)
+		if err == nil {
+			_, err = u.templates.New(path.Base(name)).Parse(string(data))
+		}
 
-	if err != nil {
-		u.Config.Log.Err(err).Fatal("could not parse all templates properly. exiting.")
+		if err != nil {
+			u.Config.Log.Err(err).KV("template", name).Fatal("could not parse all templates properly. exiting.")
+		}
 	}
 }
 
@@ -59,3 +75,23 @@ func (u *UI) renderError(w http.ResponseWriter, err error) {
 		},
 	})
 }
+
+func (u *UI) renderJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		u.Config.Log.Err(err).Error("could not encode json response")
+	}
+}
+
+func (u *UI) renderJSONError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	json.NewEncoder(w).Encode(&struct {
+		Error string `json:"error"`
+	}{
+		Error: err.Error(),
+	})
+}
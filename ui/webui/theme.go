@@ -0,0 +1,115 @@
+package webui
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+)
+
+// Theme modes. ThemeAuto follows the browser's prefers-color-scheme
+// setting, while ThemeLight and ThemeDark always use one of them.
+const (
+	ThemeAuto  = "auto"
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+// A Theme customizes the look of the web UI.
+type Theme struct {
+	// Mode is ThemeAuto (the default), ThemeLight or ThemeDark.
+	Mode string
+
+	// OrgName replaces "karmabot" in page titles and in the
+	// navigation bar.
+	OrgName string
+
+	// Logo is the URL of an image that is shown next to the title
+	// and used as the favicon. Images in the override directory can be
+	// used with e.g. /assets/images/logo.png.
+	Logo string
+
+	// AccentColor is a hex color, e.g. #9b4dca, that replaces the
+	// color of links, buttons and charts.
+	AccentColor string
+}
+
+// customStylesheet is a stylesheet in the override directory that is
+// loaded after the built-in ones, so that themes can change a few
+// styles without copying all of main.css.
+const customStylesheet = "assets/stylesheets/custom.css"
+
+var accentColorRegexp = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// validate sets the default mode and checks the theme for
+// invalid values.
+func (t *Theme) validate() error {
+	switch t.Mode {
+	case "":
+		t.Mode = ThemeAuto
+	case ThemeAuto, ThemeLight, ThemeDark:
+	default:
+		return fmt.Errorf("unknown theme %q, must be %s, %s or %s", t.Mode, ThemeAuto, ThemeLight, ThemeDark)
+	}
+
+	if t.AccentColor != "" && !accentColorRegexp.MatchString(t.AccentColor) {
+		return fmt.Errorf("invalid accent color %q, must be a hex color such as #9b4dca", t.AccentColor)
+	}
+
+	return nil
+}
+
+// templateTheme is the theme as it is passed to templates.
+type templateTheme struct {
+	*Theme
+
+	// Name is the title of the web UI: the org name, or karmabot.
+	Name string
+
+	// CustomStylesheet is the URL of the override directory's
+	// custom.css, or empty if there is none.
+	CustomStylesheet string
+
+	// Overrides lists the templates that are
+	// served from the override directory.
+	Overrides []string
+}
+
+func (u *UI) setupTheme() {
+	theme := &templateTheme{
+		Theme: u.Config.Theme,
+		Name:  u.Config.Theme.OrgName,
+	}
+	if theme.Name == "" {
+		theme.Name = "karmabot"
+	}
+
+	if u.files.overridden(customStylesheet) {
+		theme.CustomStylesheet = "/" + customStylesheet
+	}
+
+	names, err := u.files.list("templates")
+	if err != nil {
+		u.Config.Log.Err(err).Fatal("could not list templates. exiting.")
+	}
+	for _, name := range names {
+		if u.files.overridden(name) {
+			theme.Overrides = append(theme.Overrides, name)
+		}
+	}
+	if len(theme.Overrides) > 0 {
+		u.Config.Log.KV("templates", theme.Overrides).Info("using custom templates")
+	}
+
+	u.theme = theme
+}
+
+// overridden reports whether name is served from
+// the override directory.
+func (f *files) overridden(name string) bool {
+	if f.override == nil {
+		return false
+	}
+
+	_, err := fs.Stat(f.override, name)
+	return err == nil
+}
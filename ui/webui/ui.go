@@ -1,6 +1,7 @@
 package webui
 
 import (
+	"context"
 	"html/template"
 	"net/http"
 
@@ -15,19 +16,47 @@ type UI struct {
 
 	handlers      *Handlers
 	router        *mux.Router
+	server        *http.Server
+	files         *files
 	templates     *template.Template
 	authenticator *auth.Authenticator
+	theme         *templateTheme
+
+	// done is closed when the server shuts down, so that
+	// streams do not keep it from stopping and expired
+	// sessions are no longer deleted.
+	done chan struct{}
+
+	// oidc is nil unless users sign in with Slack.
+	oidc *auth.OIDC
 }
 
 func newUI(config *Config) *UI {
 	ui := &UI{
 		Config: config,
 		router: mux.NewRouter(),
-		authenticator: auth.New(&auth.Config{
-			Token: config.TOTP,
-			Log:   config.Log.KV("service", "auth"),
-		}),
+		done:   make(chan struct{}),
+		files:  newFiles(config.FilesPath),
 	}
+	ui.authenticator = auth.New(&auth.Config{
+		Log:             config.Log.KV("service", "auth"),
+		DB:              config.DB,
+		Lifetime:        config.SessionLifetime,
+		InsecureCookies: config.InsecureCookies,
+		Done:            ui.done,
+	})
+
+	if config.Auth == AuthSlack {
+		ui.oidc = auth.NewOIDC(config.Slack)
+	}
+
+	ui.server = &http.Server{
+		Addr:    config.ListenAddr,
+		Handler: ui.router,
+	}
+	ui.server.RegisterOnShutdown(func() {
+		close(ui.done)
+	})
 
 	ui.Init()
 	return ui
@@ -36,16 +65,27 @@ func newUI(config *Config) *UI {
 // Init initializes the web UI by parsing the HTML
 // templates and setting up the HTTP routes.
 func (u *UI) Init() {
+	u.setupTheme()
 	u.setupTemplates()
 	u.setupRoutes()
 }
 
-// Listen starts the actual HTTP server.
-func (u *UI) Listen() {
+// Listen starts the actual HTTP server. It blocks until
+// the server fails or is shut down.
+func (u *UI) Listen() error {
 	u.Config.Log.KV("address", u.Config.ListenAddr).Info("starting http server")
-	err := http.ListenAndServe(u.Config.ListenAddr, u.router)
+	err := u.server.ListenAndServe()
 
-	if err != nil {
-		u.Config.Log.Err(err).Fatal("could not start http server")
+	if err == http.ErrServerClosed {
+		return nil
 	}
+
+	return err
+}
+
+// Shutdown gracefully stops the HTTP server, waiting for active
+// requests to finish until ctx expires.
+func (u *UI) Shutdown(ctx context.Context) error {
+	u.Config.Log.Info("stopping http server")
+	return u.server.Shutdown(ctx)
 }
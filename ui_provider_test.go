@@ -0,0 +1,58 @@
+package karmabot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+)
+
+type TestUIProvider struct{}
+
+func (t TestUIProvider) GetURL(URI string) (string, error) {
+	return "http://ui" + URI, nil
+}
+
+func (t TestUIProvider) GetLoginURL(team, user, name, URI string) (string, error) {
+	return "http://ui" + URI + "?login=" + team + "-" + user, nil
+}
+
+func (t TestUIProvider) Listen() error {
+	return nil
+}
+
+func (t TestUIProvider) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestPrintURLLoginLink(t *testing.T) {
+	b, cs, _ := newBot(&Config{
+		UI:        TestUIProvider{},
+		Workspace: "T123",
+	})
+
+	b.handleMessageEvent(context.Background(), &slack.MessageEvent{
+		Msg: slack.Msg{
+			Type:    "message",
+			Channel: "C1",
+			User:    "U1",
+			Text:    "karmabot web",
+		},
+	})
+
+	if len(cs.SentMessages) != 2 {
+		t.Fatalf("sent %d messages; want 2", len(cs.SentMessages))
+	}
+
+	dm := cs.SentMessages[0]
+	if dm.Channel != "U1" {
+		t.Errorf("sent login link to %q; want a direct message to U1", dm.Channel)
+	}
+	if want := "http://ui/?login=T123-U1"; !strings.HasSuffix(dm.Text, want) {
+		t.Errorf("sent message %q; want a link ending in %q", dm.Text, want)
+	}
+	if reply := cs.SentMessages[1]; reply.Channel != "C1" || strings.Contains(reply.Text, "login=") {
+		t.Errorf("replied %q in %q; want a reply without the link in C1", reply.Text, reply.Channel)
+	}
+}
@@ -0,0 +1,129 @@
+package karmabot
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Workspace is a Slack workspace that karmabot connects to. Any
+// non-nil setting overrides the global config for that workspace.
+type Workspace struct {
+	Name, Token string
+
+	MaxPoints, LeaderboardLimit  *int
+	Motivate, SelfKarma, Reactji *bool
+	ReplyType                    *string
+}
+
+// ParseWorkspace parses a workspace definition in the form of
+// comma-separated key=value pairs, e.g.
+// `token=xoxb-abc,name=acme,maxpoints=3,replytype=thread`.
+func ParseWorkspace(value string) (*Workspace, error) {
+	w := &Workspace{}
+
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid workspace option %q: expected key=value", pair)
+		}
+
+		key, val := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "name":
+			w.Name = val
+		case "token":
+			w.Token = val
+		case "maxpoints", "leaderboardlimit":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid workspace option %q: %v", pair, err)
+			}
+
+			if key == "maxpoints" {
+				w.MaxPoints = &n
+			} else {
+				w.LeaderboardLimit = &n
+			}
+		case "motivate", "selfkarma", "reactji":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid workspace option %q: %v", pair, err)
+			}
+
+			switch key {
+			case "motivate":
+				w.Motivate = &b
+			case "selfkarma":
+				w.SelfKarma = &b
+			default:
+				w.Reactji = &b
+			}
+		case "replytype":
+			w.ReplyType = &val
+		default:
+			return nil, fmt.Errorf("unknown workspace option %q", key)
+		}
+	}
+
+	if w.Token == "" {
+		return nil, fmt.Errorf("workspace %q is missing a token", value)
+	}
+
+	return w, nil
+}
+
+// Apply returns a copy of config with the workspace's
+// overrides applied to it.
+func (w *Workspace) Apply(config *Config) *Config {
+	c := *config
+
+	if w.MaxPoints != nil {
+		c.MaxPoints = *w.MaxPoints
+	}
+	if w.LeaderboardLimit != nil {
+		c.LeaderboardLimit = *w.LeaderboardLimit
+	}
+	if w.Motivate != nil {
+		c.Motivate = *w.Motivate
+	}
+	if w.SelfKarma != nil {
+		c.SelfKarma = *w.SelfKarma
+	}
+	if w.ReplyType != nil {
+		c.ReplyType = *w.ReplyType
+	}
+	if w.Reactji != nil && c.Reactji != nil {
+		reactji := *c.Reactji
+		reactji.Enabled = *w.Reactji
+		c.Reactji = &reactji
+	}
+
+	return &c
+}
+
+// WorkspaceList is a list of workspaces that implements flag.Value
+type WorkspaceList []*Workspace
+
+var _ flag.Value = new(WorkspaceList)
+
+func (wl *WorkspaceList) String() string {
+	names := make([]string, len(*wl))
+	for i, w := range *wl {
+		names[i] = w.Name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Set parses a workspace definition and appends it to the list
+func (wl *WorkspaceList) Set(value string) error {
+	w, err := ParseWorkspace(value)
+	if err != nil {
+		return err
+	}
+
+	*wl = append(*wl, w)
+	return nil
+}
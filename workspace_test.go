@@ -0,0 +1,71 @@
+package karmabot
+
+import (
+	"testing"
+)
+
+func TestParseWorkspace(t *testing.T) {
+	w, err := ParseWorkspace("token=xoxb-abc, name=acme,maxpoints=3,replytype=thread,reactji=false")
+	if err != nil {
+		t.Fatalf("ParseWorkspace: %v", err)
+	}
+
+	if w.Token != "xoxb-abc" || w.Name != "acme" {
+		t.Errorf("ParseWorkspace: got token %q and name %q", w.Token, w.Name)
+	}
+
+	base := &Config{
+		MaxPoints: 6,
+		ReplyType: "message",
+		Motivate:  true,
+		Reactji:   &ReactjiConfig{Enabled: true},
+	}
+	cfg := w.Apply(base)
+
+	if cfg.MaxPoints != 3 {
+		t.Errorf("Apply: MaxPoints is %d; want 3", cfg.MaxPoints)
+	}
+	if cfg.ReplyType != "thread" {
+		t.Errorf("Apply: ReplyType is %q; want %q", cfg.ReplyType, "thread")
+	}
+	if !cfg.Motivate {
+		t.Errorf("Apply: overrode Motivate, which was not set")
+	}
+	if cfg.Reactji.Enabled {
+		t.Errorf("Apply: did not disable reactji")
+	}
+	if base.MaxPoints != 6 || !base.Reactji.Enabled {
+		t.Errorf("Apply: modified the base config")
+	}
+}
+
+func TestParseWorkspaceErrors(t *testing.T) {
+	tt := []string{
+		"name=acme",
+		"token=xoxb-abc,maxpoints=lots",
+		"token=xoxb-abc,colour=blue",
+		"token",
+	}
+
+	for _, value := range tt {
+		if _, err := ParseWorkspace(value); err == nil {
+			t.Errorf("ParseWorkspace(%q): expected an error", value)
+		}
+	}
+}
+
+func TestGetURLWorkspace(t *testing.T) {
+	b, _, _ := newBot(&Config{
+		UI:        TestUIProvider{},
+		Workspace: "T123",
+	})
+
+	url, err := b.getURL("/leaderboard/10")
+	if err != nil {
+		t.Fatalf("getURL: %v", err)
+	}
+
+	if want := "http://ui/workspace/T123/leaderboard/10"; url != want {
+		t.Errorf("getURL: got %q; want %q", url, want)
+	}
+}
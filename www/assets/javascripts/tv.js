@@ -0,0 +1,135 @@
+"use strict";
+
+// tv.js keeps the TV mode leaderboard up to date using the web UI's
+// event stream, and animates users moving up and down the leaderboard.
+(function () {
+    var list = document.getElementById("tv-leaderboard"),
+        total = document.getElementById("tv-total"),
+        status = document.getElementById("tv-status"),
+        feed = document.getElementById("tv-feed"),
+        feedSize = 8;
+
+    function item(name) {
+        var li = document.createElement("li");
+        li.dataset.name = name;
+
+        ["tv-rank", "tv-name", "tv-change", "tv-points"].forEach(function (cls) {
+            var span = document.createElement("span");
+            span.className = cls;
+            li.appendChild(span);
+        });
+        li.querySelector(".tv-name").textContent = name;
+
+        return li;
+    }
+
+    function signed(n) {
+        return (n > 0 ? "+" : "") + n;
+    }
+
+    // restart a CSS animation on el
+    function flash(el, cls) {
+        el.classList.remove(cls);
+        void el.offsetWidth;
+        el.classList.add(cls);
+    }
+
+    function renderLeaderboard(update) {
+        var before = {},
+            items = {};
+
+        Array.prototype.forEach.call(list.children, function (li) {
+            before[li.dataset.name] = li.getBoundingClientRect().top;
+            items[li.dataset.name] = li;
+        });
+
+        total.textContent = update.total_points;
+
+        var seen = {};
+        update.leaderboard.forEach(function (user) {
+            var li = items[user.name] || item(user.name);
+            seen[user.name] = true;
+
+            li.querySelector(".tv-rank").textContent = user.rank;
+            li.querySelector(".tv-points").textContent = user.decayed != null ? user.decayed : user.points;
+
+            var change = li.querySelector(".tv-change");
+            if (user.change) {
+                change.textContent = signed(user.change);
+                change.classList.toggle("down", user.change < 0);
+                flash(change, "shown");
+            }
+
+            li.classList.remove("up", "down");
+            if (!user.previous_rank) {
+                flash(li, "entered");
+            } else if (user.rank < user.previous_rank) {
+                flash(li, "up");
+            } else if (user.rank > user.previous_rank) {
+                flash(li, "down");
+            }
+
+            list.appendChild(li);
+        });
+
+        Object.keys(items).forEach(function (name) {
+            if (!seen[name]) {
+                list.removeChild(items[name]);
+            }
+        });
+
+        // slide users from their old positions to their new ones
+        Array.prototype.forEach.call(list.children, function (li) {
+            var top = before[li.dataset.name];
+            if (top === undefined) {
+                return;
+            }
+
+            var delta = top - li.getBoundingClientRect().top;
+            if (!delta) {
+                return;
+            }
+
+            li.style.transition = "none";
+            li.style.transform = "translateY(" + delta + "px)";
+            li.getBoundingClientRect();
+            li.style.transition = "";
+            li.style.transform = "";
+        });
+    }
+
+    function renderKarma(event) {
+        var li = document.createElement("li"),
+            points = document.createElement("strong");
+
+        points.textContent = signed(event.points);
+        points.className = event.points < 0 ? "down" : "up";
+
+        li.appendChild(document.createTextNode(event.from + " → " + event.to + " "));
+        li.appendChild(points);
+        if (event.reason) {
+            li.appendChild(document.createTextNode(" " + event.reason));
+        }
+
+        feed.insertBefore(li, feed.firstChild);
+        while (feed.children.length > feedSize) {
+            feed.removeChild(feed.lastChild);
+        }
+    }
+
+    var source = new EventSource(list.dataset.stream);
+
+    source.addEventListener("open", function () {
+        status.classList.add("live");
+    });
+    source.addEventListener("error", function () {
+        // the browser reconnects by itself
+        status.classList.remove("live");
+    });
+    source.addEventListener("leaderboard", function (e) {
+        renderLeaderboard(JSON.parse(e.data));
+    });
+    source.addEventListener("karma", function (e) {
+        renderKarma(JSON.parse(e.data));
+    });
+})();
@@ -0,0 +1,11 @@
+// Package www contains the web UI's HTML templates and static assets,
+// which are embedded in the karmabot and karmabotctl binaries.
+package www
+
+import "embed"
+
+// Files holds the templates directory, with the web UI's HTML
+// templates, and the assets directory, with its static assets.
+//
+//go:embed templates assets
+var Files embed.FS